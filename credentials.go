@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// readPassword reads a password from the terminal without echo, confirmed by a
+// second entry if confirm is set, or from the first line of stdin if it is not
+// a terminal.
+func readPassword(stdin io.Reader, stderr io.Writer, confirm bool) ([]byte, error) {
+	if file, ok := stdin.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		fmt.Fprint(stderr, "Password: ")
+		password, err := term.ReadPassword(int(file.Fd()))
+		fmt.Fprintln(stderr)
+		if err != nil || !confirm {
+			return password, err
+		}
+		fmt.Fprint(stderr, "Retype password: ")
+		retyped, err := term.ReadPassword(int(file.Fd()))
+		fmt.Fprintln(stderr)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(password, retyped) {
+			return nil, errors.New("passwords do not match")
+		}
+		return password, nil
+	}
+	line, err := bufio.NewReader(stdin).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	password := bytes.TrimRight(line, "\r\n")
+	if len(password) == 0 {
+		return nil, errors.New("empty password")
+	}
+	return password, nil
+}
+
+// hashCommand prints the bcrypt hash of a password read from the terminal or
+// stdin, e.g. for the BCRYPT_HASH environment variable.
+func hashCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("hash", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	cost := flags.Int("cost", auth.DefaultCost, "bcrypt cost")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	password, err := readPassword(stdin, stderr, true)
+	if err == nil {
+		var hash []byte
+		hash, err = auth.Hash(password, *cost)
+		if err == nil {
+			fmt.Fprintln(stdout, string(hash))
+			return 0
+		}
+	}
+	fmt.Fprintln(stderr, err.Error())
+	return 1
+}
+
+// verifyCommand checks a password read from the terminal or stdin against a
+// bcrypt hash or the hash of a user in a credentials file.
+func verifyCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	hash := flags.String("hash", os.Getenv("BCRYPT_HASH"), "bcrypt hash (default: BCRYPT_HASH or BCRYPT_HASH_FILE environment variable)")
+	file := flags.String("file", "", "Credentials file with the hash of the user")
+	username := flags.String("u", "", "Username in the credentials file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *file != "" {
+		credentials, err := auth.LoadCredentials(*file)
+		if err != nil {
+			fmt.Fprintln(stderr, err.Error())
+			return 1
+		}
+		userHash, ok := credentials[*username]
+		if !ok {
+			fmt.Fprintln(stderr, "Unknown user: "+*username)
+			return 1
+		}
+		*hash = string(userHash)
+	} else {
+		var err error
+		*hash, err = resolveSecret("BCRYPT_HASH", *hash)
+		if err != nil {
+			fmt.Fprintln(stderr, err.Error())
+			return 1
+		}
+	}
+	if *hash == "" {
+		fmt.Fprintln(stderr, "Missing hash")
+		return 2
+	}
+	password, err := readPassword(stdin, stderr, false)
+	if err == nil {
+		err = auth.Verify([]byte(*hash), password)
+	}
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		fmt.Fprintln(stderr, "Password does not match")
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	fmt.Fprintln(stdout, "Password matches")
+	return 0
+}
+
+// credentialsCommand adds, rotates, removes or lists the users of a
+// credentials file.
+func credentialsCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("credentials", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: aws-smtp-relay credentials [options] add|rotate|remove USER | list")
+		flags.PrintDefaults()
+	}
+	file := flags.String("file", os.Getenv("CREDENTIALS_FILE"), "Credentials file (default: CREDENTIALS_FILE environment variable)")
+	cost := flags.Int("cost", auth.DefaultCost, "bcrypt cost")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	action, username := flags.Arg(0), flags.Arg(1)
+	if *file == "" || (action == "list") != (flags.NArg() == 1) || flags.NArg() > 2 {
+		flags.Usage()
+		return 2
+	}
+	credentials, err := auth.LoadCredentials(*file)
+	if errors.Is(err, os.ErrNotExist) && action == "add" {
+		credentials, err = make(auth.Credentials), nil
+	}
+	if err == nil {
+		err = updateCredentials(credentials, action, username, *cost, stdin, stdout, stderr)
+	}
+	if err == nil && action != "list" {
+		err = credentials.Save(*file)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	return 0
+}
+
+func updateCredentials(
+	credentials auth.Credentials,
+	action string,
+	username string,
+	cost int,
+	stdin io.Reader,
+	stdout io.Writer,
+	stderr io.Writer,
+) error {
+	_, exists := credentials[username]
+	switch action {
+	case "list":
+		usernames := make([]string, 0, len(credentials))
+		for username := range credentials {
+			usernames = append(usernames, username)
+		}
+		sort.Strings(usernames)
+		if len(usernames) > 0 {
+			fmt.Fprintln(stdout, strings.Join(usernames, "\n"))
+		}
+		return nil
+	case "add", "rotate":
+		if err := auth.ValidUsername(username); err != nil {
+			return err
+		}
+		if action == "add" && exists {
+			return errors.New("User already exists: " + username)
+		}
+		if action == "rotate" && !exists {
+			return errors.New("Unknown user: " + username)
+		}
+		password, err := readPassword(stdin, stderr, true)
+		if err != nil {
+			return err
+		}
+		credentials[username], err = auth.Hash(password, cost)
+		return err
+	case "remove":
+		if !exists {
+			return errors.New("Unknown user: " + username)
+		}
+		delete(credentials, username)
+		return nil
+	}
+	return errors.New("Invalid action: " + action)
+}
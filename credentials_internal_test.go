@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/auth"
+)
+
+func TestHashCommand(t *testing.T) {
+	var stdout, stderr strings.Builder
+	code := hashCommand([]string{"-cost", "4"}, strings.NewReader("secret\n"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code: %d. Stderr: %s", code, stderr.String())
+	}
+	hash := strings.TrimSuffix(stdout.String(), "\n")
+	if err := auth.Verify([]byte(hash), []byte("secret")); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	stdout.Reset()
+	code = verifyCommand([]string{"-hash", hash}, strings.NewReader("secret"), &stdout, &stderr)
+	if code != 0 || stdout.String() != "Password matches\n" {
+		t.Errorf("Unexpected result: %d %s %s", code, stdout.String(), stderr.String())
+	}
+	stderr.Reset()
+	code = verifyCommand([]string{"-hash", hash}, strings.NewReader("wrong\n"), &stdout, &stderr)
+	if code != 1 || stderr.String() != "Password does not match\n" {
+		t.Errorf("Unexpected result: %d %s", code, stderr.String())
+	}
+}
+
+func TestHashCommandWithEmptyPassword(t *testing.T) {
+	var stdout, stderr strings.Builder
+	code := hashCommand(nil, strings.NewReader("\n"), &stdout, &stderr)
+	if code != 1 || stderr.String() != "empty password\n" {
+		t.Errorf("Unexpected result: %d %s", code, stderr.String())
+	}
+}
+
+func TestCredentialsCommand(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "credentials")
+	run := func(stdin string, args ...string) (int, string, string) {
+		var stdout, stderr strings.Builder
+		args = append([]string{"-file", file, "-cost", "4"}, args...)
+		code := credentialsCommand(args, strings.NewReader(stdin), &stdout, &stderr)
+		return code, stdout.String(), stderr.String()
+	}
+	for _, test := range []struct {
+		stdin  string
+		args   []string
+		code   int
+		output string
+	}{
+		{"secret\n", []string{"add", "alice"}, 0, ""},
+		{"secret\n", []string{"add", "bob"}, 0, ""},
+		{"secret\n", []string{"add", "alice"}, 1, "User already exists: alice\n"},
+		{"rotated\n", []string{"rotate", "alice"}, 0, ""},
+		{"secret\n", []string{"rotate", "carol"}, 1, "Unknown user: carol\n"},
+		{"", []string{"remove", "bob"}, 0, ""},
+		{"", []string{"remove", "bob"}, 1, "Unknown user: bob\n"},
+		{"secret\n", []string{"add", "a:b"}, 1, "invalid username: \"a:b\"\n"},
+		{"", []string{"list"}, 0, "alice\n"},
+		{"", []string{"purge", "alice"}, 1, "Invalid action: purge\n"},
+	} {
+		code, stdout, stderr := run(test.stdin, test.args...)
+		output := stdout + stderr
+		if code != test.code || output != test.output {
+			t.Errorf("Unexpected result for %v: %d %q. Expected: %d %q",
+				test.args, code, output, test.code, test.output)
+		}
+	}
+	if code, _, _ := run("", "list", "alice"); code != 2 {
+		t.Errorf("Unexpected exit code: %d. Expected: 2", code)
+	}
+	var stdout, stderr strings.Builder
+	code := verifyCommand([]string{"-file", file, "-u", "alice"}, strings.NewReader("rotated\n"), &stdout, &stderr)
+	if code != 0 {
+		t.Errorf("Unexpected result: %d %s", code, stderr.String())
+	}
+}
+
+func TestConfigureWithCredentialsFile(t *testing.T) {
+	resetHelper()
+	*credFile = filepath.Join(t.TempDir(), "credentials")
+	hash, _ := auth.Hash([]byte("secret"), 4)
+	auth.Credentials{"alice": hash}.Save(*credFile)
+	if err := configure(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	srv, err := server()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !srv.AuthRequired || srv.AuthMechs["CRAM-MD5"] {
+		t.Errorf("Unexpected auth config: %t %v", srv.AuthRequired, srv.AuthMechs)
+	}
+	origin := net.TCPAddr{IP: []byte{127, 0, 0, 1}}
+	if success, _ := srv.AuthHandler(&origin, "PLAIN", []byte("alice"), []byte("secret"), nil); !success {
+		t.Error("Unexpected authentication failure")
+	}
+	// Rotated passwords apply after reload:
+	hash, _ = auth.Hash([]byte("rotated"), 4)
+	auth.Credentials{"alice": hash}.Save(*credFile)
+	if err := reload(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if success, _ := srv.AuthHandler(&origin, "PLAIN", []byte("alice"), []byte("secret"), nil); success {
+		t.Error("Unexpected authentication success with previous password")
+	}
+	if success, _ := srv.AuthHandler(&origin, "PLAIN", []byte("alice"), []byte("rotated"), nil); !success {
+		t.Error("Unexpected authentication failure")
+	}
+}
+
+func TestConfigureWithInvalidCredentialsFile(t *testing.T) {
+	resetHelper()
+	*credFile = filepath.Join(t.TempDir(), "credentials")
+	os.WriteFile(*credFile, []byte("alice:secret\n"), 0600)
+	err := configure()
+	if err == nil || !strings.HasPrefix(err.Error(), "Credentials file: line 1: ") {
+		t.Errorf("Unexpected error: %v. Expected: Credentials file: line 1: ...", err)
+	}
+}
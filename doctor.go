@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/doctor"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mhale/smtpd"
+)
+
+// doctorTimeout limits the duration of the AWS checks.
+const doctorTimeout = 30 * time.Second
+
+// loadAWSConfig, newSTSClient and newSESClient create the AWS configuration
+// and clients of the doctor subcommand, which are replaced in tests.
+var loadAWSConfig = func(ctx context.Context) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx)
+}
+
+var newSTSClient = func(cfg aws.Config) doctor.STSClient {
+	return sts.NewFromConfig(cfg)
+}
+
+var newSESClient = func(cfg aws.Config) doctor.SESClient {
+	return sesv2.NewFromConfig(cfg)
+}
+
+// doctorCommand checks the configuration given by the relay options, the TLS
+// material and the AWS setup and prints a pass/fail report.
+// It returns the exit code, which is 1 if any check failed.
+func doctorCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flag.CommandLine.SetOutput(stderr)
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return 2
+	}
+	var report doctor.Report
+	report.Add("configuration", "relay API "+*relayAPI, validateConfig())
+	switch {
+	case *certFile != "" && *keyFile != "":
+		srv := &smtpd.Server{}
+		detail, err := "", configureTLS(srv)
+		if err == nil {
+			detail, err = doctor.Certificate(srv.TLSConfig.Certificates[0], time.Now())
+		}
+		report.Add("tls", detail, err)
+	case *certFile != "" || *keyFile != "":
+		report.Add("tls", "", errors.New("both cert and key file are required"))
+	case *startTLS || *onlyTLS:
+		report.Add("tls", "", errors.New("TLS required without cert and key file"))
+	default:
+		report.Skip("tls", "no cert and key file configured")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	cfg, err := loadAWSConfig(ctx)
+	if report.Add("aws config", "", err) {
+		report.CheckAWS(ctx, doctor.AWS{
+			Config:           cfg,
+			STS:              newSTSClient(cfg),
+			SES:              newSESClient(cfg),
+			ConfigurationSet: *setName,
+			IdentityARNs:     identityARNs(),
+		})
+	}
+	if shutdownTracing != nil {
+		shutdownTracing(context.Background())
+	}
+	if err := report.Write(stdout); err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	if report.Failed() {
+		return 1
+	}
+	return 0
+}
+
+// identityARNs returns the unique identity ARNs used by the SES relay API.
+func identityARNs() []string {
+	if *relayAPI != "ses" {
+		return nil
+	}
+	var arns []string
+	seen := make(map[string]bool)
+	for _, identityArn := range []string{*sourceArn, *fromArn, *returnPathArn} {
+		if identityArn != "" && !seen[identityArn] {
+			seen[identityArn] = true
+			arns = append(arns, identityArn)
+		}
+	}
+	return arns
+}
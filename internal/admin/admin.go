@@ -0,0 +1,67 @@
+/*
+Package admin provides the HTTP server of the admin API, which requires bearer
+token authentication and responds with JSON.
+*/
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Server routes authenticated admin API requests to the registered handlers.
+type Server struct {
+	mux   *http.ServeMux
+	token atomic.Value
+}
+
+// New creates a Server accepting requests with the given bearer token.
+func New(token string) *Server {
+	s := &Server{mux: http.NewServeMux()}
+	s.SetToken(token)
+	return s
+}
+
+// SetToken replaces the bearer token, e.g. when it is rotated.
+func (s *Server) SetToken(token string) {
+	s.token.Store(token)
+}
+
+// Handle registers the handler for the given ServeMux pattern.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers the handler function for the given ServeMux pattern.
+func (s *Server) HandleFunc(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// ServeHTTP responds with 401 Unauthorized to requests without valid bearer
+// token in the Authorization header and passes others to the handlers.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	expected := s.token.Load().(string)
+	if !found || expected == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="aws-smtp-relay"`)
+		WriteError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// WriteJSON writes the value as JSON response with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// WriteError writes a JSON error response like {"error":"message"}.
+func WriteError(w http.ResponseWriter, status int, message string) {
+	WriteJSON(w, status, map[string]string{"error": message})
+}
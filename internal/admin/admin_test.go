@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	s := New("secret")
+	s.Handle("/test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	}))
+	for authorization, expected := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", "/test", nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		s.ServeHTTP(recorder, request)
+		if recorder.Code != expected {
+			t.Errorf("Unexpected status for %q: %d. Expected: %d", authorization, recorder.Code, expected)
+		}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("Unexpected Content-Type: %s. Expected: %s", contentType, "application/json")
+		}
+	}
+}
+
+func TestServerWithoutToken(t *testing.T) {
+	s := New("")
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/test", nil)
+	request.Header.Set("Authorization", "Bearer ")
+	s.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Unexpected status: %d. Expected: %d", recorder.Code, http.StatusUnauthorized)
+	}
+	expected := "{\"error\":\"unauthorized\"}\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("Unexpected body: %q. Expected: %q", recorder.Body, expected)
+	}
+}
+
+func TestServerWithRotatedToken(t *testing.T) {
+	s := New("old")
+	s.Handle("/test", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	}))
+	s.SetToken("new")
+	for authorization, expected := range map[string]int{
+		"Bearer old": http.StatusUnauthorized,
+		"Bearer new": http.StatusOK,
+	} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", "/test", nil)
+		request.Header.Set("Authorization", authorization)
+		s.ServeHTTP(recorder, request)
+		if recorder.Code != expected {
+			t.Errorf("Unexpected status for %q: %d. Expected: %d", authorization, recorder.Code, expected)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"flag"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces secret configuration values.
+const Redacted = "***"
+
+// NewConfigHandler returns the admin API handler listing the effective values
+// of the flags by name:
+//
+//	GET /config
+//
+// Non-empty values of the given secret flags are replaced with Redacted and
+// passwords of URL values with xxxxx.
+func NewConfigHandler(flags *flag.FlagSet, secrets ...string) http.Handler {
+	secret := make(map[string]bool)
+	for _, name := range secrets {
+		secret[name] = true
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /config", func(w http.ResponseWriter, r *http.Request) {
+		config := make(map[string]string)
+		flags.VisitAll(func(f *flag.Flag) {
+			config[f.Name] = redact(f.Value.String(), secret[f.Name])
+		})
+		WriteJSON(w, http.StatusOK, config)
+	})
+	return mux
+}
+
+func redact(value string, secret bool) string {
+	if value == "" {
+		return value
+	}
+	if secret {
+		return Redacted
+	}
+	if strings.Contains(value, "://") {
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			return u.Redacted()
+		}
+	}
+	return value
+}
@@ -0,0 +1,169 @@
+/*
+Package attachment provides a content policy, which rejects or strips
+attachments of raw email data by type, filename extension, size and count.
+*/
+package attachment
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"path"
+	"strings"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+)
+
+// maxDepth is the maximum nesting depth of inspected MIME parts.
+const maxDepth = 32
+
+// Attachment is a MIME part with a filename or attachment disposition.
+type Attachment struct {
+	Filename string
+	// ContentType is the lowercase media type, e.g. application/pdf.
+	ContentType string
+	// Size is the decoded size in bytes.
+	Size int
+	// start and end are the offsets of the raw part, including its header.
+	start int
+	end   int
+	// attached is false for inline parts without filename, e.g. the body.
+	attached bool
+}
+
+// Parse returns the attachments found in the MIME structure of the raw data.
+// Parts of attached messages (message/rfc822) are included.
+func Parse(data []byte) []Attachment {
+	var attachments []Attachment
+	for _, part := range parts(data) {
+		if part.attached {
+			attachments = append(attachments, part)
+		}
+	}
+	return attachments
+}
+
+// parts returns all leaf parts of the raw data, i.e. the attachments and the
+// inline parts without filename.
+func parts(data []byte) []Attachment {
+	var parts []Attachment
+	walk(data, 0, len(data), 0, &parts)
+	return parts
+}
+
+func walk(data []byte, start int, end int, depth int, attachments *[]Attachment) {
+	fields, rest := header.Split(data[start:end])
+	values := make(map[string]string)
+	for _, field := range fields {
+		name := strings.ToLower(field.Name)
+		if _, ok := values[name]; !ok {
+			values[name] = field.Value()
+		}
+	}
+	// The body starts after the empty line following the header:
+	bodyStart := end - len(rest)
+	if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+		bodyStart += i + 1
+	} else {
+		bodyStart = end
+	}
+	mediaType := "text/plain"
+	var params map[string]string
+	if contentType := values["content-type"]; contentType != "" {
+		mediaType, params, _ = mime.ParseMediaType(contentType)
+		mediaType = strings.ToLower(mediaType)
+	}
+	if depth < maxDepth {
+		if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+			walkMultipart(data, bodyStart, end, params["boundary"], depth, attachments)
+			return
+		}
+		if mediaType == "message/rfc822" {
+			walk(data, bodyStart, end, depth+1, attachments)
+			return
+		}
+	}
+	disposition, dispositionParams, _ := mime.ParseMediaType(values["content-disposition"])
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+	*attachments = append(*attachments, Attachment{
+		Filename:    filename,
+		ContentType: mediaType,
+		Size:        decodedSize(values["content-transfer-encoding"], data[bodyStart:end]),
+		start:       start,
+		end:         end,
+		attached:    strings.EqualFold(disposition, "attachment") || filename != "",
+	})
+}
+
+// walkMultipart walks the parts between the boundary delimiter lines.
+// The line break preceding a delimiter line belongs to the delimiter.
+func walkMultipart(
+	data []byte,
+	start int,
+	end int,
+	boundary string,
+	depth int,
+	attachments *[]Attachment,
+) {
+	delimiter := "--" + boundary
+	partStart := -1
+	for offset := start; offset < end; {
+		lineEnd := end
+		if i := bytes.IndexByte(data[offset:end], '\n'); i >= 0 {
+			lineEnd = offset + i + 1
+		}
+		line := string(bytes.TrimRight(data[offset:lineEnd], " \t\r\n"))
+		if line == delimiter || line == delimiter+"--" {
+			if partStart >= 0 {
+				partEnd := offset
+				if partEnd > partStart && data[partEnd-1] == '\n' {
+					partEnd--
+					if partEnd > partStart && data[partEnd-1] == '\r' {
+						partEnd--
+					}
+				}
+				walk(data, partStart, partEnd, depth+1, attachments)
+			}
+			partStart = lineEnd
+			if line == delimiter+"--" {
+				return
+			}
+		}
+		offset = lineEnd
+	}
+	if partStart >= 0 && partStart < end {
+		walk(data, partStart, end, depth+1, attachments)
+	}
+}
+
+// decodedSize returns the size of the body decoded with the given transfer
+// encoding.
+func decodedSize(encoding string, body []byte) int {
+	switch strings.ToLower(encoding) {
+	case "base64":
+		encoded := bytes.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+				return -1
+			}
+			return r
+		}, body)
+		return base64.StdEncoding.DecodedLen(len(encoded)) - bytes.Count(encoded, []byte("="))
+	case "quoted-printable":
+		n, _ := io.Copy(io.Discard, quotedprintable.NewReader(bytes.NewReader(body)))
+		return int(n)
+	}
+	return len(body)
+}
+
+// Extension returns the lowercase filename extension without dot.
+func (a Attachment) Extension() string {
+	return strings.ToLower(strings.TrimPrefix(path.Ext(a.Filename), "."))
+}
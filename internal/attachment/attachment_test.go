@@ -0,0 +1,83 @@
+package attachment
+
+import (
+	"reflect"
+	"testing"
+)
+
+var sampleData = []byte("From: alice@example.org\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"Preamble\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Hello\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"report.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"SGVsbG8g\r\n" +
+	"V29ybGQ=\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Disposition: attachment;\r\n" +
+	" filename=\"=?UTF-8?Q?r=C3=A9sum=C3=A9.EXE?=\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"MZ=3D\r\n" +
+	"--outer\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"From: bob@example.org\r\n" +
+	"Content-Type: text/x-sh\r\n" +
+	"Content-Disposition: inline; filename=run.sh\r\n" +
+	"\r\n" +
+	"#!/bin/sh\r\n" +
+	"--outer--\r\n" +
+	"Epilogue\r\n")
+
+func TestParse(t *testing.T) {
+	attachments := Parse(sampleData)
+	var filenames []string
+	for _, a := range attachments {
+		filenames = append(filenames, a.Filename+" "+a.ContentType+" "+a.Extension())
+	}
+	expected := []string{
+		"report.pdf application/pdf pdf",
+		"résumé.EXE application/octet-stream exe",
+		"run.sh text/x-sh sh",
+	}
+	if !reflect.DeepEqual(filenames, expected) {
+		t.Fatalf("Unexpected attachments: %q. Expected: %q", filenames, expected)
+	}
+	sizes := []int{attachments[0].Size, attachments[1].Size, attachments[2].Size}
+	if !reflect.DeepEqual(sizes, []int{11, 3, 9}) {
+		t.Errorf("Unexpected sizes: %v. Expected: %v", sizes, []int{11, 3, 9})
+	}
+	if raw := string(sampleData[attachments[1].start:attachments[1].end]); raw !=
+		"Content-Type: application/octet-stream\r\n"+
+			"Content-Disposition: attachment;\r\n"+
+			" filename=\"=?UTF-8?Q?r=C3=A9sum=C3=A9.EXE?=\"\r\n"+
+			"Content-Transfer-Encoding: quoted-printable\r\n"+
+			"\r\n"+
+			"MZ=3D" {
+		t.Errorf("Unexpected raw part: %q", raw)
+	}
+}
+
+func TestParseWithoutAttachments(t *testing.T) {
+	for _, data := range []string{
+		"From: alice@example.org\r\n\r\nTEST",
+		"From: alice@example.org\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\n\r\nTEST\r\n",
+		"TEST",
+	} {
+		if attachments := Parse([]byte(data)); len(attachments) != 0 {
+			t.Errorf("Unexpected attachments for %q: %v", data, attachments)
+		}
+	}
+}
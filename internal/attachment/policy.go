@@ -0,0 +1,254 @@
+package attachment
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/message"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/route"
+)
+
+// Actions applied to emails with attachments violating the policy.
+const (
+	ActionReject = "reject"
+	ActionStrip  = "strip"
+)
+
+// Rule holds the attachment restrictions for emails matching its routing
+// condition.
+type Rule struct {
+	route.Condition
+	// Action is either ActionReject or ActionStrip.
+	Action string
+	// DeniedTypes are lowercase media type patterns, e.g. application/x-*.
+	DeniedTypes []string
+	// DeniedExtensions are lowercase filename extensions without dot.
+	DeniedExtensions []string
+	// MaxSize is the maximum decoded size of each attachment (0: unlimited).
+	MaxSize int
+	// MaxCount is the maximum number of attachments (0: unlimited).
+	MaxCount int
+}
+
+// Policy holds the default rule, followed by the routing rules, of which the
+// first matching one applies instead of the default rule.
+type Policy []Rule
+
+// Result describes the outcome of a policy check.
+type Result struct {
+	// Attachments is the number of attachments found.
+	Attachments int
+	// Action is the action applied to violating attachments, if any.
+	Action string
+	// Violations describe the violating attachments, e.g.
+	// `"setup.exe": denied extension exe`.
+	Violations []string
+}
+
+// violation is an attachment violating the policy for the given reason.
+type violation struct {
+	Attachment
+	reason string
+}
+
+// ParsePolicy reads a policy with one setting per line:
+//
+//	action reject|strip
+//	deny-types <media type patterns>
+//	deny-extensions <extensions>
+//	max-size <bytes>
+//	max-count <number>
+//
+// Settings following a line like [from /regexp/ to /regexp/] apply to emails
+// with a matching envelope sender and recipient, while preceding settings
+// define the default rule, which is inherited by the routing rules.
+// Lists are separated by commas or whitespace.
+// Empty lines and lines starting with # are ignored.
+func ParsePolicy(r io.Reader) (Policy, error) {
+	policy := Policy{{Action: ActionReject}}
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var err error
+		if route.IsSection(line) {
+			rule := policy[0]
+			rule.Condition, err = route.ParseSection(line)
+			policy = append(policy, rule)
+		} else {
+			err = policy[len(policy)-1].parseSetting(line)
+		}
+		if err != nil {
+			return nil, errors.New("line " + strconv.Itoa(number) + ": " + err.Error())
+		}
+	}
+	return policy, scanner.Err()
+}
+
+// LoadPolicy reads the policy from the file at the given path.
+func LoadPolicy(filename string) (Policy, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParsePolicy(file)
+}
+
+func (r *Rule) parseSetting(line string) (err error) {
+	name, value, _ := strings.Cut(line, " ")
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return errors.New("missing value for " + name)
+	}
+	list := strings.FieldsFunc(strings.ToLower(value), func(c rune) bool {
+		return c == ',' || c == ' ' || c == '\t'
+	})
+	switch name {
+	case "action":
+		if value != ActionReject && value != ActionStrip {
+			return errors.New("invalid action: " + value)
+		}
+		r.Action = value
+	case "deny-types":
+		for _, pattern := range list {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return errors.New("invalid type pattern: " + pattern)
+			}
+		}
+		r.DeniedTypes = list
+	case "deny-extensions":
+		for i, extension := range list {
+			list[i] = strings.TrimPrefix(extension, ".")
+		}
+		r.DeniedExtensions = list
+	case "max-size":
+		r.MaxSize, err = parseLimit(value)
+	case "max-count":
+		r.MaxCount, err = parseLimit(value)
+	default:
+		return errors.New("invalid setting: " + name)
+	}
+	return err
+}
+
+func parseLimit(value string) (int, error) {
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0, errors.New("invalid limit: " + value)
+	}
+	return limit, nil
+}
+
+// Rule returns the rule applying to the given envelope.
+func (p Policy) Rule(from string, to []string) Rule {
+	for _, rule := range p[1:] {
+		if rule.Match(from, to) {
+			return rule
+		}
+	}
+	return p[0]
+}
+
+// Apply checks the attachments of the raw data against the rule for the given
+// envelope.
+// Violating attachments are either replaced with a text part noting their
+// removal or cause the email to be rejected with a message.RejectError, which
+// also applies if the whole message is a violating attachment.
+// A nil Policy returns the unmodified data.
+func (p Policy) Apply(from string, to []string, data []byte) ([]byte, Result, error) {
+	var result Result
+	if len(p) == 0 {
+		return data, result, nil
+	}
+	rule := p.Rule(from, to)
+	var violating []violation
+	action := rule.Action
+	for _, attachment := range parts(data) {
+		// Inline parts are only checked by type, e.g. nameless executables:
+		reason := rule.checkType(attachment)
+		if attachment.attached {
+			reason = rule.check(attachment, result.Attachments)
+			result.Attachments++
+		}
+		if reason == "" {
+			continue
+		}
+		result.Violations = append(result.Violations,
+			strconv.QuoteToASCII(attachment.Filename)+": "+reason)
+		violating = append(violating, violation{attachment, reason})
+		if attachment.start == 0 {
+			action = ActionReject
+		}
+	}
+	if len(violating) == 0 {
+		return data, result, nil
+	}
+	result.Action = action
+	if action == ActionReject {
+		return data, result, &message.RejectError{
+			Status: "5.7.1",
+			Reason: "Attachment rejected by policy: " + result.Violations[0],
+		}
+	}
+	return strip(data, violating), result, nil
+}
+
+// check returns the reason why the attachment with the given index violates
+// the rule, or an empty string.
+func (r Rule) check(a Attachment, index int) string {
+	extension := a.Extension()
+	for _, denied := range r.DeniedExtensions {
+		if extension == denied {
+			return "denied extension " + extension
+		}
+	}
+	if reason := r.checkType(a); reason != "" {
+		return reason
+	}
+	if r.MaxSize > 0 && a.Size > r.MaxSize {
+		return "size " + strconv.Itoa(a.Size) + " exceeds " + strconv.Itoa(r.MaxSize) + " bytes"
+	}
+	if r.MaxCount > 0 && index >= r.MaxCount {
+		return "count exceeds " + strconv.Itoa(r.MaxCount) + " attachments"
+	}
+	return ""
+}
+
+// checkType returns the reason why the media type of the part violates the
+// rule, or an empty string.
+func (r Rule) checkType(a Attachment) string {
+	for _, pattern := range r.DeniedTypes {
+		if match, _ := path.Match(pattern, a.ContentType); match {
+			return "denied type " + a.ContentType
+		}
+	}
+	return ""
+}
+
+// strip replaces the violating attachments with text parts.
+func strip(data []byte, violating []violation) []byte {
+	lineBreak := header.LineBreak(data)
+	// Replace the parts from last to first, which keeps the offsets valid:
+	sort.Slice(violating, func(i, j int) bool {
+		return violating[i].start > violating[j].start
+	})
+	stripped := append([]byte(nil), data...)
+	for _, v := range violating {
+		replacement := "Content-Type: text/plain; charset=us-ascii" + lineBreak +
+			lineBreak +
+			"Attachment " + strconv.QuoteToASCII(v.Filename) + " removed by policy (" +
+			v.reason + ")."
+		stripped = append(stripped[:v.start], append([]byte(replacement), stripped[v.end:]...)...)
+	}
+	return stripped
+}
@@ -0,0 +1,201 @@
+package attachment
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/message"
+)
+
+const samplePolicy = `# Defaults
+deny-extensions .exe, bat cmd
+deny-types application/x-*
+max-size 1048576
+
+[from /@app\.example\.org$/]
+action strip
+deny-types text/x-sh
+max-count 1
+`
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy(strings.NewReader(samplePolicy))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(policy) != 2 {
+		t.Fatalf("Unexpected number of rules: %d. Expected: %d", len(policy), 2)
+	}
+	rule := policy.Rule("alice@app.example.org", nil)
+	if rule.Action != ActionStrip || rule.MaxSize != 1048576 || rule.MaxCount != 1 ||
+		!reflect.DeepEqual(rule.DeniedExtensions, []string{"exe", "bat", "cmd"}) ||
+		!reflect.DeepEqual(rule.DeniedTypes, []string{"text/x-sh"}) {
+		t.Errorf("Unexpected routing rule: %+v", rule)
+	}
+	rule = policy.Rule("alice@example.org", nil)
+	if rule.Action != ActionReject || rule.MaxCount != 0 ||
+		!reflect.DeepEqual(rule.DeniedTypes, []string{"application/x-*"}) {
+		t.Errorf("Unexpected default rule: %+v", rule)
+	}
+}
+
+func TestParsePolicyWithInvalidLines(t *testing.T) {
+	for _, line := range []string{
+		"action quarantine",
+		"deny-types [",
+		"max-size -1",
+		"max-count many",
+		"max-size",
+		"allow-types text/plain",
+		"[from]",
+	} {
+		_, err := ParsePolicy(strings.NewReader("# Test\n" + line))
+		if err == nil || !strings.HasPrefix(err.Error(), "line 2: ") {
+			t.Errorf("Unexpected error for %q: %v. Expected: line 2: ...", line, err)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy")
+	os.WriteFile(path, []byte(samplePolicy), 0600)
+	policy, err := LoadPolicy(path)
+	if err != nil || len(policy) != 2 {
+		t.Errorf("Unexpected policy: %v %v", policy, err)
+	}
+	_, err = LoadPolicy(path + ".missing")
+	if err == nil {
+		t.Error("Unexpected nil error for missing file")
+	}
+}
+
+func TestPolicyApplyWithReject(t *testing.T) {
+	policy, _ := ParsePolicy(strings.NewReader(samplePolicy))
+	out, result, err := policy.Apply("alice@example.org", nil, sampleData)
+	var reject *message.RejectError
+	if !errors.As(err, &reject) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `554 5.7.1 Attachment rejected by policy: "r\u00e9sum\u00e9.EXE": denied extension exe`
+	if err.Error() != expected {
+		t.Errorf("Unexpected error: %s. Expected: %s", err, expected)
+	}
+	if result.Attachments != 3 || result.Action != ActionReject || len(result.Violations) != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if !bytes.Equal(out, sampleData) {
+		t.Errorf("Unexpected data: %q", out)
+	}
+}
+
+func TestPolicyApplyWithStrip(t *testing.T) {
+	policy, _ := ParsePolicy(strings.NewReader(samplePolicy))
+	out, result, err := policy.Apply("alice@app.example.org", nil, sampleData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expectedViolations := []string{
+		`"r\u00e9sum\u00e9.EXE": denied extension exe`,
+		`"run.sh": denied type text/x-sh`,
+	}
+	if result.Action != ActionStrip || !reflect.DeepEqual(result.Violations, expectedViolations) {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	expected := strings.Replace(string(sampleData),
+		"Content-Type: application/octet-stream\r\n"+
+			"Content-Disposition: attachment;\r\n"+
+			" filename=\"=?UTF-8?Q?r=C3=A9sum=C3=A9.EXE?=\"\r\n"+
+			"Content-Transfer-Encoding: quoted-printable\r\n"+
+			"\r\n"+
+			"MZ=3D\r\n",
+		"Content-Type: text/plain; charset=us-ascii\r\n"+
+			"\r\n"+
+			"Attachment \"r\\u00e9sum\\u00e9.EXE\" removed by policy (denied extension exe).\r\n", 1)
+	expected = strings.Replace(expected,
+		"From: bob@example.org\r\n"+
+			"Content-Type: text/x-sh\r\n"+
+			"Content-Disposition: inline; filename=run.sh\r\n"+
+			"\r\n"+
+			"#!/bin/sh\r\n",
+		"Content-Type: text/plain; charset=us-ascii\r\n"+
+			"\r\n"+
+			"Attachment \"run.sh\" removed by policy (denied type text/x-sh).\r\n", 1)
+	if string(out) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", out, expected)
+	}
+	// The stripped message only contains the allowed attachment:
+	if attachments := Parse(out); len(attachments) != 1 || attachments[0].Filename != "report.pdf" {
+		t.Errorf("Unexpected attachments: %v", attachments)
+	}
+}
+
+func TestPolicyApplyWithLimits(t *testing.T) {
+	policy, _ := ParsePolicy(strings.NewReader("action strip\nmax-size 10\n"))
+	_, result, err := policy.Apply("alice@example.org", nil, sampleData)
+	expected := []string{
+		`"report.pdf": size 11 exceeds 10 bytes`,
+	}
+	if err != nil || !reflect.DeepEqual(result.Violations, expected) {
+		t.Errorf("Unexpected result: %+v %v", result, err)
+	}
+	policy, _ = ParsePolicy(strings.NewReader("action strip\nmax-count 2\n"))
+	_, result, _ = policy.Apply("alice@example.org", nil, sampleData)
+	if !reflect.DeepEqual(result.Violations, []string{`"run.sh": count exceeds 2 attachments`}) {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+}
+
+func TestPolicyApplyWithAttachedMessage(t *testing.T) {
+	// A message consisting of a single attachment cannot be stripped:
+	policy, _ := ParsePolicy(strings.NewReader("action strip\ndeny-extensions exe\n"))
+	data := []byte("From: alice@example.org\r\n" +
+		"Content-Disposition: attachment; filename=setup.exe\r\n" +
+		"\r\n" +
+		"MZ")
+	_, result, err := policy.Apply("alice@example.org", nil, data)
+	if err == nil || result.Action != ActionReject {
+		t.Errorf("Unexpected result: %+v %v", result, err)
+	}
+	var nilPolicy Policy
+	out, result, err := nilPolicy.Apply("alice@example.org", nil, data)
+	if err != nil || result.Attachments != 0 || !bytes.Equal(out, data) {
+		t.Errorf("Unexpected nil policy result: %+v %v", result, err)
+	}
+}
+
+func TestPolicyApplyWithInlinePart(t *testing.T) {
+	policy, _ := ParsePolicy(strings.NewReader(samplePolicy))
+	data := []byte("From: alice@example.org\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"TEST\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/x-msdownload\r\n" +
+		"Content-Disposition: inline\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"TVo=\r\n" +
+		"--b--\r\n")
+	_, result, err := policy.Apply("alice@example.org", nil, data)
+	expected := `554 5.7.1 Attachment rejected by policy: "": denied type application/x-msdownload`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, expected)
+	}
+	// Inline parts are not counted as attachments:
+	if result.Attachments != 0 || result.Action != ActionReject {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	// Only the type of inline parts is checked, e.g. not the size:
+	policy, _ = ParsePolicy(strings.NewReader("max-size 1\n"))
+	if _, result, err := policy.Apply("alice@example.org", nil, data); err != nil {
+		t.Errorf("Unexpected result: %+v %v", result, err)
+	}
+}
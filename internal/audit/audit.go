@@ -0,0 +1,183 @@
+/*
+Package audit provides per-message audit log entries, which combine the SMTP
+session state, message metadata and relay outcome.
+*/
+package audit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"mime"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/listener"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/logger"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/relay"
+)
+
+// Entry holds the audit information of a single received email.
+type Entry struct {
+	// SessionID identifies the SMTP session, e.g. in transcript entries.
+	SessionID string
+	IP        string
+	HELO      string
+	// Mechanism and Username are set for authenticated sessions.
+	Mechanism string
+	Username  string
+	// TLS is set for sessions using implicit TLS or STARTTLS.
+	TLS            bool
+	TLSVersion     string
+	TLSCipherSuite string
+	From           string
+	// RewrittenFrom is the envelope sender after rewriting, if it was rewritten.
+	RewrittenFrom string
+	// SuppressedTo holds the recipients removed by the suppression list.
+	SuppressedTo []string
+	// To holds the envelope recipients, which are split into allowed To and
+	// rejected DeniedTo recipients by the relay result, if any.
+	To       []string
+	DeniedTo []string
+	Size     int
+	Subject  string
+	// HeaderMessageID is the Message-ID header set by the client, MessageID the
+	// ID assigned by the relay API.
+	HeaderMessageID  string
+	MessageID        string
+	RelayAPI         string
+	ConfigurationSet string
+	Duration         time.Duration
+	// DKIMDomain is the domain of the added DKIM signature, if any.
+	DKIMDomain string
+	// Attachments is the number of attachments, AttachmentAction the action
+	// applied to the AttachmentViolations of the attachment policy, if any.
+	Attachments          int
+	AttachmentAction     string
+	AttachmentViolations []string
+	// ScanThreat is the malware found by the content scan, ScanError the error
+	// of a failed scan.
+	ScanThreat string
+	ScanError  string
+	// DLPHits holds the number of matches per matching DLP rule, DLPAction the
+	// applied action and DLPQuarantineFile the path of the quarantined email.
+	DLPHits           map[string]int
+	DLPAction         string
+	DLPQuarantineFile string
+	// TraceID is the ID of the trace of the transaction, if tracing is enabled.
+	TraceID string
+	Error   error
+}
+
+// New creates an entry for the given envelope and raw email data.
+func New(origin net.Addr, from string, data []byte) *Entry {
+	e := &Entry{From: from, Size: len(data)}
+	if tcpAddr, ok := origin.(*net.TCPAddr); ok {
+		e.IP = tcpAddr.IP.String()
+	} else if origin != nil {
+		e.IP = origin.String()
+	}
+	fields, _ := header.Split(data)
+	decoder := new(mime.WordDecoder)
+	for _, field := range fields {
+		switch {
+		case strings.EqualFold(field.Name, "Received") && e.HELO == "":
+			e.HELO = helo(field.Value())
+		case strings.EqualFold(field.Name, "Subject") && e.Subject == "":
+			e.Subject = field.Value()
+			if decoded, err := decoder.DecodeHeader(e.Subject); err == nil {
+				e.Subject = decoded
+			}
+		case strings.EqualFold(field.Name, "Message-ID") && e.HeaderMessageID == "":
+			e.HeaderMessageID = field.Value()
+		}
+	}
+	return e
+}
+
+// SetSession adds the ID, authentication and TLS state of the session.
+func (e *Entry) SetSession(info listener.SessionInfo) {
+	e.SessionID = info.ID
+	e.Mechanism = info.Mechanism
+	e.Username = info.Username
+	e.TLS = info.TLS
+	e.TLSVersion = info.TLSVersion
+	e.TLSCipherSuite = info.TLSCipherSuite
+}
+
+// SetResult adds the allowed and denied recipients, the message IDs and the
+// error of the relayed email.
+// Without recipient results, e.g. for rejected emails, To is left unchanged.
+// Recipients of failed batches count as denied if the email was sent to others,
+// as it is accepted and not retried by the client.
+func (e *Entry) SetResult(result relay.Result, err error) {
+	if e.To == nil || len(result.Recipients) > 0 {
+		e.To = []string{}
+	}
+	e.DeniedTo = []string{}
+	e.MessageID = result.MessageID()
+	for _, recipient := range result.Recipients {
+		if errors.Is(recipient.Error, relay.ErrDeniedSender) ||
+			errors.Is(recipient.Error, relay.ErrDeniedRecipients) ||
+			(recipient.Error != nil && e.MessageID != "") {
+			e.DeniedTo = append(e.DeniedTo, recipient.Address)
+		} else {
+			e.To = append(e.To, recipient.Address)
+		}
+	}
+	e.Error = err
+}
+
+// Log writes the entry with the message audit to the given logger.
+// Entries with an error are logged with level error, others with level info.
+func (e *Entry) Log(log *slog.Logger) {
+	level := slog.LevelInfo
+	if e.Error != nil {
+		level = slog.LevelError
+	}
+	log.LogAttrs(context.Background(), level, "audit",
+		slog.String("session_id", e.SessionID),
+		slog.String(logger.FieldIP, e.IP),
+		slog.String("helo", e.HELO),
+		slog.String("mechanism", e.Mechanism),
+		slog.String("username", e.Username),
+		slog.Bool("tls", e.TLS),
+		slog.String("tls_version", e.TLSVersion),
+		slog.String("tls_cipher_suite", e.TLSCipherSuite),
+		slog.String(logger.FieldFrom, e.From),
+		slog.String("rewritten_from", e.RewrittenFrom),
+		slog.Any(logger.FieldTo, e.To),
+		slog.Any(logger.FieldDeniedTo, e.DeniedTo),
+		slog.Any(logger.FieldSuppressedTo, e.SuppressedTo),
+		slog.Int("size", e.Size),
+		slog.String("subject", e.Subject),
+		slog.String("header_message_id", e.HeaderMessageID),
+		slog.String(logger.FieldMessageID, e.MessageID),
+		slog.String("dkim_domain", e.DKIMDomain),
+		slog.Int("attachments", e.Attachments),
+		slog.String("attachment_action", e.AttachmentAction),
+		slog.Any("attachment_violations", e.AttachmentViolations),
+		slog.String("scan_threat", e.ScanThreat),
+		slog.String("scan_error", e.ScanError),
+		slog.Any("dlp_hits", e.DLPHits),
+		slog.String("dlp_action", e.DLPAction),
+		slog.String("dlp_quarantine_file", e.DLPQuarantineFile),
+		slog.String("relay_api", e.RelayAPI),
+		slog.String("configuration_set", e.ConfigurationSet),
+		slog.Int64("duration_ms", e.Duration.Milliseconds()),
+		slog.String("trace_id", e.TraceID),
+		logger.Error(e.Error),
+	)
+}
+
+// helo returns the client name from the value of the Received header added by
+// the SMTP server, e.g. "from client.example.org (...) by ...".
+func helo(received string) string {
+	fields := strings.Fields(received)
+	if len(fields) < 2 || fields[0] != "from" || strings.HasPrefix(fields[1], "(") {
+		return ""
+	}
+	return fields[1]
+}
@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/listener"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/logger"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/relay"
+)
+
+const testData = "Received: from client.example.org (client [127.0.0.1])\r\n" +
+	"        by relay.example.org (AWS SMTP Relay) with SMTP\r\n" +
+	"        for <bob@example.org>; Mon, 1 Jan 2024 00:00:00 +0000 (UTC)\r\n" +
+	"Received: from other.example.org\r\n" +
+	"Subject: =?UTF-8?B?SGVsbG8gV8O2cmxk?=\r\n" +
+	"Message-ID: <1@example.org>\r\n" +
+	"\r\n" +
+	"Subject: body\r\n"
+
+func TestNew(t *testing.T) {
+	origin := net.TCPAddr{IP: []byte{127, 0, 0, 1}, Port: 2525}
+	entry := New(&origin, "alice@example.org", []byte(testData))
+	if entry.IP != "127.0.0.1" {
+		t.Errorf("Unexpected IP: %s. Expected: %s", entry.IP, "127.0.0.1")
+	}
+	if entry.HELO != "client.example.org" {
+		t.Errorf("Unexpected HELO: %s. Expected: %s", entry.HELO, "client.example.org")
+	}
+	if entry.Subject != "Hello Wörld" {
+		t.Errorf("Unexpected subject: %s. Expected: %s", entry.Subject, "Hello Wörld")
+	}
+	if entry.HeaderMessageID != "<1@example.org>" {
+		t.Errorf("Unexpected Message-ID: %s. Expected: %s", entry.HeaderMessageID, "<1@example.org>")
+	}
+	if entry.Size != len(testData) {
+		t.Errorf("Unexpected size: %d. Expected: %d", entry.Size, len(testData))
+	}
+}
+
+func TestNewWithoutHELO(t *testing.T) {
+	data := []byte("Received: from  (client [127.0.0.1])\r\n\r\nTEST")
+	entry := New(nil, "alice@example.org", data)
+	if entry.HELO != "" {
+		t.Errorf("Unexpected HELO: %s", entry.HELO)
+	}
+	if entry.IP != "" {
+		t.Errorf("Unexpected IP: %s", entry.IP)
+	}
+}
+
+func TestSetSession(t *testing.T) {
+	entry := New(nil, "alice@example.org", nil)
+	entry.SetSession(listener.SessionInfo{
+		Mechanism:      "PLAIN",
+		Username:       "alice",
+		TLS:            true,
+		TLSVersion:     "TLS 1.3",
+		TLSCipherSuite: "TLS_AES_128_GCM_SHA256",
+	})
+	if entry.Mechanism != "PLAIN" || entry.Username != "alice" {
+		t.Errorf("Unexpected auth: %s %s", entry.Mechanism, entry.Username)
+	}
+	if !entry.TLS || entry.TLSVersion != "TLS 1.3" || entry.TLSCipherSuite != "TLS_AES_128_GCM_SHA256" {
+		t.Errorf("Unexpected TLS state: %t %s %s", entry.TLS, entry.TLSVersion, entry.TLSCipherSuite)
+	}
+}
+
+func TestSetResult(t *testing.T) {
+	entry := New(nil, "alice@example.org", nil)
+	entry.SetResult(relay.Result{Recipients: []relay.RecipientResult{
+		{Address: "bob@example.org", MessageID: "id-1"},
+		{Address: "charlie@example.org", Error: relay.ErrDeniedRecipients},
+	}}, relay.ErrDeniedRecipients)
+	if len(entry.To) != 1 || entry.To[0] != "bob@example.org" {
+		t.Errorf("Unexpected recipients: %v", entry.To)
+	}
+	if len(entry.DeniedTo) != 1 || entry.DeniedTo[0] != "charlie@example.org" {
+		t.Errorf("Unexpected denied recipients: %v", entry.DeniedTo)
+	}
+	if entry.MessageID != "id-1" {
+		t.Errorf("Unexpected message ID: %s. Expected: %s", entry.MessageID, "id-1")
+	}
+	if entry.Error != relay.ErrDeniedRecipients {
+		t.Errorf("Unexpected error: %s. Expected: %s", entry.Error, relay.ErrDeniedRecipients)
+	}
+}
+
+func TestSetResultWithFailedBatch(t *testing.T) {
+	entry := New(nil, "alice@example.org", nil)
+	entry.SetResult(relay.Result{Recipients: []relay.RecipientResult{
+		{Address: "bob@example.org", MessageID: "id-1"},
+		{Address: "charlie@example.org", Error: errors.New("API failure")},
+	}}, nil)
+	if len(entry.To) != 1 || entry.To[0] != "bob@example.org" {
+		t.Errorf("Unexpected recipients: %v", entry.To)
+	}
+	if len(entry.DeniedTo) != 1 || entry.DeniedTo[0] != "charlie@example.org" {
+		t.Errorf("Unexpected denied recipients: %v", entry.DeniedTo)
+	}
+}
+
+func TestSetResultWithoutRecipients(t *testing.T) {
+	entry := New(nil, "alice@example.org", nil)
+	entry.To = []string{"bob@example.org"}
+	entry.SetResult(relay.Result{}, errors.New("554 5.7.1 Rejected"))
+	if len(entry.To) != 1 || entry.To[0] != "bob@example.org" {
+		t.Errorf("Unexpected recipients: %v", entry.To)
+	}
+	if entry.DeniedTo == nil || len(entry.DeniedTo) != 0 {
+		t.Errorf("Unexpected denied recipients: %v", entry.DeniedTo)
+	}
+}
+
+func TestLog(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	log, _ := logger.New("json", slog.LevelInfo, logger.RecipientsPlain, &stdout, &stderr)
+	entry := New(nil, "alice@example.org", nil)
+	entry.SetResult(relay.Result{Recipients: []relay.RecipientResult{
+		{Address: "bob@example.org", MessageID: "id-1"},
+	}}, nil)
+	entry.RelayAPI = "ses"
+	entry.Duration = 1500 * time.Millisecond
+	entry.Log(log)
+	if stderr.Len() != 0 {
+		t.Errorf("Unexpected stderr: %s", stderr.String())
+	}
+	var out struct {
+		Msg        string   `json:"msg"`
+		To         []string `json:"to"`
+		RelayAPI   string   `json:"relay_api"`
+		DurationMS int64    `json:"duration_ms"`
+		Error      *string  `json:"error"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		t.Fatalf("Unexpected JSON error: %s", err)
+	}
+	if out.Msg != "audit" || out.RelayAPI != "ses" || out.DurationMS != 1500 {
+		t.Errorf("Unexpected entry: %s", stdout.String())
+	}
+	if len(out.To) != 1 || out.Error != nil {
+		t.Errorf("Unexpected entry: %s", stdout.String())
+	}
+}
+
+func TestLogWithError(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	log, _ := logger.New("json", slog.LevelInfo, logger.RecipientsPlain, &stdout, &stderr)
+	entry := New(nil, "alice@example.org", nil)
+	entry.SetResult(relay.Result{}, errors.New("ERROR"))
+	entry.Log(log)
+	if stdout.Len() != 0 {
+		t.Errorf("Unexpected stdout: %s", stdout.String())
+	}
+	if stderr.Len() == 0 {
+		t.Error("Unexpected empty stderr")
+	}
+}
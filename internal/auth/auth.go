@@ -21,6 +21,8 @@ type Authentication struct {
 	hash []byte
 	pass []byte
 	err  error
+	// credentials holds the users of a credentials file.
+	credentials Credentials
 }
 
 func validMAC(fn func() hash.Hash, message, messageMAC, key []byte) bool {
@@ -47,7 +49,12 @@ func (a Authentication) Handler(
 			return false, errors.New("Invalid client IP: " + ip)
 		}
 	}
-	if a.user != "" {
+	if a.user != "" || a.credentials != nil {
+		hash, ok := a.credentials[string(username)]
+		if ok && mechanism != "CRAM-MD5" {
+			err := bcrypt.CompareHashAndPassword(hash, password)
+			return err == nil, err
+		}
 		if string(username) != a.user {
 			return false, errors.New("Invalid username: " + string(username))
 		}
@@ -88,3 +95,11 @@ func New(
 		err:  err,
 	}
 }
+
+// WithCredentials returns a copy of the Authentication, which also accepts the
+// users of the given credentials for LOGIN and PLAIN authentication.
+// Users of the credentials take precedence over the user given to New.
+func (a Authentication) WithCredentials(credentials Credentials) Authentication {
+	a.credentials = credentials
+	return a
+}
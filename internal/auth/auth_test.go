@@ -223,3 +223,30 @@ func TestHandlerWithEmptyPasswordAndCRAMMD5(t *testing.T) {
 		t.Errorf("Unexpected password authentication error.")
 	}
 }
+
+func TestHandlerWithCredentials(t *testing.T) {
+	origin := net.TCPAddr{IP: []byte{127, 0, 0, 1}}
+	credentials := Credentials{"alice": []byte(sampleHash)}
+	for _, auth := range []Authentication{
+		New(nil, "", nil, nil).WithCredentials(credentials),
+		New(nil, "username", []byte(sampleHash), nil).WithCredentials(credentials),
+	} {
+		success, err := auth.Handler(&origin, "PLAIN", []byte("alice"), []byte("password"), nil)
+		if !success || err != nil {
+			t.Errorf("Unexpected authentication failure: %v", err)
+		}
+		success, _ = auth.Handler(&origin, "PLAIN", []byte("alice"), []byte("invalid"), nil)
+		if success {
+			t.Error("Unexpected authentication success with invalid password")
+		}
+		success, err = auth.Handler(&origin, "LOGIN", []byte("bob"), []byte("password"), nil)
+		if success || err == nil || err.Error() != "Invalid username: bob" {
+			t.Errorf("Unexpected result: %t %v. Expected: Invalid username: bob", success, err)
+		}
+	}
+	auth := New(nil, "username", []byte(sampleHash), nil).WithCredentials(credentials)
+	success, err := auth.Handler(&origin, "LOGIN", []byte("username"), []byte("password"), nil)
+	if !success || err != nil {
+		t.Errorf("Unexpected authentication failure: %v", err)
+	}
+}
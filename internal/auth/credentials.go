@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultCost is the default bcrypt cost of password hashes.
+const DefaultCost = 10
+
+// Credentials maps usernames to bcrypt password hashes.
+type Credentials map[string][]byte
+
+// ParseCredentials reads credentials with one user per line in htpasswd
+// format, e.g. "alice:$2y$10$...".
+// Empty lines and lines starting with # are ignored.
+func ParseCredentials(r io.Reader) (Credentials, error) {
+	credentials := make(Credentials)
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		username, hash, _ := strings.Cut(line, ":")
+		err := ValidUsername(username)
+		if err == nil {
+			_, err = bcrypt.Cost([]byte(hash))
+		}
+		if err != nil {
+			return nil, errors.New("line " + strconv.Itoa(number) + ": " + err.Error())
+		}
+		credentials[username] = []byte(hash)
+	}
+	return credentials, scanner.Err()
+}
+
+// LoadCredentials reads the credentials from the file at the given path.
+func LoadCredentials(path string) (Credentials, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseCredentials(file)
+}
+
+// Save writes the credentials sorted by username to the file at the given
+// path, which is replaced atomically and only readable by the owner.
+func (c Credentials) Save(path string) error {
+	usernames := make([]string, 0, len(c))
+	for username := range c {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	var buffer bytes.Buffer
+	for _, username := range usernames {
+		buffer.WriteString(username + ":" + string(c[username]) + "\n")
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(buffer.Bytes())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// ValidUsername returns an error if the username is empty or contains colons
+// or whitespace, which are not supported in credentials files.
+func ValidUsername(username string) error {
+	if username == "" || strings.ContainsAny(username, ": \t\r\n") {
+		return errors.New("invalid username: " + strconv.Quote(username))
+	}
+	return nil
+}
+
+// Hash returns the bcrypt hash of the password with the given cost.
+func Hash(password []byte, cost int) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(password, cost)
+}
+
+// Verify returns nil if the password matches the bcrypt hash.
+func Verify(hash []byte, password []byte) error {
+	return bcrypt.CompareHashAndPassword(hash, password)
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCredentials(t *testing.T) {
+	credentials, err := ParseCredentials(strings.NewReader(
+		"# Users\nalice:" + sampleHash + "\n\n bob:" + sampleHash + " \n",
+	))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(credentials) != 2 || string(credentials["bob"]) != sampleHash {
+		t.Errorf("Unexpected credentials: %v", credentials)
+	}
+}
+
+func TestParseCredentialsWithInvalidLines(t *testing.T) {
+	for input, expected := range map[string]string{
+		"alice\n":                     `line 1: crypto/bcrypt: hashedSecret too short to be a bcrypted password`,
+		"\nalice:password\n":          `line 2: crypto/bcrypt: hashedSecret too short to be a bcrypted password`,
+		":" + sampleHash + "\n":       `line 1: invalid username: ""`,
+		"al ice:" + sampleHash + "\n": `line 1: invalid username: "al ice"`,
+	} {
+		_, err := ParseCredentials(strings.NewReader(input))
+		if err == nil || err.Error() != expected {
+			t.Errorf("Unexpected error for %q: %v. Expected: %s", input, err, expected)
+		}
+	}
+}
+
+func TestCredentialsSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	hash, err := Hash([]byte("secret"), 4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	credentials := Credentials{"carol": hash, "alice": []byte(sampleHash)}
+	if err := credentials.Save(path); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	data, _ := os.ReadFile(path)
+	expected := "alice:" + sampleHash + "\ncarol:" + string(hash) + "\n"
+	if string(data) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", data, expected)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Unexpected mode: %s. Expected: -rw-------", info.Mode())
+	}
+	loaded, err := LoadCredentials(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if err := Verify(loaded["carol"], []byte("secret")); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if err := Verify(loaded["alice"], []byte("secret")); err == nil {
+		t.Error("Unexpected nil error")
+	}
+}
@@ -0,0 +1,318 @@
+/*
+Package client provides an SMTP client with plain, STARTTLS and implicit TLS
+connections and PLAIN, LOGIN and CRAM-MD5 authentication, which is used to
+send test emails to the relay.
+*/
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Connection security modes.
+const (
+	SecurityNone     = "none"
+	SecurityStartTLS = "starttls"
+	SecurityTLS      = "tls"
+)
+
+// Authentication mechanisms.
+const (
+	AuthPlain   = "PLAIN"
+	AuthLogin   = "LOGIN"
+	AuthCRAMMD5 = "CRAM-MD5"
+)
+
+// redacted replaces authentication payloads in the transcript.
+const redacted = "***"
+
+// Options configures the connection to the SMTP server.
+type Options struct {
+	// Address is the host:port of the SMTP server.
+	Address string
+	// Security is one of SecurityNone (default), SecurityStartTLS or
+	// SecurityTLS.
+	Security string
+	// TLSConfig is the TLS client configuration, which defaults to verifying
+	// the certificate for the host of the address.
+	TLSConfig *tls.Config
+	// Hostname is sent with the EHLO command (default: localhost).
+	Hostname string
+	// Username enables authentication with the given mechanism (default:
+	// AuthPlain).
+	Username  string
+	Password  string
+	Mechanism string
+	// Timeout limits the duration of the whole SMTP session (0: unlimited).
+	Timeout time.Duration
+	// Transcript receives the commands and replies of the session, with
+	// authentication payloads redacted, if set.
+	Transcript io.Writer
+}
+
+// Reply is an SMTP server reply.
+type Reply struct {
+	Code int
+	// Message holds the reply lines without code, separated by newlines.
+	Message string
+}
+
+// String returns the reply lines with codes, e.g. "250 2.0.0 Ok: queued".
+func (r Reply) String() string {
+	lines := strings.Split(r.Message, "\n")
+	for i, line := range lines {
+		separator := " "
+		if i < len(lines)-1 {
+			separator = "-"
+		}
+		lines[i] = fmt.Sprintf("%03d%s%s", r.Code, separator, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ReplyError is an unexpected reply to an SMTP command.
+type ReplyError struct {
+	// Command is the SMTP command without arguments, e.g. RCPT.
+	Command string
+	Reply   Reply
+}
+
+func (e *ReplyError) Error() string {
+	return e.Command + ": " + e.Reply.String()
+}
+
+// session is a connection to an SMTP server.
+type session struct {
+	options    Options
+	conn       net.Conn
+	text       *textproto.Conn
+	extensions map[string]string
+}
+
+// Send sends the raw email data to the given recipients and returns the reply
+// to the message data, which includes the message ID assigned by the relay.
+// Unexpected replies are returned as ReplyError.
+func Send(options Options, from string, to []string, data []byte) (Reply, error) {
+	s, err := dial(options)
+	if err != nil {
+		return Reply{}, err
+	}
+	defer s.close()
+	if err := s.hello(); err != nil {
+		return Reply{}, err
+	}
+	if options.Security == SecurityStartTLS {
+		if err := s.startTLS(); err != nil {
+			return Reply{}, err
+		}
+	}
+	if options.Username != "" {
+		if err := s.auth(); err != nil {
+			return Reply{}, err
+		}
+	}
+	if _, err := s.cmd("MAIL", 2, "MAIL FROM:<%s>", from); err != nil {
+		return Reply{}, err
+	}
+	for _, address := range to {
+		if _, err := s.cmd("RCPT", 2, "RCPT TO:<%s>", address); err != nil {
+			return Reply{}, err
+		}
+	}
+	if _, err := s.cmd("DATA", 3, "DATA"); err != nil {
+		return Reply{}, err
+	}
+	w := s.text.DotWriter()
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return Reply{}, err
+	}
+	s.trace("C: <%d bytes>\n", len(data))
+	reply, err := s.read("DATA", 2)
+	if err != nil {
+		return reply, err
+	}
+	s.cmd("QUIT", 2, "QUIT")
+	return reply, nil
+}
+
+func dial(options Options) (*session, error) {
+	if options.Hostname == "" {
+		options.Hostname = "localhost"
+	}
+	if options.Mechanism == "" {
+		options.Mechanism = AuthPlain
+	}
+	if options.TLSConfig == nil {
+		host, _, _ := net.SplitHostPort(options.Address)
+		options.TLSConfig = &tls.Config{ServerName: host}
+	}
+	dialer := &net.Dialer{Timeout: options.Timeout}
+	var conn net.Conn
+	var err error
+	switch options.Security {
+	case SecurityTLS:
+		conn, err = tls.DialWithDialer(dialer, "tcp", options.Address, options.TLSConfig)
+	case "", SecurityNone, SecurityStartTLS:
+		conn, err = dialer.Dial("tcp", options.Address)
+	default:
+		return nil, errors.New("invalid security mode: " + options.Security)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if options.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(options.Timeout))
+	}
+	s := &session{options: options, conn: conn, text: textproto.NewConn(conn)}
+	if _, err := s.read("connect", 2); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *session) close() {
+	s.text.Close()
+}
+
+// hello sends EHLO and records the supported extensions, falling back to HELO
+// for servers not supporting EHLO.
+func (s *session) hello() error {
+	reply, err := s.cmd("EHLO", 2, "EHLO %s", s.options.Hostname)
+	if err != nil {
+		var replyErr *ReplyError
+		if !errors.As(err, &replyErr) || replyErr.Reply.Code/100 != 5 {
+			return err
+		}
+		_, err = s.cmd("HELO", 2, "HELO %s", s.options.Hostname)
+		s.extensions = nil
+		return err
+	}
+	s.extensions = make(map[string]string)
+	// The first line is the greeting, followed by one extension per line:
+	lines := strings.Split(reply.Message, "\n")
+	for _, line := range lines[1:] {
+		keyword, params, _ := strings.Cut(line, " ")
+		s.extensions[strings.ToUpper(keyword)] = params
+	}
+	return nil
+}
+
+func (s *session) startTLS() error {
+	if _, ok := s.extensions["STARTTLS"]; !ok {
+		return errors.New("STARTTLS not supported by server")
+	}
+	if _, err := s.cmd("STARTTLS", 2, "STARTTLS"); err != nil {
+		return err
+	}
+	conn := tls.Client(s.conn, s.options.TLSConfig)
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	s.conn = conn
+	s.text = textproto.NewConn(conn)
+	return s.hello()
+}
+
+func (s *session) auth() error {
+	mechanism := strings.ToUpper(s.options.Mechanism)
+	if mechanism != AuthPlain && mechanism != AuthLogin && mechanism != AuthCRAMMD5 {
+		return errors.New("invalid authentication mechanism: " + mechanism)
+	}
+	params, ok := s.extensions["AUTH"]
+	if !ok || !containsFold(strings.Fields(params), mechanism) {
+		return errors.New("AUTH " + mechanism + " not supported by server")
+	}
+	username, password := s.options.Username, s.options.Password
+	var err error
+	switch mechanism {
+	case AuthPlain:
+		credentials := encode("\x00" + username + "\x00" + password)
+		_, err = s.secret("AUTH", 2, "AUTH PLAIN "+credentials, "AUTH PLAIN "+redacted)
+	case AuthLogin:
+		if _, err = s.cmd("AUTH", 3, "AUTH LOGIN"); err == nil {
+			if _, err = s.secret("AUTH", 3, encode(username), redacted); err == nil {
+				_, err = s.secret("AUTH", 2, encode(password), redacted)
+			}
+		}
+	case AuthCRAMMD5:
+		var reply Reply
+		if reply, err = s.cmd("AUTH", 3, "AUTH CRAM-MD5"); err == nil {
+			var challenge []byte
+			challenge, err = base64.StdEncoding.DecodeString(reply.Message)
+			if err != nil {
+				return errors.New("invalid CRAM-MD5 challenge: " + reply.Message)
+			}
+			mac := hmac.New(md5.New, []byte(password))
+			mac.Write(challenge)
+			response := encode(username + " " + hex.EncodeToString(mac.Sum(nil)))
+			_, err = s.secret("AUTH", 2, response, redacted)
+		}
+	}
+	return err
+}
+
+// cmd sends the formatted command and reads the reply, which must have the
+// given code class, e.g. 2 for 2xx.
+func (s *session) cmd(command string, class int, format string, args ...any) (Reply, error) {
+	line := fmt.Sprintf(format, args...)
+	return s.secret(command, class, line, line)
+}
+
+// secret sends the line like cmd, but logs the given transcript line instead.
+func (s *session) secret(command string, class int, line string, transcript string) (Reply, error) {
+	s.trace("C: %s\n", transcript)
+	if err := s.text.PrintfLine("%s", line); err != nil {
+		return Reply{}, err
+	}
+	return s.read(command, class)
+}
+
+// read reads a reply, which must have the given code class.
+func (s *session) read(command string, class int) (Reply, error) {
+	code, message, err := s.text.ReadResponse(class)
+	reply := Reply{Code: code, Message: message}
+	var protocolErr textproto.ProtocolError
+	if errors.As(err, &protocolErr) {
+		return reply, errors.New(command + ": " + err.Error())
+	}
+	if code > 0 {
+		s.trace("S: %s\n", strings.ReplaceAll(reply.String(), "\n", "\nS: "))
+	}
+	var textErr *textproto.Error
+	if errors.As(err, &textErr) {
+		return reply, &ReplyError{Command: command, Reply: reply}
+	}
+	return reply, err
+}
+
+func (s *session) trace(format string, args ...any) {
+	if s.options.Transcript != nil {
+		fmt.Fprintf(s.options.Transcript, format, args...)
+	}
+}
+
+func encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/auth"
+	"github.com/mhale/smtpd"
+)
+
+func certHelper(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected key error: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unexpected certificate error: %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+type received struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// serverHelper starts an SMTP server, optionally with implicit TLS, which
+// accepts the user alice with password secret.
+func serverHelper(t *testing.T, implicitTLS bool) (string, chan received) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %s", err)
+	}
+	messages := make(chan received, 1)
+	a := auth.New(nil, "alice", nil, []byte("secret"))
+	srv := &smtpd.Server{
+		Hostname: "localhost",
+		MsgIDHandler: func(origin net.Addr, from string, to []string, data []byte) (string, error) {
+			messages <- received{from, to, data}
+			return "id-1", nil
+		},
+		HandlerRcpt: func(remoteAddr net.Addr, from string, to string) bool {
+			return !strings.HasPrefix(to, "unknown@")
+		},
+		AuthHandler: func(
+			remoteAddr net.Addr,
+			mechanism string,
+			username []byte,
+			password []byte,
+			shared []byte,
+		) (bool, error) {
+			// Errors are replied as-is, so only the outcome is returned:
+			success, _ := a.Handler(remoteAddr, mechanism, username, password, shared)
+			return success, nil
+		},
+		AuthMechs: map[string]bool{"PLAIN": true, "LOGIN": true, "CRAM-MD5": true},
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{certHelper(t)}},
+	}
+	if implicitTLS {
+		ln = tls.NewListener(ln, srv.TLSConfig)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String(), messages
+}
+
+func TestSend(t *testing.T) {
+	for _, options := range []Options{
+		{},
+		{Security: SecurityStartTLS, Username: "alice", Password: "secret"},
+		{Security: SecurityTLS, Username: "alice", Password: "secret", Mechanism: AuthLogin},
+		{Username: "alice", Password: "secret", Mechanism: "cram-md5"},
+	} {
+		address, messages := serverHelper(t, options.Security == SecurityTLS)
+		options.Address = address
+		options.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+		options.Timeout = 5 * time.Second
+		var transcript strings.Builder
+		options.Transcript = &transcript
+		reply, err := Send(options, "alice@example.org",
+			[]string{"bob@example.org", "carol@example.org"}, []byte("Subject: Test\r\n\r\n.TEST\r\n"))
+		if err != nil {
+			t.Fatalf("Unexpected error for %+v: %s", options, err)
+		}
+		expected := "250 2.0.0 Ok: queued as id-1"
+		if reply.String() != expected {
+			t.Errorf("Unexpected reply: %s. Expected: %s", reply, expected)
+		}
+		message := <-messages
+		if message.from != "alice@example.org" || len(message.to) != 2 ||
+			!strings.HasSuffix(string(message.data), "\r\n\r\n.TEST\r\n") {
+			t.Errorf("Unexpected message: %+v", message)
+		}
+		if options.Username != "" && (!strings.Contains(transcript.String(), "S: 235 ") ||
+			strings.Contains(transcript.String(), encode("secret"))) {
+			t.Errorf("Unexpected transcript: %s", transcript.String())
+		}
+	}
+}
+
+func TestSendWithRejectedRecipient(t *testing.T) {
+	address, _ := serverHelper(t, false)
+	_, err := Send(Options{Address: address}, "alice@example.org",
+		[]string{"unknown@example.org"}, []byte("TEST\r\n"))
+	var replyErr *ReplyError
+	if !errors.As(err, &replyErr) || replyErr.Command != "RCPT" || replyErr.Reply.Code != 550 {
+		t.Errorf("Unexpected error: %v. Expected: RCPT: 550 ...", err)
+	}
+}
+
+func TestSendWithInvalidCredentials(t *testing.T) {
+	address, _ := serverHelper(t, false)
+	_, err := Send(Options{Address: address, Username: "alice", Password: "wrong"},
+		"alice@example.org", []string{"bob@example.org"}, []byte("TEST\r\n"))
+	var replyErr *ReplyError
+	if !errors.As(err, &replyErr) || replyErr.Command != "AUTH" || replyErr.Reply.Code != 535 {
+		t.Errorf("Unexpected error: %v. Expected: AUTH: 535 ...", err)
+	}
+}
+
+func TestSendWithInvalidOptions(t *testing.T) {
+	address, _ := serverHelper(t, false)
+	for expected, options := range map[string]Options{
+		"invalid security mode: ssl":                {Address: address, Security: "ssl"},
+		"invalid authentication mechanism: XOAUTH2": {Address: address, Username: "alice", Mechanism: "XOAUTH2"},
+	} {
+		_, err := Send(options, "alice@example.org", []string{"bob@example.org"}, []byte("TEST\r\n"))
+		if err == nil || err.Error() != expected {
+			t.Errorf("Unexpected error: %v. Expected: %s", err, expected)
+		}
+	}
+}
+
+func TestReplyString(t *testing.T) {
+	reply := Reply{Code: 250, Message: "localhost\nSIZE 1000\nAUTH PLAIN"}
+	expected := "250-localhost\n250-SIZE 1000\n250 AUTH PLAIN"
+	if reply.String() != expected {
+		t.Errorf("Unexpected reply: %q. Expected: %q", reply.String(), expected)
+	}
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lineLength is the length of base64 encoded attachment lines.
+const lineLength = 76
+
+// Message is a text email with optional attachments.
+type Message struct {
+	// From and To are addresses with optional display names, e.g.
+	// "Alice <alice@example.org>".
+	From        string
+	To          []string
+	Subject     string
+	Text        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a Message.
+type Attachment struct {
+	Filename string
+	// ContentType defaults to the type of the filename extension or
+	// application/octet-stream.
+	ContentType string
+	Data        []byte
+}
+
+// LoadAttachment reads the file at the given path as Attachment.
+func LoadAttachment(path string) (Attachment, error) {
+	data, err := os.ReadFile(path)
+	return Attachment{Filename: filepath.Base(path), Data: data}, err
+}
+
+// Bytes returns the raw email data with CRLF line breaks, a quoted-printable
+// UTF-8 text part and base64 encoded attachments.
+// Non-ASCII display names and subjects are encoded as RFC 2047 encoded-words.
+func (m *Message) Bytes() ([]byte, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, err
+	}
+	to := make([]string, len(m.To))
+	for i, address := range m.To {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		to[i] = parsed.String()
+	}
+	var buffer bytes.Buffer
+	header := func(name string, value string) {
+		buffer.WriteString(name + ": " + value + "\r\n")
+	}
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("From", from.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Message-ID", messageID(from.Address))
+	header("MIME-Version", "1.0")
+	if len(m.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buffer.WriteString("\r\n")
+		writeText(&buffer, m.Text)
+		return buffer.Bytes(), nil
+	}
+	writer := multipart.NewWriter(&buffer)
+	header("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{
+		"boundary": writer.Boundary(),
+	}))
+	buffer.WriteString("\r\n")
+	part, _ := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	writeText(part, m.Text)
+	for _, attachment := range m.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		params := map[string]string{"filename": attachment.Filename}
+		part, _ := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", params)},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > lineLength {
+			part.Write([]byte(encoded[:lineLength] + "\r\n"))
+			encoded = encoded[lineLength:]
+		}
+		part.Write([]byte(encoded))
+	}
+	writer.Close()
+	return buffer.Bytes(), nil
+}
+
+// writeText writes the text quoted-printable encoded with CRLF line breaks.
+func writeText(w io.Writer, text string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	writer := quotedprintable.NewWriter(w)
+	writer.Write([]byte(text))
+	writer.Close()
+}
+
+// messageID returns a random Message-ID with the domain of the address.
+func messageID(address string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + address[strings.LastIndexByte(address, '@')+1:] + ">"
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMessageBytes(t *testing.T) {
+	m := &Message{
+		From:    "Alice <alice@example.org>",
+		To:      []string{"bob@example.org", "Zoë <zoe@example.org>"},
+		Subject: "Grüße",
+		Text:    "Hello\nWorld",
+	}
+	data, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for name, expected := range map[string]string{
+		"From":         `"Alice" <alice@example.org>`,
+		"To":           "<bob@example.org>, =?utf-8?q?Zo=C3=AB?= <zoe@example.org>",
+		"Subject":      "=?utf-8?q?Gr=C3=BC=C3=9Fe?=",
+		"Content-Type": "text/plain; charset=utf-8",
+	} {
+		if value := msg.Header.Get(name); value != expected {
+			t.Errorf("Unexpected %s: %s. Expected: %s", name, value, expected)
+		}
+	}
+	if !strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.org>") || msg.Header.Get("Date") == "" {
+		t.Errorf("Unexpected header: %v", msg.Header)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	if string(body) != "Hello\r\nWorld" {
+		t.Errorf("Unexpected body: %q. Expected: %q", body, "Hello\r\nWorld")
+	}
+}
+
+func TestMessageBytesWithAttachments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.pdf")
+	os.WriteFile(path, bytes.Repeat([]byte("%PDF"), 100), 0600)
+	attachment, err := LoadAttachment(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	m := &Message{
+		From:        "alice@example.org",
+		To:          []string{"bob@example.org"},
+		Subject:     "Report",
+		Text:        "See attachments.",
+		Attachments: []Attachment{attachment, {Filename: "data.bin", Data: []byte{0, 1, 2}}},
+	}
+	data, err := m.Bytes()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	msg, _ := mail.ReadMessage(bytes.NewReader(data))
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("Unexpected media type: %s. Expected: multipart/mixed", mediaType)
+	}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	expected := []struct {
+		contentType string
+		filename    string
+		size        int
+	}{
+		{"text/plain; charset=utf-8", "", 16},
+		{"application/pdf", "report.pdf", 400},
+		{"application/octet-stream", "data.bin", 3},
+	}
+	for _, e := range expected {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		var r io.Reader = part
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			r = base64.NewDecoder(base64.StdEncoding, part)
+		}
+		content, _ := io.ReadAll(r)
+		if part.Header.Get("Content-Type") != e.contentType || part.FileName() != e.filename ||
+			len(content) != e.size {
+			t.Errorf("Unexpected part: %v %d bytes. Expected: %+v", part.Header, len(content), e)
+		}
+	}
+	if _, err := reader.NextPart(); err != io.EOF {
+		t.Errorf("Unexpected error: %v. Expected: EOF", err)
+	}
+}
+
+func TestMessageBytesWithInvalidAddress(t *testing.T) {
+	m := &Message{From: "alice@example.org", To: []string{"bob"}}
+	if _, err := m.Bytes(); err == nil {
+		t.Error("Unexpected nil error")
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Package dkim provides DKIM signing of raw email data with per-domain keys.
+*/
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// DefaultHeaders are the signed header fields, as recommended by RFC 6376,
+// section 5.4.1.
+var DefaultHeaders = []string{
+	"From",
+	"Reply-To",
+	"Subject",
+	"Date",
+	"To",
+	"Cc",
+	"In-Reply-To",
+	"References",
+	"Message-ID",
+	"MIME-Version",
+	"Content-Type",
+	"Content-Transfer-Encoding",
+	"List-Unsubscribe",
+	"List-Unsubscribe-Post",
+}
+
+// Key is the private key of a selector of a signing domain.
+type Key struct {
+	Domain   string
+	Selector string
+	Signer   crypto.Signer
+}
+
+// ParseKey parses a PEM encoded RSA or Ed25519 private key in PKCS #1 or
+// PKCS #8 format.
+func ParseKey(domain string, selector string, data []byte) (Key, error) {
+	key := Key{Domain: strings.ToLower(domain), Selector: selector}
+	if key.Domain == "" || key.Selector == "" {
+		return key, errors.New("missing domain or selector")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return key, errors.New("no PEM encoded private key found")
+	}
+	if block.Type == "RSA PRIVATE KEY" {
+		signer, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		key.Signer = signer
+		return key, err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return key, err
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return key, errors.New("unsupported private key type")
+	}
+	key.Signer = signer
+	return key, nil
+}
+
+// LoadKeys loads the keys of comma-separated domain:selector:path entries,
+// e.g. "example.org:mail:/etc/dkim/example.org.pem".
+func LoadKeys(s string) ([]Key, error) {
+	var keys []Key
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, errors.New("expected domain:selector:path: " + entry)
+		}
+		data, err := os.ReadFile(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParseKey(parts[0], parts[1], data)
+		if err != nil {
+			return nil, errors.New(parts[2] + ": " + err.Error())
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ParseCanonicalization parses a header/body canonicalization pair, e.g.
+// relaxed/simple.
+// As defined by RFC 6376, a single algorithm applies to the header only and
+// the body canonicalization defaults to simple.
+func ParseCanonicalization(s string) (headerCan, bodyCan dkim.Canonicalization, err error) {
+	h, b, found := strings.Cut(s, "/")
+	if !found {
+		b = string(dkim.CanonicalizationSimple)
+	}
+	for _, c := range []string{h, b} {
+		switch dkim.Canonicalization(c) {
+		case dkim.CanonicalizationSimple, dkim.CanonicalizationRelaxed:
+		default:
+			return "", "", errors.New("invalid canonicalization: " + s)
+		}
+	}
+	return dkim.Canonicalization(h), dkim.Canonicalization(b), nil
+}
+
+// Signer signs emails with the key of the domain of their From address.
+type Signer struct {
+	keys      map[string]Key
+	headerCan dkim.Canonicalization
+	bodyCan   dkim.Canonicalization
+	headers   []string
+}
+
+// New creates a Signer for the given keys, header/body canonicalization and
+// signed header fields, which must include From.
+func New(keys []Key, canonicalization string, headers []string) (*Signer, error) {
+	headerCan, bodyCan, err := ParseCanonicalization(canonicalization)
+	if err != nil {
+		return nil, err
+	}
+	hasFrom := false
+	for _, name := range headers {
+		hasFrom = hasFrom || strings.EqualFold(name, "From")
+	}
+	if !hasFrom {
+		return nil, errors.New("signed headers must include From")
+	}
+	s := &Signer{
+		keys:      make(map[string]Key),
+		headerCan: headerCan,
+		bodyCan:   bodyCan,
+		headers:   headers,
+	}
+	for _, key := range keys {
+		s.keys[key.Domain] = key
+	}
+	return s, nil
+}
+
+// Sign returns the raw data with a prepended DKIM-Signature header and the
+// signing domain, which is the domain of the From header or the given envelope
+// sender if there is none.
+// Emails from domains without key and a nil Signer return the unmodified data
+// and an empty domain.
+func (s *Signer) Sign(from string, data []byte) ([]byte, string, error) {
+	if s == nil {
+		return data, "", nil
+	}
+	if values := header.Values(data, "From"); len(values) > 0 {
+		if addresses, err := mail.ParseAddressList(values[0]); err == nil {
+			from = addresses[0].Address
+		}
+	}
+	domain := strings.ToLower(from[strings.LastIndexByte(from, '@')+1:])
+	key, ok := s.keys[domain]
+	if !ok {
+		return data, "", nil
+	}
+	options := &dkim.SignOptions{
+		Domain:                 key.Domain,
+		Selector:               key.Selector,
+		Signer:                 key.Signer,
+		HeaderCanonicalization: s.headerCan,
+		BodyCanonicalization:   s.bodyCan,
+		HeaderKeys:             s.presentHeaders(data),
+	}
+	var signed bytes.Buffer
+	if err := dkim.Sign(&signed, bytes.NewReader(data), options); err != nil {
+		return data, "", errors.New("DKIM signing failed: " + err.Error())
+	}
+	return signed.Bytes(), key.Domain, nil
+}
+
+// presentHeaders returns the signed header fields present in the data, plus
+// From, which is always signed.
+// Missing fields are not listed, as fields added in transit, e.g. Date and
+// Message-ID by SES, would invalidate the signature otherwise, while fields
+// listed more often than present are kept to oversign them.
+func (s *Signer) presentHeaders(data []byte) []string {
+	fields, _ := header.Split(data)
+	present := map[string]bool{"from": true}
+	for _, field := range fields {
+		present[strings.ToLower(field.Name)] = true
+	}
+	var headers []string
+	for _, name := range s.headers {
+		if present[strings.ToLower(name)] {
+			headers = append(headers, name)
+		}
+	}
+	return headers
+}
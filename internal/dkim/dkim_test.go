@@ -0,0 +1,202 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+var sampleData = []byte("From: =?UTF-8?Q?Caf=C3=A9?= <alice@example.org>\r\n" +
+	"To: bob@example.com\r\n" +
+	"Subject: Test\r\n" +
+	"Received: from localhost\r\n" +
+	"\r\n" +
+	"TEST  \r\n" +
+	"\r\n")
+
+// testKey creates a key for the given domain and the TXT record of its public
+// key.
+func testKey(t *testing.T, domain string, ed bool) (Key, string) {
+	var key Key
+	var err error
+	var record string
+	if ed {
+		public, private, _ := ed25519.GenerateKey(rand.Reader)
+		der, _ := x509.MarshalPKCS8PrivateKey(private)
+		key, err = ParseKey(domain, "ed", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		record = "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(public)
+	} else {
+		private, _ := rsa.GenerateKey(rand.Reader, 2048)
+		der := x509.MarshalPKCS1PrivateKey(private)
+		key, err = ParseKey(domain, "mail", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: der}))
+		public, _ := x509.MarshalPKIXPublicKey(&private.PublicKey)
+		record = "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(public)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	return key, record
+}
+
+// verify verifies the signatures of the given data against the TXT records.
+func verify(t *testing.T, data []byte, records map[string]string) []*dkim.Verification {
+	verifications, err := dkim.VerifyWithOptions(bytes.NewReader(data), &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			if record, ok := records[domain]; ok {
+				return []string{record}, nil
+			}
+			return nil, errors.New("no TXT record for " + domain)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected verify error: %s", err)
+	}
+	return verifications
+}
+
+func TestSign(t *testing.T) {
+	for _, test := range []struct {
+		ed               bool
+		canonicalization string
+	}{
+		{false, "relaxed/relaxed"},
+		{false, "relaxed/simple"},
+		{false, "simple"},
+		{true, "relaxed"},
+	} {
+		key, record := testKey(t, "Example.org", test.ed)
+		s, err := New([]Key{key}, test.canonicalization, DefaultHeaders)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		signed, domain, err := s.Sign("bounce@other.example", sampleData)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if domain != "example.org" {
+			t.Errorf("Unexpected domain: %s. Expected: %s", domain, "example.org")
+		}
+		if !bytes.HasSuffix(signed, sampleData) || !bytes.HasPrefix(signed, []byte("DKIM-Signature: ")) {
+			t.Errorf("Unexpected signed data: %q", signed)
+		}
+		// Relaxed canonicalization tolerates whitespace changes in transit:
+		if test.canonicalization == "relaxed/relaxed" {
+			signed = bytes.Replace(signed, []byte("Subject: Test"), []byte("Subject:  Test"), 1)
+		}
+		verifications := verify(t, signed, map[string]string{key.Selector + "._domainkey.example.org": record})
+		if len(verifications) != 1 {
+			t.Fatalf("Unexpected number of verifications: %d. Expected: %d", len(verifications), 1)
+		}
+		if v := verifications[0]; v.Err != nil || v.Domain != "example.org" {
+			t.Errorf("Unexpected verification with %s: %s %v", test.canonicalization, v.Domain, v.Err)
+		}
+		if h := verifications[0].HeaderKeys; strings.Contains(strings.Join(h, ":"), "Received") {
+			t.Errorf("Unexpected signed headers: %v", h)
+		}
+	}
+}
+
+func TestSignWithModifiedBody(t *testing.T) {
+	key, record := testKey(t, "example.org", false)
+	s, _ := New([]Key{key}, "relaxed/simple", DefaultHeaders)
+	signed, _, _ := s.Sign("", sampleData)
+	signed = bytes.Replace(signed, []byte("TEST  "), []byte("TEST "), 1)
+	verifications := verify(t, signed, map[string]string{"mail._domainkey.example.org": record})
+	if len(verifications) != 1 || verifications[0].Err == nil {
+		t.Error("Unexpected successful verification of modified body")
+	}
+}
+
+func TestSignWithAddedHeaders(t *testing.T) {
+	key, record := testKey(t, "example.org", false)
+	s, _ := New([]Key{key}, "relaxed/relaxed", append(DefaultHeaders, "Subject"))
+	signed, _, err := s.Sign("", sampleData)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	// SES adds Date and Message-ID headers if missing:
+	signed = append([]byte("Date: Sun, 18 Oct 2026 12:00:00 +0000\r\n"+
+		"Message-ID: <id@email.amazonses.com>\r\n"), signed...)
+	verifications := verify(t, signed, map[string]string{"mail._domainkey.example.org": record})
+	if len(verifications) != 1 {
+		t.Fatalf("Unexpected number of verifications: %d. Expected: %d", len(verifications), 1)
+	}
+	if v := verifications[0]; v.Err != nil {
+		t.Errorf("Unexpected verification error: %s", v.Err)
+	}
+	h := strings.Join(verifications[0].HeaderKeys, ":")
+	if expected := "From:Subject:To:Subject"; h != expected {
+		t.Errorf("Unexpected signed headers: %s. Expected: %s", h, expected)
+	}
+}
+
+func TestSignWithoutKey(t *testing.T) {
+	key, _ := testKey(t, "example.net", true)
+	s, _ := New([]Key{key}, "relaxed/relaxed", DefaultHeaders)
+	signed, domain, err := s.Sign("alice@example.net", sampleData)
+	if err != nil || domain != "" || !bytes.Equal(signed, sampleData) {
+		t.Errorf("Unexpected signature: %s %v %q", domain, err, signed)
+	}
+	// Without From header, the envelope sender domain is used:
+	signed, domain, _ = s.Sign("alice@example.net", []byte("Subject: Test\r\n\r\nTEST"))
+	if domain != "example.net" || !bytes.HasPrefix(signed, []byte("DKIM-Signature: ")) {
+		t.Errorf("Unexpected signature: %s %q", domain, signed)
+	}
+	var nilSigner *Signer
+	signed, domain, err = nilSigner.Sign("alice@example.org", sampleData)
+	if err != nil || domain != "" || !bytes.Equal(signed, sampleData) {
+		t.Errorf("Unexpected nil signer signature: %s %v %q", domain, err, signed)
+	}
+}
+
+func TestNewWithInvalidOptions(t *testing.T) {
+	for _, canonicalization := range []string{"", "loose", "relaxed/loose", "relaxed/simple/simple"} {
+		_, err := New(nil, canonicalization, DefaultHeaders)
+		if err == nil {
+			t.Errorf("Unexpected nil error for canonicalization: %s", canonicalization)
+		}
+	}
+	_, err := New(nil, "relaxed", []string{"Subject"})
+	if err == nil {
+		t.Error("Unexpected nil error for headers without From")
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	dir := t.TempDir()
+	private, _ := rsa.GenerateKey(rand.Reader, 1024)
+	der, _ := x509.MarshalPKCS8PrivateKey(private)
+	path := filepath.Join(dir, "example.org.pem")
+	os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	keys, err := LoadKeys("example.org:mail:" + path + ", example.com:s1:" + path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(keys) != 2 || keys[1].Domain != "example.com" || keys[1].Selector != "s1" {
+		t.Errorf("Unexpected keys: %+v", keys)
+	}
+	invalid := filepath.Join(dir, "invalid.pem")
+	os.WriteFile(invalid, []byte("invalid"), 0600)
+	for _, s := range []string{
+		"example.org:" + path,
+		"example.org:mail:" + path + ".missing",
+		"example.org:mail:" + invalid,
+		":mail:" + path,
+	} {
+		_, err := LoadKeys(s)
+		if err == nil {
+			t.Errorf("Unexpected nil error for keys: %s", s)
+		}
+	}
+}
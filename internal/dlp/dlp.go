@@ -0,0 +1,274 @@
+/*
+Package dlp provides data loss prevention rules, which detect sensitive content
+like credit card numbers or access keys in the decoded text of raw email data.
+*/
+package dlp
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/message"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/route"
+)
+
+// Actions applied to emails matching a rule, in ascending precedence.
+const (
+	ActionTag        = "tag"
+	ActionQuarantine = "quarantine"
+	ActionReject     = "reject"
+)
+
+// precedence orders the actions if an email matches multiple rules.
+var precedence = map[string]int{
+	ActionTag:        1,
+	ActionQuarantine: 2,
+	ActionReject:     3,
+}
+
+// cardNumberRegExp matches credit card number candidates of 13 to 19 digits,
+// optionally grouped by spaces or dashes.
+var cardNumberRegExp = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+// headerNameRegExp matches valid header field names (RFC 5322, section 2.2).
+var headerNameRegExp = regexp.MustCompile(`^[!-9;-~]+$`)
+
+// Rule detects sensitive content by regular expression.
+type Rule struct {
+	Name string
+	// Action is one of ActionTag, ActionQuarantine or ActionReject.
+	Action  string
+	Pattern *regexp.Regexp
+	// Luhn limits the matches to numbers with a valid Luhn checksum.
+	Luhn bool
+}
+
+// Rules is a list of rules, which are all evaluated.
+type Rules []Rule
+
+// ParseRules reads rules with one rule per line:
+//
+//	<name> <action> regex /regexp/
+//	<name> <action> luhn
+//	<name> <action> keywords <comma-separated keywords>
+//
+// The action is one of tag, quarantine or reject.
+// The luhn detector matches credit card numbers with valid checksum, while
+// keywords are matched case-insensitively as whole words.
+// Empty lines and lines starting with # are ignored.
+func ParseRules(r io.Reader) (Rules, error) {
+	var rules Rules
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, errors.New("line " + strconv.Itoa(number) + ": " + err.Error())
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// LoadRules reads the rules from the file at the given path.
+func LoadRules(path string) (Rules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseRules(file)
+}
+
+func parseRule(line string) (rule Rule, err error) {
+	fields := strings.SplitN(line, " ", 4)
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if len(fields) < 3 {
+		return rule, errors.New("expected name, action and detector")
+	}
+	rule.Name, rule.Action = fields[0], fields[1]
+	if precedence[rule.Action] == 0 {
+		return rule, errors.New("invalid action: " + rule.Action)
+	}
+	argument := ""
+	if len(fields) == 4 {
+		argument = fields[3]
+	}
+	switch fields[2] {
+	case "regex":
+		rule.Pattern, err = route.ParsePattern(argument)
+	case "luhn":
+		if argument != "" {
+			return rule, errors.New("unexpected luhn argument: " + argument)
+		}
+		rule.Pattern, rule.Luhn = cardNumberRegExp, true
+	case "keywords":
+		var keywords []string
+		for _, keyword := range strings.Split(argument, ",") {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				keywords = append(keywords, regexp.QuoteMeta(keyword))
+			}
+		}
+		if len(keywords) == 0 {
+			return rule, errors.New("missing keywords")
+		}
+		rule.Pattern = regexp.MustCompile(`(?i)\b(?:` + strings.Join(keywords, "|") + `)\b`)
+	default:
+		err = errors.New("invalid detector: " + fields[2])
+	}
+	return rule, err
+}
+
+// Count returns the number of matches in the text.
+func (r Rule) Count(text string) int {
+	count := 0
+	for _, match := range r.Pattern.FindAllString(text, -1) {
+		if !r.Luhn || luhn(match) {
+			count++
+		}
+	}
+	return count
+}
+
+// luhn reports if the digits of the string have a valid Luhn checksum.
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		digit := int(s[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// Policy applies the rules to emails.
+type Policy struct {
+	rules         Rules
+	quarantineDir string
+	tagHeader     string
+}
+
+// Result describes the outcome of the rule evaluation.
+type Result struct {
+	// Hits holds the number of matches per matching rule.
+	Hits map[string]int
+	// Action is the action with the highest precedence of all matching rules.
+	Action string
+	// QuarantineFile is the path of the quarantined email, if any.
+	QuarantineFile string
+}
+
+// New creates a Policy for the given rules, the directory of quarantined
+// emails, which is required by quarantine rules, and the header listing the
+// matching rules of tagged emails.
+func New(rules Rules, quarantineDir string, tagHeader string) (*Policy, error) {
+	for _, rule := range rules {
+		if rule.Action == ActionQuarantine && quarantineDir == "" {
+			return nil, errors.New("missing quarantine directory for rule " + rule.Name)
+		}
+	}
+	if !headerNameRegExp.MatchString(tagHeader) {
+		return nil, errors.New("invalid tag header: " + tagHeader)
+	}
+	return &Policy{rules: rules, quarantineDir: quarantineDir, tagHeader: tagHeader}, nil
+}
+
+// Apply evaluates the rules against the decoded header fields and text parts
+// of the raw data and applies the action with the highest precedence:
+// Rejected emails return a message.RejectError, quarantined emails are written
+// to the quarantine directory and must not be relayed and tagged emails are
+// returned with the tag header listing the names of all matching rules.
+// A nil Policy returns the unmodified data.
+func (p *Policy) Apply(data []byte) ([]byte, Result, error) {
+	var result Result
+	if p == nil {
+		return data, result, nil
+	}
+	texts := Text(data)
+	var matched []string
+	rejectedBy := ""
+	for _, rule := range p.rules {
+		count := 0
+		for _, text := range texts {
+			count += rule.Count(text)
+		}
+		if count == 0 {
+			continue
+		}
+		if result.Hits == nil {
+			result.Hits = make(map[string]int)
+		}
+		if result.Hits[rule.Name] == 0 {
+			matched = append(matched, rule.Name)
+		}
+		result.Hits[rule.Name] += count
+		if precedence[rule.Action] > precedence[result.Action] {
+			result.Action = rule.Action
+			rejectedBy = rule.Name
+		}
+	}
+	switch result.Action {
+	case ActionReject:
+		return data, result, &message.RejectError{
+			Status: "5.7.1",
+			Reason: "Message rejected by content rule " + rejectedBy,
+		}
+	case ActionQuarantine:
+		var err error
+		result.QuarantineFile, err = p.quarantine(data)
+		if err != nil {
+			return data, result, errors.New("DLP quarantine failed: " + err.Error())
+		}
+	case ActionTag:
+		fields, rest := header.Split(data)
+		fields = append(fields, header.Field{
+			Name: p.tagHeader,
+			Raw: []byte(p.tagHeader + ": " + strings.Join(matched, ", ") +
+				header.LineBreak(data)),
+		})
+		data = header.Join(fields, rest)
+	}
+	return data, result, nil
+}
+
+// quarantine writes the data to a new file in the quarantine directory and
+// returns its path.
+func (p *Policy) quarantine(data []byte) (string, error) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	name := strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + hex.EncodeToString(b) + ".eml"
+	path := filepath.Join(p.quarantineDir, name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return path, err
+}
@@ -0,0 +1,84 @@
+package dlp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// maxDepth is the maximum nesting depth of inspected MIME parts.
+const maxDepth = 32
+
+// Text returns the decoded header fields and text parts of the raw email,
+// including those of attached messages.
+// Data which cannot be parsed as message is returned as-is.
+func Text(data []byte) []string {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return []string{string(data)}
+	}
+	var texts []string
+	collect(textproto.MIMEHeader(msg.Header), msg.Body, 0, &texts)
+	return texts
+}
+
+func collect(h textproto.MIMEHeader, body io.Reader, depth int, texts *[]string) {
+	decoder := new(mime.WordDecoder)
+	for name, values := range h {
+		for _, value := range values {
+			if decoded, err := decoder.DecodeHeader(value); err == nil {
+				value = decoded
+			}
+			*texts = append(*texts, name+": "+value)
+		}
+	}
+	mediaType := "text/plain"
+	var params map[string]string
+	if contentType := h.Get("Content-Type"); contentType != "" {
+		mediaType, params, _ = mime.ParseMediaType(contentType)
+		mediaType = strings.ToLower(mediaType)
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		if params["boundary"] == "" || depth >= maxDepth {
+			return
+		}
+		// The parts are decoded from quoted-printable by the reader:
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				return
+			}
+			collect(part.Header, part, depth+1, texts)
+		}
+	case mediaType == "message/rfc822":
+		if depth >= maxDepth {
+			return
+		}
+		msg, err := mail.ReadMessage(decode(h.Get("Content-Transfer-Encoding"), body))
+		if err == nil {
+			collect(textproto.MIMEHeader(msg.Header), msg.Body, depth+1, texts)
+		}
+	case strings.HasPrefix(mediaType, "text/"):
+		text, _ := io.ReadAll(decode(h.Get("Content-Transfer-Encoding"), body))
+		*texts = append(*texts, string(text))
+	}
+}
+
+// decode returns a reader decoding the body with the given transfer encoding.
+func decode(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
@@ -0,0 +1,67 @@
+package dlp
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	data := "From: alice@example.org\r\n" +
+		"Subject: =?UTF-8?Q?Gr=C3=BC=C3=9Fe?=\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Card: 4111 =\r\n" +
+		"1111 1111 1111\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/html\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"PHA+SGVsbG88L3A+\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"SGVsbG8=\r\n" +
+		"--outer\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"Subject: Attached\r\n" +
+		"\r\n" +
+		"Attached text\r\n" +
+		"--outer--\r\n"
+	texts := Text([]byte(data))
+	sort.Strings(texts)
+	expected := []string{
+		"<p>Hello</p>",
+		"Attached text",
+		"Card: 4111 1111 1111 1111",
+		"Content-Transfer-Encoding: base64",
+		"Content-Transfer-Encoding: base64",
+		"Content-Type: application/octet-stream",
+		"Content-Type: message/rfc822",
+		"Content-Type: multipart/mixed; boundary=outer",
+		"Content-Type: text/html",
+		"Content-Type: text/plain; charset=utf-8",
+		"From: alice@example.org",
+		"Subject: Attached",
+		"Subject: Grüße",
+	}
+	for i := range texts {
+		texts[i] = strings.TrimRight(texts[i], "\r\n")
+	}
+	if strings.Join(texts, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected texts: %q. Expected: %q", texts, expected)
+	}
+}
+
+func TestTextWithInvalidMessage(t *testing.T) {
+	texts := Text([]byte("invalid header\r\n"))
+	if len(texts) != 1 || texts[0] != "invalid header\r\n" {
+		t.Errorf("Unexpected texts: %q", texts)
+	}
+}
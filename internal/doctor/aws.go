@@ -0,0 +1,223 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	sesv2types "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+)
+
+// STSClient is the subset of the STS API used to check the AWS credentials.
+type STSClient interface {
+	GetCallerIdentity(context.Context, *sts.GetCallerIdentityInput, ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// SESClient is the subset of the SESv2 API used to check the sending account,
+// configuration set and identities.
+type SESClient interface {
+	GetAccount(context.Context, *sesv2.GetAccountInput, ...func(*sesv2.Options)) (*sesv2.GetAccountOutput, error)
+	GetConfigurationSet(context.Context, *sesv2.GetConfigurationSetInput, ...func(*sesv2.Options)) (*sesv2.GetConfigurationSetOutput, error)
+	GetEmailIdentity(context.Context, *sesv2.GetEmailIdentityInput, ...func(*sesv2.Options)) (*sesv2.GetEmailIdentityOutput, error)
+}
+
+// AWS configures the checks of the AWS setup.
+type AWS struct {
+	Config aws.Config
+	STS    STSClient
+	SES    SESClient
+	// ConfigurationSet is checked to exist and have sending enabled, if set.
+	ConfigurationSet string
+	// IdentityARNs are checked to be verified for sending, if owned by the
+	// account of the credentials.
+	IdentityARNs []string
+}
+
+// CheckAWS adds the results of the AWS checks to the report.
+// The region and credentials are resolved locally, while the API checks are
+// skipped if the APIs are not reachable.
+func (r *Report) CheckAWS(ctx context.Context, a AWS) {
+	apiChecks := []string{"aws account", "ses account"}
+	if a.ConfigurationSet != "" {
+		apiChecks = append(apiChecks, "configuration set")
+	}
+	for _, identityArn := range a.IdentityARNs {
+		apiChecks = append(apiChecks, "identity "+identityArn)
+	}
+	skip := func(checks []string, reason string) {
+		for _, name := range checks {
+			r.Skip(name, reason)
+		}
+	}
+	if !r.Add("aws region", a.Config.Region, region(a.Config)) {
+		skip(apiChecks, "missing region")
+		return
+	}
+	detail, err := resolveCredentials(ctx, a.Config)
+	if !r.Add("aws credentials", detail, err) {
+		skip(apiChecks, "missing credentials")
+		return
+	}
+	account, err := callerAccount(ctx, a.STS)
+	if reachable(err) {
+		r.Add("aws account", account, err)
+	} else {
+		r.Skip("aws account", "STS API not reachable: "+err.Error())
+	}
+	out, err := a.SES.GetAccount(ctx, &sesv2.GetAccountInput{})
+	if !reachable(err) {
+		skip(apiChecks[1:], "SES API not reachable: "+err.Error())
+		return
+	}
+	if err == nil {
+		detail, err = sendingAccount(out)
+	}
+	r.Add("ses account", detail, err)
+	if a.ConfigurationSet != "" {
+		detail, err = configurationSet(ctx, a.SES, a.ConfigurationSet)
+		r.Add("configuration set", detail, err)
+	}
+	for _, identityArn := range a.IdentityARNs {
+		name := "identity " + identityArn
+		owner, identity, err := parseIdentityARN(identityArn, a.Config.Region)
+		if err != nil {
+			r.Add(name, "", err)
+			continue
+		}
+		if account != "" && owner != account {
+			r.Skip(name, "owned by account "+owner+", sending authorization not checked")
+			continue
+		}
+		detail, err = emailIdentity(ctx, a.SES, identity)
+		r.Add(name, detail, err)
+	}
+}
+
+// reachable returns true if the API call succeeded or the API returned an
+// error response.
+func reachable(err error) bool {
+	var apiErr smithy.APIError
+	return err == nil || errors.As(err, &apiErr)
+}
+
+func region(cfg aws.Config) error {
+	if cfg.Region == "" {
+		return errors.New("missing region, e.g. AWS_REGION environment variable")
+	}
+	return nil
+}
+
+// resolveCredentials resolves the credentials and returns the masked access key ID
+// and the credentials source.
+func resolveCredentials(ctx context.Context, cfg aws.Config) (string, error) {
+	if cfg.Credentials == nil {
+		return "", errors.New("no credentials provider")
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", err
+	}
+	detail := "access key " + mask(creds.AccessKeyID)
+	if creds.Source != "" {
+		detail += " from " + creds.Source
+	}
+	if creds.CanExpire {
+		detail += ", expires " + creds.Expires.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	return detail, nil
+}
+
+// mask returns the first and last four characters of the access key ID.
+func mask(accessKeyID string) string {
+	if len(accessKeyID) <= 8 {
+		return strings.Repeat("*", len(accessKeyID))
+	}
+	return accessKeyID[:4] + strings.Repeat("*", len(accessKeyID)-8) + accessKeyID[len(accessKeyID)-4:]
+}
+
+// callerAccount returns the account ID of the credentials.
+func callerAccount(ctx context.Context, client STSClient) (string, error) {
+	out, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.Account), nil
+}
+
+// sendingAccount checks that sending is enabled for the account and returns
+// its production access status and sending quota.
+func sendingAccount(out *sesv2.GetAccountOutput) (string, error) {
+	if !out.SendingEnabled {
+		return "", errors.New("sending disabled, enforcement status " + aws.ToString(out.EnforcementStatus))
+	}
+	detail := "sending enabled, production access"
+	if !out.ProductionAccessEnabled {
+		detail = "sending enabled, sandbox (verified recipients only)"
+	}
+	if quota := out.SendQuota; quota != nil {
+		detail += fmt.Sprintf(", quota %g/s %g/24h", quota.MaxSendRate, quota.Max24HourSend)
+	}
+	return detail, nil
+}
+
+// configurationSet checks that the configuration set exists and has sending
+// enabled.
+func configurationSet(ctx context.Context, client SESClient, name string) (string, error) {
+	out, err := client.GetConfigurationSet(ctx, &sesv2.GetConfigurationSetInput{
+		ConfigurationSetName: &name,
+	})
+	var notFound *sesv2types.NotFoundException
+	if errors.As(err, &notFound) {
+		return "", errors.New(name + " not found")
+	}
+	if err != nil {
+		return "", err
+	}
+	if out.SendingOptions != nil && !out.SendingOptions.SendingEnabled {
+		return "", errors.New(name + " has sending disabled")
+	}
+	return name, nil
+}
+
+// parseIdentityARN returns the account and name of an SES identity ARN, e.g.
+// arn:aws:ses:us-east-1:123456789012:identity/example.org, which must be in
+// the given region.
+func parseIdentityARN(identityArn string, region string) (string, string, error) {
+	parsed, err := arn.Parse(identityArn)
+	if err != nil {
+		return "", "", err
+	}
+	identity, ok := strings.CutPrefix(parsed.Resource, "identity/")
+	if parsed.Service != "ses" || !ok || identity == "" {
+		return "", "", errors.New("not an SES identity ARN")
+	}
+	if parsed.Region != region {
+		return "", "", errors.New("region " + parsed.Region + " differs from the AWS region " + region)
+	}
+	return parsed.AccountID, identity, nil
+}
+
+// emailIdentity checks that the identity is verified for sending.
+func emailIdentity(ctx context.Context, client SESClient, identity string) (string, error) {
+	out, err := client.GetEmailIdentity(ctx, &sesv2.GetEmailIdentityInput{
+		EmailIdentity: &identity,
+	})
+	var notFound *sesv2types.NotFoundException
+	if errors.As(err, &notFound) {
+		return "", errors.New(identity + " not found")
+	}
+	if err != nil {
+		return "", err
+	}
+	if !out.VerifiedForSendingStatus {
+		return "", fmt.Errorf("%s not verified for sending, status %s", identity, out.VerificationStatus)
+	}
+	kind := strings.ReplaceAll(strings.ToLower(string(out.IdentityType)), "_", " ")
+	return kind + " " + identity + " verified", nil
+}
@@ -0,0 +1,103 @@
+/*
+Package doctor provides the checks of the doctor subcommand, which diagnoses
+the relay configuration, TLS material and AWS setup and reports the results.
+*/
+package doctor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Statuses of check results.
+const (
+	Pass = "PASS"
+	Fail = "FAIL"
+	Skip = "SKIP"
+)
+
+// Result is the outcome of a check.
+type Result struct {
+	Name   string
+	Status string
+	// Detail describes the checked setting, the error or the reason for
+	// skipping the check.
+	Detail string
+}
+
+// Report collects the check results in order.
+type Report struct {
+	Results []Result
+}
+
+// Add records a passed check with the given detail, or a failed check if err
+// is not nil, and returns whether the check passed.
+func (r *Report) Add(name string, detail string, err error) bool {
+	if err != nil {
+		r.Results = append(r.Results, Result{Name: name, Status: Fail, Detail: err.Error()})
+		return false
+	}
+	r.Results = append(r.Results, Result{Name: name, Status: Pass, Detail: detail})
+	return true
+}
+
+// Skip records a skipped check with the given reason.
+func (r *Report) Skip(name string, reason string) {
+	r.Results = append(r.Results, Result{Name: name, Status: Skip, Detail: reason})
+}
+
+// Failed returns true if any check failed.
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Status == Fail {
+			return true
+		}
+	}
+	return false
+}
+
+// Write writes one line per result, e.g. "PASS  tls: CN=example.org", followed
+// by a summary line.
+func (r *Report) Write(w io.Writer) error {
+	counts := make(map[string]int)
+	for _, result := range r.Results {
+		counts[result.Status]++
+		line := result.Status + "  " + result.Name
+		if result.Detail != "" {
+			line += ": " + result.Detail
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d passed, %d failed, %d skipped\n", counts[Pass], counts[Fail], counts[Skip])
+	return err
+}
+
+// Certificate checks that the leaf of the certificate chain is valid at the
+// given time and returns its subject and expiry.
+func Certificate(cert tls.Certificate, now time.Time) (string, error) {
+	if len(cert.Certificate) == 0 {
+		return "", errors.New("empty certificate chain")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return "", err
+	}
+	if now.Before(leaf.NotBefore) {
+		return "", errors.New("certificate not valid before " + leaf.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return "", errors.New("certificate expired at " + leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	detail := leaf.Subject.String()
+	if len(leaf.DNSNames) > 0 {
+		detail += " (" + strings.Join(leaf.DNSNames, ", ") + ")"
+	}
+	return detail + ", valid until " + leaf.NotAfter.UTC().Format(time.RFC3339), nil
+}
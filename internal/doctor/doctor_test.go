@@ -0,0 +1,91 @@
+package doctor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func certificate(t *testing.T, notBefore time.Time, notAfter time.Time) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "smtp.example.org"},
+		DNSNames:     []string{"smtp.example.org"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestReport(t *testing.T) {
+	var report Report
+	if !report.Add("configuration", "relay API ses", nil) {
+		t.Error("Unexpected failed check")
+	}
+	report.Skip("tls", "no certificate configured")
+	if report.Failed() {
+		t.Error("Unexpected failed report")
+	}
+	if report.Add("aws region", "", errors.New("missing region")) {
+		t.Error("Unexpected passed check")
+	}
+	if !report.Failed() {
+		t.Error("Unexpected passed report")
+	}
+	var output strings.Builder
+	if err := report.Write(&output); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "PASS  configuration: relay API ses\n" +
+		"SKIP  tls: no certificate configured\n" +
+		"FAIL  aws region: missing region\n" +
+		"1 passed, 1 failed, 1 skipped\n"
+	if output.String() != expected {
+		t.Errorf("Unexpected output: %s. Expected: %s", output.String(), expected)
+	}
+}
+
+func TestCertificate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cert := certificate(t, now.Add(-time.Hour), now.Add(time.Hour))
+	detail, err := Certificate(cert, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "CN=smtp.example.org (smtp.example.org), valid until 2026-01-01T01:00:00Z"
+	if detail != expected {
+		t.Errorf("Unexpected detail: %s. Expected: %s", detail, expected)
+	}
+	for _, test := range []struct {
+		now time.Time
+		err string
+	}{
+		{now.Add(-2 * time.Hour), "certificate not valid before 2025-12-31T23:00:00Z"},
+		{now.Add(2 * time.Hour), "certificate expired at 2026-01-01T01:00:00Z"},
+	} {
+		_, err := Certificate(cert, test.now)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Unexpected error: %v. Expected: %s", err, test.err)
+		}
+	}
+	if _, err := Certificate(tls.Certificate{}, now); err == nil {
+		t.Error("Unexpected nil error for empty certificate chain")
+	}
+}
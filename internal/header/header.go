@@ -0,0 +1,162 @@
+/*
+Package header provides functions to read and edit the header section of raw
+email data without altering the message body.
+*/
+package header
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// addressFields are the header fields containing address lists.
+var addressFields = map[string]bool{
+	"from":        true,
+	"sender":      true,
+	"reply-to":    true,
+	"to":          true,
+	"cc":          true,
+	"bcc":         true,
+	"resent-from": true,
+	"resent-to":   true,
+	"resent-cc":   true,
+	"resent-bcc":  true,
+}
+
+// ErrNonASCIIAddress is returned by Encode for address fields with non-ASCII
+// addresses, which cannot be encoded as RFC 2047 encoded-words.
+var ErrNonASCIIAddress = errors.New("non-ASCII address")
+
+// Field is a single header field as found in the raw data, including folded
+// continuation lines and the trailing line break.
+type Field struct {
+	Name string
+	Raw  []byte
+}
+
+// Value returns the unfolded field value with surrounding whitespace removed.
+func (f Field) Value() string {
+	i := bytes.IndexByte(f.Raw, ':')
+	if i < 0 {
+		return ""
+	}
+	value := strings.NewReplacer("\r\n", "", "\n", "").Replace(string(f.Raw[i+1:]))
+	return strings.TrimSpace(value)
+}
+
+// Split separates the raw data into header fields and the remaining bytes,
+// which start with the empty line separating header and body (if any).
+func Split(data []byte) (fields []Field, rest []byte) {
+	offset := 0
+	for offset < len(data) {
+		line := nextLine(data[offset:])
+		if isBlank(line) {
+			break
+		}
+		end := offset + len(line)
+		// Continuation lines start with a space or horizontal tab:
+		for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+			end += len(nextLine(data[end:]))
+		}
+		raw := data[offset:end]
+		name := ""
+		if i := bytes.IndexByte(raw, ':'); i > 0 {
+			name = string(bytes.TrimSpace(raw[:i]))
+		}
+		fields = append(fields, Field{Name: name, Raw: raw})
+		offset = end
+	}
+	return fields, data[offset:]
+}
+
+// Join concatenates the given header fields and remaining bytes.
+func Join(fields []Field, rest []byte) []byte {
+	var buffer bytes.Buffer
+	for _, field := range fields {
+		buffer.Write(field.Raw)
+	}
+	buffer.Write(rest)
+	return buffer.Bytes()
+}
+
+// Values returns the unfolded values of all fields with the given name.
+func Values(data []byte, name string) (values []string) {
+	fields, _ := Split(data)
+	for _, field := range fields {
+		if strings.EqualFold(field.Name, name) {
+			values = append(values, field.Value())
+		}
+	}
+	return values
+}
+
+// Remove deletes all fields with the given name from the raw data.
+func Remove(data []byte, name string) []byte {
+	fields, rest := Split(data)
+	kept := fields[:0:0]
+	for _, field := range fields {
+		if !strings.EqualFold(field.Name, name) {
+			kept = append(kept, field)
+		}
+	}
+	if len(kept) == len(fields) {
+		return data
+	}
+	return Join(kept, rest)
+}
+
+// Encode returns the UTF-8 value of the field with the given name encoded as
+// RFC 2047 encoded-words, which for address fields only applies to display
+// names, as encoded addresses would make the field unparseable.
+func Encode(name string, value string) (string, error) {
+	if !addressFields[strings.ToLower(name)] {
+		return mime.QEncoding.Encode("utf-8", value), nil
+	}
+	addresses, err := mail.ParseAddressList(value)
+	if err != nil {
+		return "", err
+	}
+	list := make([]string, len(addresses))
+	for i, address := range addresses {
+		if !isASCII(address.Address) {
+			return "", ErrNonASCIIAddress
+		}
+		list[i] = address.String()
+	}
+	return strings.Join(list, ", "), nil
+}
+
+// LineBreak returns the line break used by the raw data, which is CRLF unless
+// the first line ends with a bare LF.
+func LineBreak(data []byte) string {
+	line := nextLine(data)
+	if bytes.HasSuffix(line, []byte("\n")) && !bytes.HasSuffix(line, []byte("\r\n")) {
+		return "\n"
+	}
+	return "\r\n"
+}
+
+// nextLine returns the bytes up to and including the next line feed.
+func nextLine(data []byte) []byte {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[:i+1]
+	}
+	return data
+}
+
+func isBlank(line []byte) bool {
+	return len(bytes.TrimRight(line, "\r\n")) == 0
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
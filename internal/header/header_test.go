@@ -0,0 +1,105 @@
+package header
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var sampleData = []byte("Received: from localhost\r\n" +
+	"        by relay\r\n" +
+	"Subject: Test\r\n" +
+	"X-Tags: a=b,\r\n" +
+	"\tc=d\r\n" +
+	"\r\n" +
+	"Subject: body line\r\n")
+
+func TestSplit(t *testing.T) {
+	fields, rest := Split(sampleData)
+	if len(fields) != 3 {
+		t.Fatalf("Unexpected number of fields: %d. Expected: %d", len(fields), 3)
+	}
+	names := []string{fields[0].Name, fields[1].Name, fields[2].Name}
+	expectedNames := []string{"Received", "Subject", "X-Tags"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Unexpected names: %v. Expected: %v", names, expectedNames)
+	}
+	if string(rest) != "\r\nSubject: body line\r\n" {
+		t.Errorf("Unexpected rest: %q", rest)
+	}
+	if string(Join(fields, rest)) != string(sampleData) {
+		t.Errorf("Unexpected joined data: %q", Join(fields, rest))
+	}
+}
+
+func TestSplitWithoutHeader(t *testing.T) {
+	fields, rest := Split([]byte("\nTEST"))
+	if len(fields) != 0 {
+		t.Errorf("Unexpected number of fields: %d. Expected: %d", len(fields), 0)
+	}
+	if string(rest) != "\nTEST" {
+		t.Errorf("Unexpected rest: %q", rest)
+	}
+}
+
+func TestValues(t *testing.T) {
+	values := Values(sampleData, "x-tags")
+	expected := []string{"a=b,\tc=d"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Unexpected values: %q. Expected: %q", values, expected)
+	}
+	subjects := Values(sampleData, "Subject")
+	if len(subjects) != 1 || subjects[0] != "Test" {
+		t.Errorf("Unexpected subjects: %q", subjects)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	data := Remove(sampleData, "X-TAGS")
+	expected := "Received: from localhost\r\n" +
+		"        by relay\r\n" +
+		"Subject: Test\r\n" +
+		"\r\n" +
+		"Subject: body line\r\n"
+	if string(data) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", data, expected)
+	}
+	if string(Remove(sampleData, "X-Missing")) != string(sampleData) {
+		t.Error("Unexpected data modification")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"Subject", "Café", "=?utf-8?q?Caf=C3=A9?="},
+		{"Reply-To", "Jörg <j@example.com>", "=?utf-8?q?J=C3=B6rg?= <j@example.com>"},
+		{"to", "Jörg <j@example.com>, bob@example.com", "=?utf-8?q?J=C3=B6rg?= <j@example.com>, <bob@example.com>"},
+	} {
+		value, err := Encode(test.name, test.value)
+		if err != nil || value != test.expected {
+			t.Errorf("Unexpected value: %q %v. Expected: %q", value, err, test.expected)
+		}
+	}
+	if _, err := Encode("From", "Jörg <jörg@example.com>"); !errors.Is(err, ErrNonASCIIAddress) {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, ErrNonASCIIAddress)
+	}
+	if _, err := Encode("From", "Jörg"); err == nil {
+		t.Error("Unexpected nil error for invalid address")
+	}
+}
+
+func TestLineBreak(t *testing.T) {
+	for data, expected := range map[string]string{
+		"Subject: Test\r\n\r\nTEST": "\r\n",
+		"Subject: Test\n\nTEST":     "\n",
+		"":                          "\r\n",
+	} {
+		if lineBreak := LineBreak([]byte(data)); lineBreak != expected {
+			t.Errorf("Unexpected line break for %q: %q. Expected: %q", data, lineBreak, expected)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package header
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/route"
+)
+
+// fieldNameRegExp matches valid header field names (RFC 5322, section 2.2).
+var fieldNameRegExp = regexp.MustCompile(`^[!-9;-~]+$`)
+
+// Action adds, sets or removes header fields.
+type Action struct {
+	// Op is one of add, set or remove.
+	Op string
+	// Name is the field name to add, set or remove.
+	Name string
+	// NamePattern matches the names of removed fields instead of Name.
+	NamePattern *regexp.Regexp
+	// Value is the added or set field value.
+	Value string
+	// ValuePattern limits the removed fields to those with a matching value.
+	ValuePattern *regexp.Regexp
+}
+
+// Rule applies its actions to emails matching its routing condition.
+type Rule struct {
+	route.Condition
+	Actions []Action
+}
+
+// Policy is a list of rules, which are all applied in order.
+type Policy []Rule
+
+// ParsePolicy reads a policy with one action per line:
+//
+//	add <name> <value>
+//	set <name> <value>
+//	remove <name|/regexp/> [/regexp/]
+//
+// Actions following a line like [from /regexp/ to /regexp/] only apply to
+// emails with a matching envelope sender and recipient, while preceding
+// actions apply to all emails.
+// Empty lines and lines starting with # are ignored.
+func ParsePolicy(r io.Reader) (Policy, error) {
+	policy := Policy{{}}
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var err error
+		if route.IsSection(line) {
+			var rule Rule
+			rule.Condition, err = route.ParseSection(line)
+			policy = append(policy, rule)
+		} else {
+			var action Action
+			action, err = parseAction(line)
+			last := &policy[len(policy)-1]
+			last.Actions = append(last.Actions, action)
+		}
+		if err != nil {
+			return nil, errors.New("line " + strconv.Itoa(number) + ": " + err.Error())
+		}
+	}
+	return policy, scanner.Err()
+}
+
+// LoadPolicy reads the policy from the file at the given path.
+func LoadPolicy(path string) (Policy, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParsePolicy(file)
+}
+
+func parseAction(line string) (action Action, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return action, errors.New("expected action and header name")
+	}
+	action.Op = fields[0]
+	switch action.Op {
+	case "add", "set":
+		if !fieldNameRegExp.MatchString(fields[1]) {
+			return action, errors.New("invalid header name: " + fields[1])
+		}
+		action.Name = fields[1]
+		// The value is the remainder of the line after the header name:
+		rest := strings.TrimSpace(line[len(fields[0]):])
+		action.Value = strings.TrimSpace(rest[len(fields[1]):])
+		if action.Value == "" {
+			return action, errors.New("missing header value")
+		}
+		if !isASCII(action.Value) {
+			if _, err := Encode(action.Name, action.Value); err != nil {
+				return action, errors.New("invalid " + action.Name + " value: " + err.Error())
+			}
+		}
+	case "remove":
+		if len(fields) > 3 {
+			return action, errors.New("expected header name and optional value pattern")
+		}
+		if route.IsPattern(fields[1]) {
+			action.NamePattern, err = route.ParsePattern(fields[1])
+		} else if !fieldNameRegExp.MatchString(fields[1]) {
+			err = errors.New("invalid header name: " + fields[1])
+		}
+		action.Name = fields[1]
+		if err == nil && len(fields) == 3 {
+			action.ValuePattern, err = route.ParsePattern(fields[2])
+		}
+	default:
+		err = errors.New("invalid action: " + action.Op)
+	}
+	return action, err
+}
+
+// Apply returns the raw data with the actions of all matching rules applied.
+// Added and set fields are appended to the header section, values with
+// non-ASCII characters are encoded as RFC 2047 encoded-words.
+// The body remains unchanged.
+func (p Policy) Apply(from string, to []string, data []byte) []byte {
+	var fields []Field
+	var rest []byte
+	changed := false
+	for _, rule := range p {
+		if len(rule.Actions) == 0 || !rule.Match(from, to) {
+			continue
+		}
+		if !changed {
+			fields, rest = Split(data)
+			changed = true
+		}
+		for _, action := range rule.Actions {
+			fields = action.apply(fields, LineBreak(data))
+		}
+	}
+	if !changed {
+		return data
+	}
+	return Join(fields, rest)
+}
+
+func (a Action) apply(fields []Field, lineBreak string) []Field {
+	switch a.Op {
+	case "add":
+		return append(fields, a.field(lineBreak))
+	case "set":
+		kept := fields[:0:0]
+		set := false
+		for _, field := range fields {
+			if !strings.EqualFold(field.Name, a.Name) {
+				kept = append(kept, field)
+			} else if !set {
+				// The first field is replaced in place, others are removed:
+				kept = append(kept, a.field(lineBreak))
+				set = true
+			}
+		}
+		if !set {
+			kept = append(kept, a.field(lineBreak))
+		}
+		return kept
+	case "remove":
+		kept := fields[:0:0]
+		for _, field := range fields {
+			if !a.matchRemove(field) {
+				kept = append(kept, field)
+			}
+		}
+		return kept
+	}
+	return fields
+}
+
+func (a Action) matchRemove(field Field) bool {
+	if a.NamePattern != nil {
+		if !a.NamePattern.MatchString(field.Name) {
+			return false
+		}
+	} else if !strings.EqualFold(field.Name, a.Name) {
+		return false
+	}
+	return a.ValuePattern == nil || a.ValuePattern.MatchString(field.Value())
+}
+
+// field returns the added or set field, with non-ASCII values encoded, which
+// parseAction validated.
+func (a Action) field(lineBreak string) Field {
+	value := a.Value
+	if !isASCII(value) {
+		value, _ = Encode(a.Name, value)
+	}
+	return Field{
+		Name: a.Name,
+		Raw:  []byte(a.Name + ": " + value + lineBreak),
+	}
+}
@@ -0,0 +1,146 @@
+package header
+
+import (
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const samplePolicy = `# All emails
+remove X-Originating-IP
+remove Received /\b10\.\d+\.\d+\.\d+\b/
+remove /^X-Internal-/
+set Reply-To support@example.org
+add List-Unsubscribe <mailto:unsubscribe@example.org>
+
+[from /@billing\.example\.org$/ to /@example\.com$/]
+set X-Environment Facturation été
+`
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy(strings.NewReader(samplePolicy))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(policy) != 2 {
+		t.Fatalf("Unexpected number of rules: %d. Expected: %d", len(policy), 2)
+	}
+	if len(policy[0].Actions) != 5 || len(policy[1].Actions) != 1 {
+		t.Errorf("Unexpected number of actions: %d, %d", len(policy[0].Actions), len(policy[1].Actions))
+	}
+	action := policy[1].Actions[0]
+	if action.Op != "set" || action.Name != "X-Environment" || action.Value != "Facturation été" {
+		t.Errorf("Unexpected action: %+v", action)
+	}
+}
+
+func TestParsePolicyWithInvalidLines(t *testing.T) {
+	for _, line := range []string{
+		"add X-Environment",
+		"add X:Environment staging",
+		"replace X-Environment staging",
+		"remove",
+		"remove Received 10.0.0.1",
+		"remove /(/",
+		"remove Received /10/ /20/",
+		"[from]",
+		"[subject /test/]",
+		"[from @example.org]",
+		"set Reply-To Jörg",
+		"set From Jörg <jörg@example.org>",
+	} {
+		_, err := ParsePolicy(strings.NewReader("# Test\n" + line))
+		if err == nil || !strings.HasPrefix(err.Error(), "line 2: ") {
+			t.Errorf("Unexpected error for %q: %v. Expected: line 2: ...", line, err)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy")
+	os.WriteFile(path, []byte(samplePolicy), 0600)
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(policy) != 2 {
+		t.Errorf("Unexpected number of rules: %d. Expected: %d", len(policy), 2)
+	}
+	_, err = LoadPolicy(path + ".missing")
+	if err == nil {
+		t.Error("Unexpected nil error for missing file")
+	}
+}
+
+func TestPolicyApply(t *testing.T) {
+	policy, _ := ParsePolicy(strings.NewReader(samplePolicy))
+	data := []byte("Received: from client (10.1.2.3)\r\n" +
+		"\tby relay.internal\r\n" +
+		"Received: from mx.example.org (203.0.113.1)\r\n" +
+		"\tby relay.internal\r\n" +
+		"X-Originating-IP: 10.1.2.3\r\n" +
+		"Reply-To: noreply@example.org\r\n" +
+		"X-Internal-Host: app1\r\n" +
+		"Reply-To: other@example.org\r\n" +
+		"Subject: Test\r\n" +
+		"\r\n" +
+		"X-Originating-IP: body line\r\n" +
+		"\r\n")
+	out := policy.Apply("alice@billing.example.org", []string{"bob@example.com"}, data)
+	expected := "Received: from mx.example.org (203.0.113.1)\r\n" +
+		"\tby relay.internal\r\n" +
+		"Reply-To: support@example.org\r\n" +
+		"Subject: Test\r\n" +
+		"List-Unsubscribe: <mailto:unsubscribe@example.org>\r\n" +
+		"X-Environment: =?utf-8?q?Facturation_=C3=A9t=C3=A9?=\r\n" +
+		"\r\n" +
+		"X-Originating-IP: body line\r\n" +
+		"\r\n"
+	if string(out) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", out, expected)
+	}
+	// The second rule does not match other senders:
+	out = policy.Apply("alice@example.org", []string{"bob@example.com"}, []byte("Subject: Test\n\nTEST"))
+	expected = "Subject: Test\n" +
+		"Reply-To: support@example.org\n" +
+		"List-Unsubscribe: <mailto:unsubscribe@example.org>\n" +
+		"\n" +
+		"TEST"
+	if string(out) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", out, expected)
+	}
+}
+
+func TestPolicyApplyWithAddress(t *testing.T) {
+	policy, err := ParsePolicy(strings.NewReader("set Reply-To Jörg <j@example.com>\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	out := policy.Apply("alice@example.org", nil, []byte("Subject: Test\r\n\r\nTEST"))
+	expected := "Subject: Test\r\n" +
+		"Reply-To: =?utf-8?q?J=C3=B6rg?= <j@example.com>\r\n" +
+		"\r\nTEST"
+	if string(out) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", out, expected)
+	}
+	fields, _ := Split(out)
+	if _, err := mail.ParseAddress(fields[1].Value()); err != nil {
+		t.Errorf("Unexpected Reply-To parse error: %s", err)
+	}
+}
+
+func TestPolicyApplyWithoutMatch(t *testing.T) {
+	policy, _ := ParsePolicy(strings.NewReader("[to /@example\\.com$/]\nadd X-Test yes\n"))
+	data := []byte("Subject: Test\r\n\r\nTEST")
+	out := policy.Apply("alice@example.org", []string{"bob@example.org"}, data)
+	if &out[0] != &data[0] {
+		t.Errorf("Unexpected data copy: %q", out)
+	}
+	var empty Policy
+	out = empty.Apply("alice@example.org", nil, data)
+	if string(out) != string(data) {
+		t.Errorf("Unexpected data: %q", out)
+	}
+}
@@ -0,0 +1,35 @@
+package listener
+
+import (
+	"net/http"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/admin"
+)
+
+// NewHandler returns the admin API handler inspecting and controlling the
+// listener:
+//
+//	GET  /sessions  lists the sessions of open connections
+//	GET  /limits    returns the connection limits and counters
+//	POST /pause     rejects new connections with a 421 reply
+//	POST /resume    accepts new connections again
+func NewHandler(l *Listener) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, l.Sessions())
+	})
+	mux.HandleFunc("GET /limits", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, l.Stats())
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		l.SetPaused(true)
+		l.log.Warn("paused")
+		admin.WriteJSON(w, http.StatusOK, map[string]bool{"paused": true})
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		l.SetPaused(false)
+		l.log.Info("resumed")
+		admin.WriteJSON(w, http.StatusOK, map[string]bool{"paused": false})
+	})
+	return mux
+}
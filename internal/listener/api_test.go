@@ -0,0 +1,69 @@
+package listener
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func request(h http.Handler, method string, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	return recorder
+}
+
+func TestHandler(t *testing.T) {
+	l, conns := listenHelper(t, Limits{MaxConnections: 10})
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer client.Close()
+	accepted := <-conns
+	l.Session(accepted.RemoteAddr()).SetAuth("PLAIN", "alice")
+	h := NewHandler(l)
+	response := request(h, "GET", "/sessions")
+	var sessions []SessionInfo
+	json.Unmarshal(response.Body.Bytes(), &sessions)
+	if response.Code != http.StatusOK || len(sessions) != 1 || sessions[0].Username != "alice" {
+		t.Errorf("Unexpected response: %d %s", response.Code, response.Body)
+	}
+	response = request(h, "GET", "/limits")
+	var stats Stats
+	json.Unmarshal(response.Body.Bytes(), &stats)
+	if response.Code != http.StatusOK || stats.MaxConnections != 10 || stats.Active != 1 ||
+		stats.ActivePerIP["127.0.0.1"] != 1 || stats.Paused {
+		t.Errorf("Unexpected response: %d %s", response.Code, response.Body)
+	}
+	response = request(h, "POST", "/pause")
+	if response.Code != http.StatusOK || !l.Paused() {
+		t.Errorf("Unexpected response: %d %s", response.Code, response.Body)
+	}
+	rejected, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer rejected.Close()
+	if line := readLine(t, rejected); !strings.HasPrefix(line, "421 4.3.2 localhost ") {
+		t.Errorf("Unexpected reply: %s. Expected: 421 4.3.2", line)
+	}
+	if stats := l.Stats(); stats.Rejected != 1 || !stats.Paused {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	response = request(h, "POST", "/resume")
+	if response.Code != http.StatusOK || l.Paused() {
+		t.Errorf("Unexpected response: %d %s", response.Code, response.Body)
+	}
+	resumed, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer resumed.Close()
+	<-conns
+	if response := request(h, "GET", "/pause"); response.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status: %d. Expected: %d", response.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,283 @@
+/*
+Package listener provides a net.Listener enforcing connection limits and
+timeouts for SMTP sessions.
+*/
+package listener
+
+import (
+	"log/slog"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/logger"
+)
+
+// Limits configures the connection limits. Zero values disable a limit.
+type Limits struct {
+	// MaxConnections is the maximum number of concurrent connections.
+	MaxConnections int
+	// MaxConnectionsPerIP is the maximum number of concurrent connections per
+	// client IP.
+	MaxConnectionsPerIP int
+	// MaxDataDuration is the maximum time a client may spend transmitting data
+	// without receiving a reply, e.g. the message content after DATA.
+	MaxDataDuration time.Duration
+}
+
+// reasonPaused is the reason for connections rejected while paused.
+const reasonPaused = "paused"
+
+// Listener wraps a net.Listener and rejects connections exceeding the limits
+// or received while paused with a 421 reply. It also keeps track of the
+// sessions of open connections.
+type Listener struct {
+	net.Listener
+	limits   Limits
+	hostname string
+	log      *slog.Logger
+	rejected atomic.Int64
+	paused   atomic.Bool
+	mu       sync.Mutex
+	total    int
+	perIP    map[string]int
+	sessions map[string]*Session
+	// active holds the session with the latest I/O per client IP.
+	active map[string]*Session
+}
+
+// New creates a new Listener enforcing the given limits.
+// The hostname is used in the reply to rejected connections.
+func New(
+	ln net.Listener,
+	limits Limits,
+	hostname string,
+	log *slog.Logger,
+) *Listener {
+	return &Listener{
+		Listener: ln,
+		limits:   limits,
+		hostname: hostname,
+		log:      log,
+		perIP:    make(map[string]int),
+		sessions: make(map[string]*Session),
+		active:   make(map[string]*Session),
+	}
+}
+
+// Accept waits for and returns the next connection within the limits.
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := remoteIP(conn.RemoteAddr())
+		if reason := l.acquire(ip); reason != "" {
+			count := l.rejected.Add(1)
+			l.log.Warn("connection rejected",
+				logger.FieldIP, ip,
+				"reason", reason,
+				"rejected_total", count,
+			)
+			go l.reject(conn, reason)
+			continue
+		}
+		l.log.Debug("connection opened", logger.FieldIP, ip)
+		session := l.openSession(conn.RemoteAddr(), ip)
+		return &limitedConn{
+			Conn:            conn,
+			maxDataDuration: l.limits.MaxDataDuration,
+			touch:           func() { l.touch(session) },
+			release: func() {
+				l.closeSession(session)
+				l.release(ip)
+				l.log.Debug("connection closed", logger.FieldIP, ip)
+			},
+		}, nil
+	}
+}
+
+// Rejected returns the number of rejected connections.
+func (l *Listener) Rejected() int64 {
+	return l.rejected.Load()
+}
+
+// Active returns the number of open connections.
+func (l *Listener) Active() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
+
+// Stats holds the connection limits and counters.
+type Stats struct {
+	MaxConnections      int `json:"max_connections"`
+	MaxConnectionsPerIP int `json:"max_connections_per_ip"`
+	// Active is the number of open connections.
+	Active int `json:"active"`
+	// ActivePerIP is the number of open connections per client IP.
+	ActivePerIP map[string]int `json:"active_per_ip"`
+	// Rejected is the number of connections rejected since startup.
+	Rejected int64 `json:"rejected"`
+	Paused   bool  `json:"paused"`
+}
+
+// Stats returns a snapshot of the connection limits and counters.
+func (l *Listener) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := Stats{
+		MaxConnections:      l.limits.MaxConnections,
+		MaxConnectionsPerIP: l.limits.MaxConnectionsPerIP,
+		Active:              l.total,
+		ActivePerIP:         make(map[string]int, len(l.perIP)),
+		Rejected:            l.rejected.Load(),
+		Paused:              l.paused.Load(),
+	}
+	for ip, count := range l.perIP {
+		stats.ActivePerIP[ip] = count
+	}
+	return stats
+}
+
+// Sessions returns snapshots of the sessions of open connections, ordered by
+// their start time.
+func (l *Listener) Sessions() []SessionInfo {
+	l.mu.Lock()
+	list := make([]*Session, 0, len(l.sessions))
+	for _, s := range l.sessions {
+		list = append(list, s)
+	}
+	l.mu.Unlock()
+	infos := make([]SessionInfo, len(list))
+	for i, s := range list {
+		infos[i] = s.Info()
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Start.Before(infos[j].Start)
+	})
+	return infos
+}
+
+// SetPaused pauses or resumes accepting connections.
+// While paused, new connections are rejected with a 421 reply, while open
+// connections are not affected.
+func (l *Listener) SetPaused(paused bool) {
+	l.paused.Store(paused)
+}
+
+// Paused reports if the listener is paused, which is false for a nil Listener.
+func (l *Listener) Paused() bool {
+	return l != nil && l.paused.Load()
+}
+
+// acquire reserves a connection slot for the given IP and returns the reason
+// if the limits have been reached.
+func (l *Listener) acquire(ip string) string {
+	if l.paused.Load() {
+		return reasonPaused
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits.MaxConnections > 0 && l.total >= l.limits.MaxConnections {
+		return "too many connections"
+	}
+	if l.limits.MaxConnectionsPerIP > 0 && l.perIP[ip] >= l.limits.MaxConnectionsPerIP {
+		return "too many connections from this IP"
+	}
+	l.total++
+	l.perIP[ip]++
+	return ""
+}
+
+func (l *Listener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+func (l *Listener) reject(conn net.Conn, reason string) {
+	defer conn.Close()
+	reply := "421 4.7.0 " + l.hostname + " Too many connections, try again later\r\n"
+	if reason == reasonPaused {
+		reply = "421 4.3.2 " + l.hostname + " Service paused, try again later\r\n"
+	}
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	conn.Write([]byte(reply))
+}
+
+func remoteIP(addr net.Addr) string {
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// limitedConn releases its connection slot on Close and limits the duration
+// of uninterrupted client transmissions.
+//
+// The SMTP server sets a read deadline before reading each line and a write
+// deadline before each reply, which also applies to TLS connections, as they
+// delegate deadlines to the underlying connection. Consecutive read deadlines
+// without a reply in between mark a transmission phase like message data,
+// whose total duration is capped at maxDataDuration.
+type limitedConn struct {
+	net.Conn
+	maxDataDuration time.Duration
+	touch           func()
+	release         func()
+	closeOnce       sync.Once
+	mu              sync.Mutex
+	readStart       time.Time
+}
+
+func (c *limitedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 && c.touch != nil {
+		c.touch()
+	}
+	return n, err
+}
+
+func (c *limitedConn) Write(b []byte) (int, error) {
+	if c.touch != nil {
+		c.touch()
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *limitedConn) SetReadDeadline(t time.Time) error {
+	if c.maxDataDuration > 0 {
+		c.mu.Lock()
+		if c.readStart.IsZero() {
+			c.readStart = time.Now()
+		}
+		if limit := c.readStart.Add(c.maxDataDuration); t.IsZero() || t.After(limit) {
+			t = limit
+		}
+		c.mu.Unlock()
+	}
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *limitedConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readStart = time.Time{}
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *limitedConn) Close() error {
+	c.closeOnce.Do(c.release)
+	return c.Conn.Close()
+}
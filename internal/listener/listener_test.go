@@ -0,0 +1,142 @@
+package listener
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+func listenHelper(t *testing.T, limits Limits) (*Listener, chan net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %s", err)
+	}
+	l := New(ln, limits, "localhost", testLogger)
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(conns)
+				return
+			}
+			conns <- conn
+		}
+	}()
+	t.Cleanup(func() { l.Close() })
+	return l, conns
+}
+
+func readLine(t *testing.T, conn net.Conn) string {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Unexpected read error: %s", err)
+	}
+	return line
+}
+
+func TestListenerWithMaxConnectionsPerIP(t *testing.T) {
+	l, conns := listenHelper(t, Limits{MaxConnectionsPerIP: 1})
+	first, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer first.Close()
+	accepted := <-conns
+	second, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer second.Close()
+	if line := readLine(t, second); !strings.HasPrefix(line, "421 ") {
+		t.Errorf("Unexpected reply: %s. Expected: 421", line)
+	}
+	if l.Rejected() != 1 {
+		t.Errorf("Unexpected rejected count: %d. Expected: %d", l.Rejected(), 1)
+	}
+	if l.Active() != 1 {
+		t.Errorf("Unexpected active count: %d. Expected: %d", l.Active(), 1)
+	}
+	// Closing the accepted connection frees the slot for the IP:
+	accepted.Close()
+	accepted.Close()
+	if l.Active() != 0 {
+		t.Errorf("Unexpected active count: %d. Expected: %d", l.Active(), 0)
+	}
+	third, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer third.Close()
+	select {
+	case conn := <-conns:
+		conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Error("Connection was not accepted after the slot was released")
+	}
+}
+
+func TestListenerWithMaxConnections(t *testing.T) {
+	l, conns := listenHelper(t, Limits{MaxConnections: 2})
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("Unexpected dial error: %s", err)
+		}
+		defer conn.Close()
+		defer (<-conns).Close()
+	}
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer conn.Close()
+	if line := readLine(t, conn); !strings.HasPrefix(line, "421 4.7.0 localhost ") {
+		t.Errorf("Unexpected reply: %s. Expected: 421", line)
+	}
+}
+
+func TestConnWithMaxDataDuration(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := &limitedConn{
+		Conn:            server,
+		maxDataDuration: 100 * time.Millisecond,
+		release:         func() {},
+	}
+	defer c.Close()
+	go func() {
+		// Keep sending lines without waiting for a reply:
+		for {
+			if _, err := client.Write([]byte("line\r\n")); err != nil {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	start := time.Now()
+	buf := make([]byte, 16)
+	var err error
+	for err == nil && time.Since(start) < 5*time.Second {
+		c.SetReadDeadline(time.Now().Add(time.Minute))
+		_, err = c.Read(buf)
+	}
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, os.ErrDeadlineExceeded)
+	}
+	// A reply resets the transmission phase:
+	c.SetWriteDeadline(time.Now().Add(time.Minute))
+	c.SetReadDeadline(time.Now().Add(time.Minute))
+	if _, err = c.Read(buf); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
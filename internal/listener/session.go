@@ -0,0 +1,232 @@
+package listener
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Session holds the state of an accepted connection, which is not exposed to
+// the SMTP handlers.
+type Session struct {
+	id         string
+	ip         string
+	remoteAddr string
+	start      time.Time
+	ctx        context.Context
+	span       trace.Span
+	mu         sync.Mutex
+	mechanism  string
+	username   string
+	tls        *tls.ConnectionState
+	firstRcpt  time.Time
+	lastRcpt   time.Time
+}
+
+// SessionInfo is a snapshot of the Session state.
+type SessionInfo struct {
+	// ID is a random identifier of the session.
+	ID         string    `json:"id"`
+	RemoteAddr string    `json:"remote_addr"`
+	Start      time.Time `json:"start"`
+	// Mechanism and Username are set after a successful authentication.
+	Mechanism string `json:"mechanism,omitempty"`
+	Username  string `json:"username,omitempty"`
+	// TLS is set after a successful TLS handshake.
+	TLS            bool   `json:"tls"`
+	TLSVersion     string `json:"tls_version,omitempty"`
+	TLSCipherSuite string `json:"tls_cipher_suite,omitempty"`
+	TLSServerName  string `json:"tls_server_name,omitempty"`
+}
+
+// SetAuth records a successful authentication.
+func (s *Session) SetAuth(mechanism string, username string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mechanism = mechanism
+	s.username = username
+}
+
+// SetTLS records the state of a completed TLS handshake.
+func (s *Session) SetTLS(state tls.ConnectionState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tls = &state
+}
+
+// Context returns the context holding the session span.
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// AddRecipient records the time of an accepted RCPT command.
+// The first RCPT command marks the start of a transaction.
+func (s *Session) AddRecipient() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRcpt = time.Now()
+	if s.firstRcpt.IsZero() {
+		s.firstRcpt = s.lastRcpt
+	}
+}
+
+// EndTransaction returns the times of the first and last RCPT command of the
+// current transaction, which are zero if there was none, and resets them.
+// The time after the last RCPT command is spent receiving the message data.
+func (s *Session) EndTransaction() (first time.Time, last time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first, last = s.firstRcpt, s.lastRcpt
+	s.firstRcpt, s.lastRcpt = time.Time{}, time.Time{}
+	return first, last
+}
+
+// Info returns a snapshot of the session state.
+func (s *Session) Info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := SessionInfo{
+		ID:         s.id,
+		RemoteAddr: s.remoteAddr,
+		Start:      s.start,
+		Mechanism:  s.mechanism,
+		Username:   s.username,
+	}
+	if s.tls != nil {
+		info.TLS = true
+		info.TLSVersion = tls.VersionName(s.tls.Version)
+		info.TLSCipherSuite = tls.CipherSuiteName(s.tls.CipherSuite)
+		info.TLSServerName = s.tls.ServerName
+	}
+	return info
+}
+
+// Session returns the session for the given remote address of an open
+// connection, or nil if there is none.
+func (l *Listener) Session(addr net.Addr) *Session {
+	if l == nil || addr == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sessions[addr.String()]
+}
+
+// SessionByIP returns the open session for the given client IP with the latest
+// I/O, or nil if there is none.
+// It allows attributing events which only provide the client IP to a session,
+// which is ambiguous for concurrent sessions from the same IP.
+func (l *Listener) SessionByIP(ip string) *Session {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if s := l.active[ip]; s != nil {
+		return s
+	}
+	for _, s := range l.sessions {
+		if s.ip == ip {
+			return s
+		}
+	}
+	return nil
+}
+
+// TrackTLS configures the given TLS config to record the state of completed
+// handshakes in the session of the connection.
+// It applies to both implicit TLS and STARTTLS connections, as both wrap the
+// connections returned by Accept.
+func (l *Listener) TrackTLS(config *tls.Config) {
+	getConfigForClient := config.GetConfigForClient
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		base := config
+		if getConfigForClient != nil {
+			c, err := getConfigForClient(hello)
+			if err != nil {
+				return nil, err
+			}
+			if c != nil {
+				base = c
+			}
+		}
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		verifyConnection := c.VerifyConnection
+		c.VerifyConnection = func(state tls.ConnectionState) error {
+			if verifyConnection != nil {
+				if err := verifyConnection(state); err != nil {
+					return err
+				}
+			}
+			if s := l.Session(hello.Conn.RemoteAddr()); s != nil {
+				s.SetTLS(state)
+			}
+			return nil
+		}
+		return c, nil
+	}
+}
+
+func (l *Listener) openSession(addr net.Addr, ip string) *Session {
+	s := &Session{
+		id:         newSessionID(),
+		ip:         ip,
+		remoteAddr: addr.String(),
+		start:      time.Now(),
+	}
+	s.ctx, s.span = tracing.Tracer().Start(context.Background(), "smtp.session",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithTimestamp(s.start),
+		trace.WithAttributes(
+			attribute.String("smtp.session.id", s.id),
+			attribute.String("client.address", s.remoteAddr),
+		),
+	)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sessions[s.remoteAddr] = s
+	l.active[ip] = s
+	return s
+}
+
+// touch marks the session as the one with the latest I/O for its client IP.
+func (l *Listener) touch(s *Session) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active[s.ip] = s
+}
+
+func (l *Listener) closeSession(s *Session) {
+	info := s.Info()
+	s.span.SetAttributes(
+		attribute.String("smtp.auth.mechanism", info.Mechanism),
+		attribute.String("smtp.auth.username", info.Username),
+		attribute.Bool("tls", info.TLS),
+		attribute.String("tls.protocol.version", info.TLSVersion),
+		attribute.String("tls.cipher", info.TLSCipherSuite),
+	)
+	s.span.End()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sessions[s.remoteAddr] == s {
+		delete(l.sessions, s.remoteAddr)
+	}
+	if l.active[s.ip] == s {
+		delete(l.active, s.ip)
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
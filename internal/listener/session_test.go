@@ -0,0 +1,169 @@
+package listener
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func certHelper(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected key error: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Unexpected certificate error: %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestSession(t *testing.T) {
+	l, conns := listenHelper(t, Limits{})
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer client.Close()
+	accepted := <-conns
+	session := l.Session(accepted.RemoteAddr())
+	if session == nil {
+		t.Fatal("Unexpected nil session")
+	}
+	session.SetAuth("PLAIN", "alice")
+	info := session.Info()
+	if info.RemoteAddr != client.LocalAddr().String() {
+		t.Errorf("Unexpected remote address: %s. Expected: %s", info.RemoteAddr, client.LocalAddr())
+	}
+	if info.Mechanism != "PLAIN" || info.Username != "alice" {
+		t.Errorf("Unexpected auth: %s %s. Expected: PLAIN alice", info.Mechanism, info.Username)
+	}
+	if info.TLS {
+		t.Error("Unexpected TLS session")
+	}
+	accepted.Close()
+	if l.Session(accepted.RemoteAddr()) != nil {
+		t.Error("Unexpected session after close")
+	}
+}
+
+func TestSessionWithNilListener(t *testing.T) {
+	var l *Listener
+	if l.Session(&net.TCPAddr{IP: []byte{127, 0, 0, 1}}) != nil {
+		t.Error("Unexpected session for nil listener")
+	}
+}
+
+func TestTrackTLS(t *testing.T) {
+	l, conns := listenHelper(t, Limits{})
+	config := &tls.Config{Certificates: []tls.Certificate{certHelper(t)}}
+	l.TrackTLS(config)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer conn.Close()
+	accepted := <-conns
+	handshake := make(chan error, 1)
+	go func() {
+		handshake <- tls.Server(accepted, config).Handshake()
+	}()
+	client := tls.Client(conn, &tls.Config{
+		ServerName:         "localhost",
+		InsecureSkipVerify: true,
+	})
+	if err := client.Handshake(); err != nil {
+		t.Fatalf("Unexpected client handshake error: %s", err)
+	}
+	if err := <-handshake; err != nil {
+		t.Fatalf("Unexpected server handshake error: %s", err)
+	}
+	info := l.Session(accepted.RemoteAddr()).Info()
+	if !info.TLS {
+		t.Fatal("Unexpected non-TLS session")
+	}
+	state := client.ConnectionState()
+	if info.TLSVersion != tls.VersionName(state.Version) {
+		t.Errorf("Unexpected TLS version: %s. Expected: %s", info.TLSVersion, tls.VersionName(state.Version))
+	}
+	if info.TLSCipherSuite != tls.CipherSuiteName(state.CipherSuite) {
+		t.Errorf("Unexpected cipher suite: %s", info.TLSCipherSuite)
+	}
+	if info.TLSServerName != "localhost" {
+		t.Errorf("Unexpected server name: %s. Expected: %s", info.TLSServerName, "localhost")
+	}
+}
+
+func TestSessionTransaction(t *testing.T) {
+	l, conns := listenHelper(t, Limits{})
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer client.Close()
+	session := l.Session((<-conns).RemoteAddr())
+	if session.Context() == nil {
+		t.Error("Unexpected nil context")
+	}
+	if first, last := session.EndTransaction(); !first.IsZero() || !last.IsZero() {
+		t.Errorf("Unexpected transaction times: %s %s", first, last)
+	}
+	session.AddRecipient()
+	time.Sleep(time.Millisecond)
+	session.AddRecipient()
+	first, last := session.EndTransaction()
+	if first.IsZero() || !last.After(first) {
+		t.Errorf("Unexpected transaction times: %s %s", first, last)
+	}
+	if first, _ := session.EndTransaction(); !first.IsZero() {
+		t.Error("Unexpected transaction start after reset")
+	}
+}
+
+func TestSessionByIP(t *testing.T) {
+	l, conns := listenHelper(t, Limits{})
+	first, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer first.Close()
+	firstConn := <-conns
+	second, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer second.Close()
+	secondConn := <-conns
+	firstSession := l.Session(firstConn.RemoteAddr())
+	secondSession := l.Session(secondConn.RemoteAddr())
+	if firstSession.Info().ID == "" || firstSession.Info().ID == secondSession.Info().ID {
+		t.Errorf("Unexpected session IDs: %s %s", firstSession.Info().ID, secondSession.Info().ID)
+	}
+	if l.SessionByIP("127.0.0.1") != secondSession {
+		t.Error("Unexpected session: expected latest opened session")
+	}
+	// I/O marks the session as the active one for the IP:
+	firstConn.Write([]byte("220 localhost\r\n"))
+	if l.SessionByIP("127.0.0.1") != firstSession {
+		t.Error("Unexpected session: expected session with latest I/O")
+	}
+	firstConn.Close()
+	if l.SessionByIP("127.0.0.1") != secondSession {
+		t.Error("Unexpected session: expected remaining session")
+	}
+	if l.SessionByIP("192.0.2.1") != nil {
+		t.Error("Unexpected session for unknown IP")
+	}
+}
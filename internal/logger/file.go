@@ -0,0 +1,137 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is appended to the file name of rotated files.
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// File is a log file, which is rotated when it exceeds a maximum size or age.
+// Rotated files are renamed with a timestamp suffix, e.g.
+// audit.log.20240101T000000.000000000Z.
+type File struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+	opened     time.Time
+}
+
+// OpenFile opens the log file at the given path for appending.
+// Zero values for maxSize (in bytes) and maxAge disable the respective
+// rotation, a zero value for maxBackups keeps all rotated files.
+func OpenFile(
+	path string,
+	maxSize int64,
+	maxAge time.Duration,
+	maxBackups int,
+) (*File, error) {
+	f := &File{
+		path:       path,
+		maxSize:    maxSize,
+		maxAge:     maxAge,
+		maxBackups: maxBackups,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends the given bytes to the file, rotating it beforehand if the
+// write would exceed the maximum size or the file exceeds the maximum age.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && ((f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize) ||
+		(f.maxAge > 0 && time.Since(f.opened) >= f.maxAge)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	backup := f.path + "." + time.Now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.removeBackups()
+}
+
+// removeBackups deletes the oldest rotated files exceeding maxBackups.
+func (f *File) removeBackups() error {
+	if f.maxBackups <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, f.path+".")
+		if _, err := time.Parse(backupTimeFormat, suffix); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	// The timestamp suffix sorts rotated files from oldest to newest:
+	sort.Strings(backups)
+	for len(backups) > f.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
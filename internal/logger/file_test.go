@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func backupsHelper(t *testing.T, path string) []string {
+	backups, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Unexpected glob error: %s", err)
+	}
+	return backups
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenFile(path, 0, 0, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	f.Write([]byte("first\n"))
+	f.Write([]byte("second\n"))
+	f.Close()
+	data, _ := os.ReadFile(path)
+	if string(data) != "first\nsecond\n" {
+		t.Errorf("Unexpected data: %q", data)
+	}
+	if backups := backupsHelper(t, path); len(backups) != 0 {
+		t.Errorf("Unexpected backups: %v", backups)
+	}
+	if _, err := f.Write([]byte("closed\n")); err == nil {
+		t.Error("Unexpected nil error after close")
+	}
+}
+
+func TestFileWithMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenFile(path, 10, 0, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer f.Close()
+	f.Write([]byte("first\n"))
+	f.Write([]byte("second\n"))
+	data, _ := os.ReadFile(path)
+	if string(data) != "second\n" {
+		t.Errorf("Unexpected data: %q", data)
+	}
+	backups := backupsHelper(t, path)
+	if len(backups) != 1 {
+		t.Fatalf("Unexpected number of backups: %d. Expected: %d", len(backups), 1)
+	}
+	data, _ = os.ReadFile(backups[0])
+	if string(data) != "first\n" {
+		t.Errorf("Unexpected backup data: %q", data)
+	}
+}
+
+func TestFileWithMaxAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenFile(path, 0, time.Millisecond, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer f.Close()
+	f.Write([]byte("first\n"))
+	time.Sleep(5 * time.Millisecond)
+	f.Write([]byte("second\n"))
+	data, _ := os.ReadFile(path)
+	if string(data) != "second\n" {
+		t.Errorf("Unexpected data: %q", data)
+	}
+	if backups := backupsHelper(t, path); len(backups) != 1 {
+		t.Errorf("Unexpected number of backups: %d. Expected: %d", len(backups), 1)
+	}
+}
+
+func TestFileWithMaxBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	unrelated := path + ".gz"
+	os.WriteFile(unrelated, nil, 0o600)
+	f, err := OpenFile(path, 1, 0, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer f.Close()
+	for _, line := range []string{"1\n", "2\n", "3\n", "4\n"} {
+		f.Write([]byte(line))
+	}
+	backups := backupsHelper(t, path)
+	// The unrelated file is kept along with the two newest backups:
+	if len(backups) != 3 {
+		t.Fatalf("Unexpected number of files: %d. Expected: %d", len(backups), 3)
+	}
+	data, _ := os.ReadFile(backups[0])
+	if string(data) != "2\n" {
+		t.Errorf("Unexpected oldest backup data: %q. Expected: %q", data, "2\n")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("Unexpected error for unrelated file: %s", err)
+	}
+}
+
+func TestFileWithInvalidPath(t *testing.T) {
+	_, err := OpenFile(filepath.Join(t.TempDir(), "missing", "audit.log"), 0, 0, 0)
+	if err == nil {
+		t.Error("Unexpected nil error")
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Package logger provides a structured logger, which writes errors to STDERR and
+all other entries to STDOUT.
+*/
+package logger
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Common field names used across log entries.
+const (
+	FieldIP        = "ip"
+	FieldFrom      = "from"
+	FieldTo        = "to"
+	FieldDeniedTo  = "denied_to"
+	FieldMessageID = "message_id"
+	FieldError     = "error"
+	// FieldSuppressedTo holds recipients removed by the suppression list.
+	FieldSuppressedTo = "suppressed_to"
+)
+
+// Modes for logging recipient addresses.
+const (
+	// RecipientsPlain logs recipient addresses unmodified.
+	RecipientsPlain = "plain"
+	// RecipientsRedact replaces the local part of recipient addresses with ***.
+	RecipientsRedact = "redact"
+	// RecipientsHash replaces recipient addresses with the first 32 hex digits
+	// of the SHA-256 hash of the lowercase address.
+	RecipientsHash = "hash"
+)
+
+// New creates a logger for the given format (json|logfmt), minimum level and
+// recipients mode (plain|redact|hash), which applies to the to, denied_to and
+// suppressed_to fields of all entries.
+// Entries with level error are written to stderr, all others to stdout.
+func New(
+	format string,
+	level slog.Level,
+	recipients string,
+	stdout io.Writer,
+	stderr io.Writer,
+) (*slog.Logger, error) {
+	out, err := NewHandler(format, level, recipients, stdout)
+	if err != nil {
+		return nil, err
+	}
+	errOut, _ := NewHandler(format, level, recipients, stderr)
+	return slog.New(&splitHandler{out: out, err: errOut}), nil
+}
+
+// NewHandler creates a handler writing all entries to the given writer.
+// See New for the parameters.
+func NewHandler(format string, level slog.Level, recipients string, w io.Writer) (
+	slog.Handler,
+	error,
+) {
+	options := &slog.HandlerOptions{Level: level}
+	switch recipients {
+	case RecipientsPlain, "":
+	case RecipientsRedact:
+		options.ReplaceAttr = replaceRecipients(Redact)
+	case RecipientsHash:
+		options.ReplaceAttr = replaceRecipients(Hash)
+	default:
+		return nil, errors.New("invalid log recipients mode: " + recipients)
+	}
+	switch strings.ToLower(format) {
+	case "json":
+		return slog.NewJSONHandler(w, options), nil
+	case "logfmt", "text":
+		return slog.NewTextHandler(w, options), nil
+	default:
+		return nil, errors.New("invalid log format: " + format)
+	}
+}
+
+// Tee returns a handler passing entries to all given handlers.
+// Errors of the handlers are joined.
+func Tee(handlers ...slog.Handler) slog.Handler {
+	return teeHandler(handlers)
+}
+
+// ParseLevel parses the given level name (debug|info|warn|error).
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	if err != nil {
+		return level, errors.New("invalid log level: " + s)
+	}
+	return level, nil
+}
+
+// Error returns an attribute for the given error, with a null value for nil.
+func Error(err error) slog.Attr {
+	if err == nil {
+		return slog.Any(FieldError, nil)
+	}
+	return slog.String(FieldError, err.Error())
+}
+
+// Redact replaces the local part of the given address with ***.
+func Redact(address string) string {
+	if i := strings.LastIndexByte(address, '@'); i >= 0 {
+		return "***" + address[i:]
+	}
+	return "***"
+}
+
+// Hash returns the first 32 hex digits of the SHA-256 hash of the lowercase
+// address, which allows correlating entries without revealing the address.
+func Hash(address string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(address)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// replaceRecipients returns a function replacing the recipient addresses of
+// top-level to, denied_to and suppressed_to fields with the result of the
+// given function.
+func replaceRecipients(replace func(string) string) func([]string, slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if len(groups) > 0 || (a.Key != FieldTo && a.Key != FieldDeniedTo && a.Key != FieldSuppressedTo) {
+			return a
+		}
+		switch v := a.Value.Any().(type) {
+		case string:
+			return slog.String(a.Key, replace(v))
+		case []string:
+			replaced := make([]string, len(v))
+			for i, address := range v {
+				replaced[i] = replace(address)
+			}
+			return slog.Any(a.Key, replaced)
+		}
+		return a
+	}
+}
+
+// splitHandler passes error entries to the err handler and others to out.
+type splitHandler struct {
+	out slog.Handler
+	err slog.Handler
+}
+
+func (h *splitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.out.Enabled(ctx, level)
+}
+
+func (h *splitHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		return h.err.Handle(ctx, r)
+	}
+	return h.out.Handle(ctx, r)
+}
+
+func (h *splitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &splitHandler{out: h.out.WithAttrs(attrs), err: h.err.WithAttrs(attrs)}
+}
+
+func (h *splitHandler) WithGroup(name string) slog.Handler {
+	return &splitHandler{out: h.out.WithGroup(name), err: h.err.WithGroup(name)}
+}
+
+type teeHandler []slog.Handler
+
+func (h teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, r.Level) {
+			if err := handler.Handle(ctx, r.Clone()); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
@@ -0,0 +1,180 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewWithJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	log, err := New("json", slog.LevelInfo, "plain", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	log.Info("test", FieldIP, "127.0.0.1")
+	var entry map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &entry); err != nil {
+		t.Fatalf("Unexpected JSON error: %s", err)
+	}
+	if entry["msg"] != "test" {
+		t.Errorf("Unexpected msg: %v. Expected: %s", entry["msg"], "test")
+	}
+	if entry[FieldIP] != "127.0.0.1" {
+		t.Errorf("Unexpected ip: %v. Expected: %s", entry[FieldIP], "127.0.0.1")
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("Unexpected stderr: %s", stderr.String())
+	}
+}
+
+func TestNewWithLogfmt(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	log, err := New("logfmt", slog.LevelInfo, "plain", &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	log.Warn("test", FieldFrom, "alice@example.org")
+	out := stdout.String()
+	if !strings.Contains(out, "level=WARN") || !strings.Contains(out, "from=alice@example.org") {
+		t.Errorf("Unexpected stdout: %s", out)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("Unexpected stderr: %s", stderr.String())
+	}
+}
+
+func TestNewWithInvalidFormat(t *testing.T) {
+	_, err := New("xml", slog.LevelInfo, "plain", nil, nil)
+	if err == nil {
+		t.Error("Unexpected nil error")
+	}
+}
+
+func TestNewWithErrorLevel(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	log, _ := New("json", slog.LevelInfo, "plain", &stdout, &stderr)
+	log.With(FieldIP, "127.0.0.1").Error("test", Error(errors.New("ERROR")))
+	if stdout.Len() != 0 {
+		t.Errorf("Unexpected stdout: %s", stdout.String())
+	}
+	var entry map[string]any
+	json.Unmarshal(stderr.Bytes(), &entry)
+	if entry[FieldError] != "ERROR" {
+		t.Errorf("Unexpected error: %v. Expected: %s", entry[FieldError], "ERROR")
+	}
+	if entry[FieldIP] != "127.0.0.1" {
+		t.Errorf("Unexpected ip: %v. Expected: %s", entry[FieldIP], "127.0.0.1")
+	}
+}
+
+func TestNewWithMinimumLevel(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	log, _ := New("json", slog.LevelWarn, "plain", &stdout, &stderr)
+	log.Info("test")
+	log.Debug("test")
+	if stdout.Len() != 0 {
+		t.Errorf("Unexpected stdout: %s", stdout.String())
+	}
+}
+
+func TestNewWithInvalidRecipients(t *testing.T) {
+	_, err := New("json", slog.LevelInfo, "encrypt", nil, nil)
+	if err == nil {
+		t.Error("Unexpected nil error")
+	}
+}
+
+func TestNewWithRedactedRecipients(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	log, _ := New("json", slog.LevelInfo, RecipientsRedact, &stdout, &stderr)
+	log.Info("test",
+		FieldFrom, "alice@example.org",
+		FieldTo, []string{"bob@example.org", "charlie"},
+		FieldDeniedTo, "dave@example.net",
+		FieldSuppressedTo, []string{"erin@example.com"},
+	)
+	var entry struct {
+		From         string   `json:"from"`
+		To           []string `json:"to"`
+		DeniedTo     string   `json:"denied_to"`
+		SuppressedTo []string `json:"suppressed_to"`
+	}
+	json.Unmarshal(stdout.Bytes(), &entry)
+	if entry.From != "alice@example.org" {
+		t.Errorf("Unexpected from: %s. Expected: %s", entry.From, "alice@example.org")
+	}
+	if len(entry.To) != 2 || entry.To[0] != "***@example.org" || entry.To[1] != "***" {
+		t.Errorf("Unexpected to: %v", entry.To)
+	}
+	if entry.DeniedTo != "***@example.net" {
+		t.Errorf("Unexpected denied_to: %s. Expected: %s", entry.DeniedTo, "***@example.net")
+	}
+	if len(entry.SuppressedTo) != 1 || entry.SuppressedTo[0] != "***@example.com" {
+		t.Errorf("Unexpected suppressed_to: %v", entry.SuppressedTo)
+	}
+}
+
+func TestNewWithHashedRecipients(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	log, _ := New("json", slog.LevelInfo, RecipientsHash, &stdout, &stderr)
+	log.Info("test", FieldTo, []string{"Bob@Example.org"})
+	var entry struct {
+		To []string `json:"to"`
+	}
+	json.Unmarshal(stdout.Bytes(), &entry)
+	expected := Hash("bob@example.org")
+	if len(entry.To) != 1 || entry.To[0] != expected {
+		t.Errorf("Unexpected to: %v. Expected: [%s]", entry.To, expected)
+	}
+	if len(expected) != 32 || strings.Contains(expected, "example") {
+		t.Errorf("Unexpected hash: %s", expected)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("debug")
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if level != slog.LevelDebug {
+		t.Errorf("Unexpected level: %s. Expected: %s", level, slog.LevelDebug)
+	}
+	_, err = ParseLevel("verbose")
+	if err == nil {
+		t.Error("Unexpected nil error")
+	}
+}
+
+func TestError(t *testing.T) {
+	attr := Error(nil)
+	if attr.Value.Any() != nil {
+		t.Errorf("Unexpected value: %v", attr.Value.Any())
+	}
+	attr = Error(errors.New("ERROR"))
+	if attr.Value.String() != "ERROR" {
+		t.Errorf("Unexpected value: %s. Expected: %s", attr.Value.String(), "ERROR")
+	}
+}
+
+func TestTee(t *testing.T) {
+	var first, second bytes.Buffer
+	h1, _ := NewHandler("json", slog.LevelInfo, RecipientsPlain, &first)
+	h2, _ := NewHandler("json", slog.LevelError, RecipientsPlain, &second)
+	log := slog.New(Tee(h1, h2)).With(FieldIP, "127.0.0.1")
+	log.Info("info")
+	log.Error("error")
+	if strings.Count(first.String(), "\n") != 2 {
+		t.Errorf("Unexpected first output: %s", first.String())
+	}
+	if strings.Count(second.String(), "\n") != 1 || !strings.Contains(second.String(), `"ip":"127.0.0.1"`) {
+		t.Errorf("Unexpected second output: %s", second.String())
+	}
+	if slog.New(Tee()).Enabled(context.Background(), slog.LevelError) {
+		t.Error("Unexpected enabled empty tee")
+	}
+}
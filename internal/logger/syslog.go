@@ -0,0 +1,218 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// facilityUser is the syslog facility of the sent messages (user-level).
+const facilityUser = 1
+
+const (
+	// syslogTimeout limits connecting and sending, as entries are written
+	// inline, e.g. audit entries before replying to the SMTP client.
+	syslogTimeout = 2 * time.Second
+	// syslogRetry is the interval between reconnect attempts, while entries are
+	// dropped.
+	syslogRetry = 10 * time.Second
+)
+
+// errSyslogUnavailable is returned for dropped entries while the syslog server
+// is unreachable.
+var errSyslogUnavailable = errors.New("syslog server unavailable")
+
+// Syslog sends log entries as RFC 5424 messages to a syslog server.
+// Messages are sent as single datagrams via udp and unixgram networks and with
+// octet-counting framing (RFC 6587) via tcp and unix stream networks.
+// Connecting and sending time out and entries are dropped until the next
+// reconnect attempt if the server is unreachable, so logging does not block.
+type Syslog struct {
+	network  string
+	address  string
+	hostname string
+	appName  string
+	timeout  time.Duration
+	retry    time.Duration
+	mu       sync.Mutex
+	conn     net.Conn
+	stream   bool
+	severity int
+	// retryAt is the time of the next reconnect attempt after a failed one.
+	retryAt time.Time
+}
+
+// DialSyslog connects to the syslog server at the given address.
+// Valid networks are udp, tcp, unixgram and unix, which falls back to a stream
+// connection if the socket does not accept datagrams.
+func DialSyslog(network string, address string, appName string) (*Syslog, error) {
+	switch network {
+	case "udp", "tcp", "unix", "unixgram":
+	default:
+		return nil, errors.New("invalid syslog network: " + network)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s := &Syslog{
+		network:  network,
+		address:  address,
+		hostname: hostname,
+		appName:  appName,
+		timeout:  syslogTimeout,
+		retry:    syslogRetry,
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Handler returns a handler for the given format (json|logfmt), minimum level
+// and recipients mode, which sends each entry as message with the severity
+// matching the entry level.
+func (s *Syslog) Handler(format string, level slog.Level, recipients string) (
+	slog.Handler,
+	error,
+) {
+	h, err := NewHandler(format, level, recipients, syslogWriter{s})
+	if err != nil {
+		return nil, err
+	}
+	return &syslogHandler{Handler: h, syslog: s}, nil
+}
+
+// Close closes the connection to the syslog server.
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *Syslog) connect() (err error) {
+	dialer := net.Dialer{Timeout: s.timeout}
+	s.stream = s.network == "tcp"
+	switch s.network {
+	case "unix":
+		s.conn, err = dialer.Dial("unixgram", s.address)
+		if err != nil {
+			s.conn, err = dialer.Dial("unix", s.address)
+			s.stream = true
+		}
+	default:
+		s.conn, err = dialer.Dial(s.network, s.address)
+	}
+	return err
+}
+
+// send writes the message to the connection within the timeout and closes the
+// connection if that fails.
+func (s *Syslog) send(msg []byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	_, err := s.conn.Write(msg)
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// write sends the given entry with the current severity and reconnects once
+// if sending fails, e.g. after a restart of the syslog server.
+// If reconnecting fails, entries are dropped until the retry interval passed.
+// The caller must hold the lock.
+func (s *Syslog) write(p []byte) (int, error) {
+	entry := bytes.TrimRight(p, "\n")
+	if s.conn != nil {
+		if s.send(s.format(entry)) == nil {
+			return len(p), nil
+		}
+	} else if time.Now().Before(s.retryAt) {
+		return 0, errSyslogUnavailable
+	}
+	if err := s.connect(); err != nil {
+		s.retryAt = time.Now().Add(s.retry)
+		return 0, err
+	}
+	if err := s.send(s.format(entry)); err != nil {
+		s.retryAt = time.Now().Add(s.retry)
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// format returns the RFC 5424 message for the given entry:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func (s *Syslog) format(entry []byte) []byte {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "<%d>1 %s %s %s %d - - ",
+		facilityUser*8+s.severity,
+		time.Now().Format(time.RFC3339Nano),
+		s.hostname,
+		s.appName,
+		os.Getpid(),
+	)
+	buffer.Write(entry)
+	if s.stream {
+		return append([]byte(strconv.Itoa(buffer.Len())+" "), buffer.Bytes()...)
+	}
+	return buffer.Bytes()
+}
+
+// Severity returns the syslog severity for the given level.
+func Severity(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3 // Error
+	case level >= slog.LevelWarn:
+		return 4 // Warning
+	case level >= slog.LevelInfo:
+		return 6 // Informational
+	default:
+		return 7 // Debug
+	}
+}
+
+// syslogWriter passes entries formatted by the syslog handler to the server.
+type syslogWriter struct {
+	syslog *Syslog
+}
+
+func (w syslogWriter) Write(p []byte) (int, error) {
+	return w.syslog.write(p)
+}
+
+// syslogHandler sets the severity for the formatted entry before passing the
+// record to the wrapped handler, which writes to the syslogWriter.
+type syslogHandler struct {
+	slog.Handler
+	syslog *Syslog
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.syslog.mu.Lock()
+	defer h.syslog.mu.Unlock()
+	h.syslog.severity = Severity(r.Level)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithAttrs(attrs), syslog: h.syslog}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithGroup(name), syslog: h.syslog}
+}
@@ -0,0 +1,262 @@
+package logger
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// syslogRegExp matches RFC 5424 messages sent by Syslog.
+var syslogRegExp = regexp.MustCompile(
+	`^<(\d+)>1 \S+ \S+ aws-smtp-relay \d+ - - (.*)$`,
+)
+
+func syslogHelper(t *testing.T, msg string) (priority int, entry string) {
+	match := syslogRegExp.FindStringSubmatch(msg)
+	if match == nil {
+		t.Fatalf("Unexpected syslog message: %q", msg)
+	}
+	priority, _ = strconv.Atoi(match[1])
+	return priority, match[2]
+}
+
+func TestSyslogWithUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %s", err)
+	}
+	defer conn.Close()
+	s, err := DialSyslog("udp", conn.LocalAddr().String(), "aws-smtp-relay")
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer s.Close()
+	h, err := s.Handler("json", slog.LevelInfo, RecipientsPlain)
+	if err != nil {
+		t.Fatalf("Unexpected handler error: %s", err)
+	}
+	log := slog.New(h)
+	log.Info("audit", FieldFrom, "alice@example.org")
+	log.Error("audit", Error(errors.New("ERROR")))
+	buffer := make([]byte, 2048)
+	for _, expected := range []struct {
+		priority int
+		contains string
+	}{
+		{8 + 6, `"from":"alice@example.org"`},
+		{8 + 3, `"error":"ERROR"`},
+	} {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatalf("Unexpected read error: %s", err)
+		}
+		priority, entry := syslogHelper(t, string(buffer[:n]))
+		if priority != expected.priority {
+			t.Errorf("Unexpected priority: %d. Expected: %d", priority, expected.priority)
+		}
+		if !strings.Contains(entry, expected.contains) || strings.HasSuffix(entry, "\n") {
+			t.Errorf("Unexpected entry: %q", entry)
+		}
+	}
+}
+
+func streamHelper(t *testing.T, ln net.Listener) *bufio.Reader {
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Unexpected accept error: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return bufio.NewReader(conn)
+}
+
+// readFrame reads an octet-counted message (RFC 6587).
+func readFrame(t *testing.T, r *bufio.Reader) string {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatalf("Unexpected read error: %s", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		t.Fatalf("Unexpected frame length: %q", length)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		t.Fatalf("Unexpected read error: %s", err)
+	}
+	return string(msg)
+}
+
+func TestSyslogWithTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %s", err)
+	}
+	defer ln.Close()
+	s, err := DialSyslog("tcp", ln.Addr().String(), "aws-smtp-relay")
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer s.Close()
+	r := streamHelper(t, ln)
+	h, _ := s.Handler("logfmt", slog.LevelInfo, RecipientsHash)
+	log := slog.New(h)
+	log.Warn("first", FieldTo, []string{"bob@example.org"})
+	log.Info("second")
+	priority, entry := syslogHelper(t, readFrame(t, r))
+	if priority != 8+4 {
+		t.Errorf("Unexpected priority: %d. Expected: %d", priority, 8+4)
+	}
+	if !strings.Contains(entry, "msg=first") || strings.Contains(entry, "bob@example.org") {
+		t.Errorf("Unexpected entry: %q", entry)
+	}
+	_, entry = syslogHelper(t, readFrame(t, r))
+	if !strings.Contains(entry, "msg=second") {
+		t.Errorf("Unexpected entry: %q", entry)
+	}
+}
+
+func TestSyslogWithUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %s", err)
+	}
+	defer conn.Close()
+	s, err := DialSyslog("unix", path, "aws-smtp-relay")
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer s.Close()
+	h, _ := s.Handler("json", slog.LevelInfo, RecipientsPlain)
+	slog.New(h).Info("audit")
+	buffer := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buffer)
+	if err != nil {
+		t.Fatalf("Unexpected read error: %s", err)
+	}
+	_, entry := syslogHelper(t, string(buffer[:n]))
+	if !strings.Contains(entry, `"msg":"audit"`) {
+		t.Errorf("Unexpected entry: %q", entry)
+	}
+}
+
+func TestSyslogWithUnixStreamSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %s", err)
+	}
+	defer ln.Close()
+	s, err := DialSyslog("unix", path, "aws-smtp-relay")
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer s.Close()
+	r := streamHelper(t, ln)
+	h, _ := s.Handler("json", slog.LevelInfo, RecipientsPlain)
+	slog.New(h).Info("audit")
+	_, entry := syslogHelper(t, readFrame(t, r))
+	if !strings.Contains(entry, `"msg":"audit"`) {
+		t.Errorf("Unexpected entry: %q", entry)
+	}
+}
+
+func TestSyslogWithUnavailableServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %s", err)
+	}
+	s, err := DialSyslog("unix", path, "aws-smtp-relay")
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer s.Close()
+	ln.Close()
+	s.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.write([]byte("first")); err == nil || errors.Is(err, errSyslogUnavailable) {
+		t.Errorf("Unexpected error: %v. Expected reconnect error", err)
+	}
+	// Entries are dropped without reconnect attempt until the retry interval:
+	ln, err = net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %s", err)
+	}
+	defer ln.Close()
+	if _, err := s.write([]byte("second")); !errors.Is(err, errSyslogUnavailable) {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, errSyslogUnavailable)
+	}
+	s.retryAt = time.Now()
+	if _, err := s.write([]byte("third")); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	_, entry := syslogHelper(t, readFrame(t, streamHelper(t, ln)))
+	if entry != "third" {
+		t.Errorf("Unexpected entry: %q. Expected: %q", entry, "third")
+	}
+}
+
+func TestSyslogWithBlockedServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %s", err)
+	}
+	s, err := DialSyslog("unix", path, "aws-smtp-relay")
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	defer s.Close()
+	streamHelper(t, ln)
+	ln.Close()
+	s.timeout = 50 * time.Millisecond
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The server never reads, so a write times out once the buffers are full
+	// and the entry is dropped as reconnecting fails:
+	entry := []byte(strings.Repeat("x", 1<<16))
+	for err == nil {
+		_, err = s.write(entry)
+	}
+	if _, err := s.write(entry); !errors.Is(err, errSyslogUnavailable) {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, errSyslogUnavailable)
+	}
+}
+
+func TestSyslogWithInvalidNetwork(t *testing.T) {
+	_, err := DialSyslog("http", "localhost:514", "aws-smtp-relay")
+	if err == nil {
+		t.Error("Unexpected nil error")
+	}
+	_, err = DialSyslog("unix", filepath.Join(os.TempDir(), "missing.sock"), "aws-smtp-relay")
+	if err == nil {
+		t.Error("Unexpected nil error")
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	for level, expected := range map[slog.Level]int{
+		slog.LevelDebug: 7,
+		slog.LevelInfo:  6,
+		slog.LevelWarn:  4,
+		slog.LevelError: 3,
+	} {
+		if severity := Severity(level); severity != expected {
+			t.Errorf("Unexpected severity for %s: %d. Expected: %d", level, severity, expected)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+/*
+Package message validates and normalizes raw email data before it is relayed.
+*/
+package message
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+)
+
+// maxDepth is the maximum nesting depth of multipart bodies.
+const maxDepth = 32
+
+// foldLength is the line length after which header fields are folded.
+const foldLength = 78
+
+// RejectError rejects an email with a permanent SMTP error, which is passed
+// to the client as-is, e.g. "554 5.6.0 Invalid message: missing From header".
+type RejectError struct {
+	// Status is the enhanced status code, e.g. 5.6.0.
+	Status string
+	Reason string
+}
+
+func (e *RejectError) Error() string {
+	return "554 " + e.Status + " " + e.Reason
+}
+
+func invalid(reason string) error {
+	return &RejectError{Status: "5.6.0", Reason: "Invalid message: " + reason}
+}
+
+// Normalizer validates and normalizes emails.
+type Normalizer struct {
+	// Hostname is the domain of generated Message-ID headers.
+	Hostname string
+}
+
+// Apply returns the raw data with CRLF line breaks, RFC 2047 encoded non-ASCII
+// header values and added Date and Message-ID headers if they are missing.
+// Emails without From header, with invalid header fields or with malformed
+// MIME structure are rejected with a RejectError.
+// A nil Normalizer returns the unmodified data.
+func (n *Normalizer) Apply(data []byte) ([]byte, error) {
+	if n == nil {
+		return data, nil
+	}
+	normalized := NormalizeLineBreaks(data)
+	fields, rest := header.Split(normalized)
+	modified := len(normalized) != len(data) || len(rest) == 0
+	hasFrom, hasDate, hasMessageID := false, false, false
+	for i, field := range fields {
+		if !validName(field.Name) {
+			return nil, invalid("invalid header line: " + truncate(field.Raw))
+		}
+		switch strings.ToLower(field.Name) {
+		case "from":
+			hasFrom = true
+		case "date":
+			hasDate = true
+		case "message-id":
+			hasMessageID = true
+		}
+		if !isASCII(field.Raw) {
+			raw, err := encodeField(field)
+			if err != nil {
+				return nil, err
+			}
+			fields[i].Raw = raw
+			modified = true
+		}
+	}
+	if !hasFrom {
+		return nil, invalid("missing From header")
+	}
+	modified = modified || !hasDate || !hasMessageID
+	if !hasDate {
+		fields = append(fields, header.Field{
+			Name: "Date",
+			Raw:  []byte("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n"),
+		})
+	}
+	if !hasMessageID {
+		fields = append(fields, header.Field{
+			Name: "Message-ID",
+			Raw:  []byte("Message-ID: " + n.messageID() + "\r\n"),
+		})
+	}
+	if len(rest) == 0 {
+		rest = []byte("\r\n")
+	}
+	data = normalized
+	if modified {
+		data = header.Join(fields, rest)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, invalid(Sanitize(err.Error()))
+	}
+	if err := checkBody(msg.Header.Get("Content-Type"), msg.Body, 0); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (n *Normalizer) messageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + n.Hostname + ">"
+}
+
+// NormalizeLineBreaks replaces bare LF and CR characters with CRLF.
+func NormalizeLineBreaks(data []byte) []byte {
+	bare := false
+	for i, c := range data {
+		if (c == '\n' && (i == 0 || data[i-1] != '\r')) ||
+			(c == '\r' && (i == len(data)-1 || data[i+1] != '\n')) {
+			bare = true
+			break
+		}
+	}
+	if !bare {
+		return data
+	}
+	normalized := make([]byte, 0, len(data)+len(data)/32)
+	for i, c := range data {
+		switch {
+		case c == '\n' && (i == 0 || data[i-1] != '\r'):
+			normalized = append(normalized, '\r', '\n')
+		case c == '\r' && (i == len(data)-1 || data[i+1] != '\n'):
+			normalized = append(normalized, '\r', '\n')
+		default:
+			normalized = append(normalized, c)
+		}
+	}
+	return normalized
+}
+
+// encodeField returns the header field with its UTF-8 value encoded as RFC
+// 2047 encoded-words, which for address fields only applies to display names.
+func encodeField(field header.Field) ([]byte, error) {
+	value := field.Value()
+	if !utf8.ValidString(value) {
+		return nil, invalid("invalid 8-bit characters in " + Sanitize(field.Name) + " header")
+	}
+	encoded, err := header.Encode(field.Name, value)
+	switch {
+	case errors.Is(err, header.ErrNonASCIIAddress):
+		return nil, invalid("non-ASCII address in " + Sanitize(field.Name) + " header")
+	case err != nil:
+		return nil, invalid("invalid " + Sanitize(field.Name) + " header: " + Sanitize(err.Error()))
+	}
+	return fold(field.Name, encoded), nil
+}
+
+// fold formats a header field with lines folded at spaces after foldLength
+// characters, if possible.
+func fold(name string, value string) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString(name + ":")
+	length := buffer.Len()
+	for _, word := range strings.Split(value, " ") {
+		if length > len(name)+1 && length+1+len(word) > foldLength {
+			buffer.WriteString("\r\n")
+			length = 0
+		}
+		buffer.WriteString(" " + word)
+		length += 1 + len(word)
+	}
+	buffer.WriteString("\r\n")
+	return buffer.Bytes()
+}
+
+// checkBody validates the structure of multipart bodies.
+func checkBody(contentType string, body io.Reader, depth int) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil && !errors.Is(err, mime.ErrInvalidMediaParameter) {
+		return invalid("invalid Content-Type: " + Sanitize(contentType))
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil
+	}
+	if params["boundary"] == "" {
+		return invalid("missing multipart boundary")
+	}
+	if depth >= maxDepth {
+		return invalid("too deeply nested multipart body")
+	}
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return invalid("malformed multipart body: " + err.Error())
+		}
+		if err := checkBody(part.Header.Get("Content-Type"), part, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validName reports if the header field name only consists of printable ASCII
+// characters except colon (RFC 5322, section 2.2).
+func validName(name string) bool {
+	for _, c := range []byte(name) {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// truncate returns the sanitized raw header line for error messages.
+func truncate(raw []byte) string {
+	line := Sanitize(string(raw))
+	if len(line) > 40 {
+		line = strings.ToValidUTF8(line[:40], "") + "..."
+	}
+	return line
+}
+
+// Sanitize returns untrusted text, e.g. a header line, for use in SMTP
+// replies: folded lines are unfolded, other line breaks and control characters
+// replaced with spaces and percent signs, which smtpd interprets as format
+// verbs of replies, as well as invalid UTF-8 replaced with question marks.
+func Sanitize(text string) string {
+	text = strings.ToValidUTF8(text, "?")
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\r\n")
+	var b strings.Builder
+	for i, c := range text {
+		switch {
+		case c == '\n' && i+1 < len(text) && (text[i+1] == ' ' || text[i+1] == '\t'):
+			// Unfolded lines keep the leading whitespace of the next line.
+		case c == '%':
+			b.WriteByte('?')
+		case unicode.IsControl(c):
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
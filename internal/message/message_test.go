@@ -0,0 +1,164 @@
+package message
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeLineBreaks(t *testing.T) {
+	for data, expected := range map[string]string{
+		"a\r\nb\r\n":   "a\r\nb\r\n",
+		"a\nb\n":       "a\r\nb\r\n",
+		"\na\rb\r\n\r": "\r\na\r\nb\r\n\r\n",
+		"":             "",
+	} {
+		if normalized := NormalizeLineBreaks([]byte(data)); string(normalized) != expected {
+			t.Errorf("Unexpected data for %q: %q. Expected: %q", data, normalized, expected)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	n := &Normalizer{Hostname: "relay.example.org"}
+	data := []byte("From: Café Ops <ops@example.org>, bob@example.org\n" +
+		"Subject: Résumé of the quarterly results, which is long enough to be folded\n" +
+		"\n" +
+		"Body line\n")
+	out, err := n.Apply(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %s", err)
+	}
+	if from := msg.Header.Get("From"); from != "=?utf-8?q?Caf=C3=A9_Ops?= <ops@example.org>, <bob@example.org>" {
+		t.Errorf("Unexpected From header: %s", from)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "Résumé of the quarterly results, which is long enough to be folded" {
+		t.Errorf("Unexpected Subject header: %s", subject)
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Unexpected Date header error: %s", err)
+	}
+	messageID := regexp.MustCompile(`^<[0-9a-f]{32}@relay\.example\.org>$`)
+	if id := msg.Header.Get("Message-ID"); !messageID.MatchString(id) {
+		t.Errorf("Unexpected Message-ID header: %s", id)
+	}
+	if !bytes.Contains(out, []byte("long_enough?=\r\n =?utf-8?q?_to_be_folded?=\r\n")) {
+		t.Errorf("Unexpected folding: %q", out)
+	}
+	for _, line := range strings.SplitAfter(string(out), "\r\n") {
+		if strings.ContainsAny(strings.TrimSuffix(line, "\r\n"), "\r\n") {
+			t.Errorf("Unexpected line: %q", line)
+		}
+	}
+	if !bytes.HasSuffix(out, []byte("\r\n\r\nBody line\r\n")) {
+		t.Errorf("Unexpected body: %q", out)
+	}
+}
+
+func TestApplyWithValidMessage(t *testing.T) {
+	n := &Normalizer{Hostname: "relay.example.org"}
+	data := []byte("From: alice@example.org\r\n" +
+		"Date: Mon, 02 Jan 2006 15:04:05 -0700\r\n" +
+		"Message-ID: <1@example.org>\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+		"\r\n" +
+		"--b1\r\n" +
+		"Content-Type: multipart/alternative; boundary=b2\r\n" +
+		"\r\n" +
+		"--b2\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"TEST\r\n" +
+		"--b2--\r\n" +
+		"--b1--\r\n")
+	out, err := n.Apply(data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if &out[0] != &data[0] {
+		t.Errorf("Unexpected data copy: %q", out)
+	}
+	var nilNormalizer *Normalizer
+	out, err = nilNormalizer.Apply([]byte("TEST\n"))
+	if err != nil || string(out) != "TEST\n" {
+		t.Errorf("Unexpected nil normalizer result: %q %v", out, err)
+	}
+}
+
+func TestApplyWithInvalidMessage(t *testing.T) {
+	n := &Normalizer{Hostname: "relay.example.org"}
+	for data, reason := range map[string]string{
+		"Subject: Test\r\n\r\nTEST":                                                                       "missing From header",
+		"From alice@example.org\r\n\r\nTEST":                                                              "invalid header line: From alice@example.org",
+		"From: alice@example.org\r\nSubject: Caf\xe9\r\n\r\n":                                             "invalid 8-bit characters in Subject header",
+		"From: caf\xc3\xa9@example.org\r\n\r\n":                                                           "non-ASCII address in From header",
+		"From: Café <alice>\r\n\r\n":                                                                      "invalid From header: mail: missing @ in addr-spec",
+		"From: alice@example.org\r\nContent-Type: /\r\n\r\n":                                              "invalid Content-Type: /",
+		"From: alice@example.org\r\nContent-Type: multipart/mixed\r\n\r\n":                                "missing multipart boundary",
+		"From: alice@example.org\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\n\r\nTEST\r\n": "malformed multipart body: multipart: NextPart: EOF",
+	} {
+		_, err := n.Apply([]byte(data))
+		var reject *RejectError
+		if !errors.As(err, &reject) {
+			t.Errorf("Unexpected error for %q: %v", data, err)
+			continue
+		}
+		expected := "554 5.6.0 Invalid message: " + reason
+		if err.Error() != expected {
+			t.Errorf("Unexpected error: %s. Expected: %s", err, expected)
+		}
+	}
+}
+
+func TestApplyWithUntrustedReason(t *testing.T) {
+	n := &Normalizer{Hostname: "relay.example.org"}
+	for data, reason := range map[string]string{
+		// The reply must stay a single line without format verbs:
+		"From: alice@example.org\r\nBad Header: x\r\n 250 OK\r\n\r\n": "invalid header line: Bad Header: x 250 OK",
+		"From: alice@example.org\r\nBad%n%s Header: x\r\n\r\n":        "invalid header line: Bad?n?s Header: x",
+		"From: alice@example.org\r\nContent-Type: /%d\x01\r\n\r\n":    "invalid Content-Type: /?d ",
+	} {
+		_, err := n.Apply([]byte(data))
+		expected := "554 5.6.0 Invalid message: " + reason
+		if err == nil || err.Error() != expected {
+			t.Errorf("Unexpected error: %q. Expected: %q", err, expected)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	for text, expected := range map[string]string{
+		"plain":                "plain",
+		"folded\r\n\tline\r\n": "folded line",
+		"a\r\nb\rc\nd":         "a b c d",
+		"100% \xff":            "100? ?",
+	} {
+		if sanitized := Sanitize(text); sanitized != expected {
+			t.Errorf("Unexpected sanitized text: %q. Expected: %q", sanitized, expected)
+		}
+	}
+}
+
+func TestApplyWithNestedMultipart(t *testing.T) {
+	n := &Normalizer{Hostname: "relay.example.org"}
+	var data bytes.Buffer
+	data.WriteString("From: alice@example.org\r\n")
+	for i := 0; i <= maxDepth; i++ {
+		boundary := "b" + strconv.Itoa(i)
+		data.WriteString("Content-Type: multipart/mixed; boundary=" + boundary + "\r\n\r\n--" + boundary + "\r\n")
+	}
+	_, err := n.Apply(data.Bytes())
+	if err == nil || err.Error() != "554 5.6.0 Invalid message: too deeply nested multipart body" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
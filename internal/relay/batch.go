@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+)
+
+// MaxRecipients is the maximum number of recipients per SES/Pinpoint API call.
+const MaxRecipients = 50
+
+// SendFunc sends an email to the given batch of recipients and returns the
+// message ID assigned by the API.
+type SendFunc func(to []string) (messageID string, err error)
+
+// Batch splits the recipients into batches of at most size recipients.
+func Batch(recipients []string, size int) (batches [][]string) {
+	for size > 0 && len(recipients) > size {
+		batches = append(batches, recipients[:size:size])
+		recipients = recipients[size:]
+	}
+	if len(recipients) > 0 {
+		batches = append(batches, recipients)
+	}
+	return batches
+}
+
+// SendBatches calls send for each batch of at most MaxRecipients recipients,
+// logs the outcome of each call and aggregates them into per-recipient results.
+// The error is only returned if all calls fail, as the client would otherwise
+// retry the email and send it again to the recipients of successful calls.
+// The recipients of failed calls hold the error in the result instead.
+func SendBatches(
+	log *slog.Logger,
+	origin net.Addr,
+	from string,
+	recipients []string,
+	send SendFunc,
+) (result Result, err error) {
+	var errs []error
+	sent := false
+	for _, batch := range Batch(recipients, MaxRecipients) {
+		messageID, sendErr := send(batch)
+		Log(log, origin, from, batch, messageID, sendErr)
+		if sendErr != nil {
+			errs = append(errs, sendErr)
+		} else {
+			sent = true
+		}
+		for _, address := range batch {
+			result.Recipients = append(result.Recipients, RecipientResult{
+				Address:   address,
+				MessageID: messageID,
+				Error:     sendErr,
+			})
+		}
+	}
+	switch {
+	case sent, len(errs) == 0:
+	case len(errs) == 1:
+		err = errs[0]
+	default:
+		err = errors.Join(errs...)
+	}
+	return result, err
+}
+
+// Failed returns results for recipients the email has not been sent to.
+func Failed(recipients []string, err error) []RecipientResult {
+	results := make([]RecipientResult, len(recipients))
+	for i, address := range recipients {
+		results[i] = RecipientResult{Address: address, Error: err}
+	}
+	return results
+}
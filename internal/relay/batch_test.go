@@ -0,0 +1,124 @@
+package relay
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	recipients := []string{"a", "b", "c", "d", "e"}
+	batches := Batch(recipients, 2)
+	expected := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}
+	if !reflect.DeepEqual(batches, expected) {
+		t.Errorf("Unexpected batches: %v. Expected: %v", batches, expected)
+	}
+	batches = Batch(recipients, 5)
+	if len(batches) != 1 || len(batches[0]) != 5 {
+		t.Errorf("Unexpected batches: %v", batches)
+	}
+	if batches := Batch(nil, 5); len(batches) != 0 {
+		t.Errorf("Unexpected batches: %v", batches)
+	}
+}
+
+func TestBatchDoesNotShareCapacity(t *testing.T) {
+	recipients := []string{"a", "b", "c"}
+	batches := Batch(recipients, 2)
+	batches[0] = append(batches[0], "x")
+	if recipients[2] != "c" {
+		t.Errorf("Unexpected modification of recipients: %v", recipients)
+	}
+}
+
+func TestSendBatches(t *testing.T) {
+	origin := net.TCPAddr{IP: []byte{127, 0, 0, 1}}
+	recipients := make([]string, MaxRecipients+1)
+	for i := range recipients {
+		recipients[i] = "bob@example.org"
+	}
+	apiErr := errors.New("API failure")
+	calls := 0
+	result, err := SendBatches(testLogger, &origin, "alice@example.org", recipients, func(to []string) (string, error) {
+		calls++
+		if calls == 2 {
+			return "", apiErr
+		}
+		return "id", nil
+	})
+	if calls != 2 {
+		t.Errorf("Unexpected number of calls: %d. Expected: %d", calls, 2)
+	}
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if len(result.Recipients) != len(recipients) {
+		t.Fatalf("Unexpected number of results: %d", len(result.Recipients))
+	}
+	if result.Recipients[0].MessageID != "id" || result.Recipients[0].Error != nil {
+		t.Errorf("Unexpected result: %v", result.Recipients[0])
+	}
+	if result.Recipients[MaxRecipients].Error != apiErr {
+		t.Errorf("Unexpected result: %v", result.Recipients[MaxRecipients])
+	}
+}
+
+func TestSendBatchesWithFailures(t *testing.T) {
+	origin := net.TCPAddr{IP: []byte{127, 0, 0, 1}}
+	recipients := make([]string, MaxRecipients+1)
+	for i := range recipients {
+		recipients[i] = "bob@example.org"
+	}
+	apiErr := errors.New("API failure")
+	result, err := SendBatches(testLogger, &origin, "alice@example.org", recipients, func(to []string) (string, error) {
+		return "", apiErr
+	})
+	if !errors.Is(err, apiErr) {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, apiErr)
+	}
+	for _, recipient := range result.Recipients {
+		if recipient.Error != apiErr {
+			t.Errorf("Unexpected result: %v", recipient)
+		}
+	}
+}
+
+func TestResultMessageID(t *testing.T) {
+	result := Result{Recipients: []RecipientResult{
+		{Address: "a", MessageID: "id-1"},
+		{Address: "b", MessageID: "id-1"},
+		{Address: "c", Error: ErrDeniedRecipients},
+		{Address: "d", MessageID: "id-2"},
+	}}
+	if result.MessageID() != "id-1,id-2" {
+		t.Errorf("Unexpected message ID: %s. Expected: %s", result.MessageID(), "id-1,id-2")
+	}
+}
+
+func TestResultReply(t *testing.T) {
+	result := Result{Recipients: []RecipientResult{
+		{Address: "a", MessageID: "id-1"},
+		{Address: "b", Error: errors.New("failed")},
+	}}
+	expected := "id-1 (partial delivery, failed recipients: b)"
+	if result.Reply() != expected {
+		t.Errorf("Unexpected reply: %s. Expected: %s", result.Reply(), expected)
+	}
+	for i := 0; i < 10; i++ {
+		result.Recipients = append(result.Recipients, RecipientResult{
+			Address: "user%d@example.org",
+			Error:   errors.New("failed"),
+		})
+	}
+	expected = "id-1 (partial delivery, failed recipients: b, user?d@example.org, " +
+		"user?d@example.org, user?d@example.org, user?d@example.org and 6 more)"
+	if result.Reply() != expected {
+		t.Errorf("Unexpected reply: %s. Expected: %s", result.Reply(), expected)
+	}
+	// Without successful recipients, the reply only holds the message IDs:
+	result.Recipients = result.Recipients[1:]
+	if result.Reply() != "" {
+		t.Errorf("Unexpected reply: %s. Expected: %s", result.Reply(), "")
+	}
+}
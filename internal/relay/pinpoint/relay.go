@@ -2,10 +2,13 @@ package relay
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net"
 	"regexp"
 
 	"github.com/KamorionLabs/aws-smtp-relay/internal/relay"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/tracing"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/pinpointemail"
 	pinpointemailtypes "github.com/aws/aws-sdk-go-v2/service/pinpointemail/types"
@@ -16,65 +19,103 @@ type PinpointEmailClient interface {
 	SendEmail(context.Context, *pinpointemail.SendEmailInput, ...func(*pinpointemail.Options)) (*pinpointemail.SendEmailOutput, error)
 }
 
+// MaxMessageSize is the maximum size in bytes of raw messages accepted by the
+// Pinpoint Email API.
+const MaxMessageSize = 10 * 1024 * 1024
+
 // Client implements the Relay interface.
 type Client struct {
 	pinpointClient  PinpointEmailClient
 	setName         *string
 	allowFromRegExp *regexp.Regexp
 	denyToRegExp    *regexp.Regexp
+	tags            *relay.MessageTags
+	logger          *slog.Logger
 }
 
-// Send uses the given Pinpoint API to send email data
+// Send uses the given Pinpoint API to send email data and returns the
+// MessageIds assigned by Pinpoint per recipient.
 func (c Client) Send(
+	ctx context.Context,
 	origin net.Addr,
 	from string,
 	to []string,
 	data []byte,
-) error {
+) (relay.Result, error) {
+	var result relay.Result
+	_, span := tracing.Tracer().Start(ctx, "relay.FilterAddresses")
 	allowedRecipients, deniedRecipients, err := relay.FilterAddresses(
 		from,
 		to,
 		c.allowFromRegExp,
 		c.denyToRegExp,
 	)
+	tracing.End(span, err)
 	if err != nil {
-		relay.Log(origin, from, deniedRecipients, err)
+		relay.Log(c.logger, origin, from, deniedRecipients, "", err)
+		result.Recipients = relay.Failed(deniedRecipients, err)
 	}
 	if len(allowedRecipients) > 0 {
-		_, err := c.pinpointClient.SendEmail(context.Background(), &pinpointemail.SendEmailInput{
+		tags, data, tagsErr := c.tags.Apply(data)
+		if tagsErr != nil {
+			relay.Log(c.logger, origin, from, allowedRecipients, "", tagsErr)
+			result.Recipients = append(result.Recipients, relay.Failed(allowedRecipients, tagsErr)...)
+			return result, tagsErr
+		}
+		input := &pinpointemail.SendEmailInput{
 			ConfigurationSetName: c.setName,
 			FromEmailAddress:     &from,
-			Destination: &pinpointemailtypes.Destination{
-				ToAddresses: allowedRecipients,
-			},
 			Content: &pinpointemailtypes.EmailContent{
 				Raw: &pinpointemailtypes.RawMessage{
 					Data: data,
 				},
 			},
+		}
+		for _, tag := range tags {
+			input.EmailTags = append(input.EmailTags, pinpointemailtypes.MessageTag{
+				Name:  &tag.Name,
+				Value: &tag.Value,
+			})
+		}
+		// The Destination defines the envelope recipients of raw messages,
+		// which are sent in batches to respect the per-call recipients limit:
+		sent, sendErr := relay.SendBatches(c.logger, origin, from, allowedRecipients, func(to []string) (string, error) {
+			batchInput := *input
+			batchInput.Destination = &pinpointemailtypes.Destination{ToAddresses: to}
+			out, err := c.pinpointClient.SendEmail(ctx, &batchInput)
+			if out != nil && out.MessageId != nil {
+				return *out.MessageId, err
+			}
+			return "", err
 		})
-		relay.Log(origin, from, allowedRecipients, err)
-		if err != nil {
-			return err
+		result.Recipients = append(result.Recipients, sent.Recipients...)
+		if sendErr != nil {
+			return result, sendErr
 		}
 	}
-	return err
+	return result, err
 }
 
 // New creates a new client with AWS SDK v2 configuration.
+// It returns an error if the AWS configuration cannot be loaded.
 func New(
 	configurationSetName *string,
 	allowFromRegExp *regexp.Regexp,
 	denyToRegExp *regexp.Regexp,
-) Client {
+	tags *relay.MessageTags,
+	logger *slog.Logger,
+) (Client, error) {
 	cfg, err := config.LoadDefaultConfig(context.Background())
 	if err != nil {
-		panic("unable to load SDK config, " + err.Error())
+		return Client{}, errors.New("unable to load SDK config, " + err.Error())
 	}
+	tracing.AppendMiddlewares(&cfg.APIOptions)
 	return Client{
 		pinpointClient:  pinpointemail.NewFromConfig(cfg),
 		setName:         configurationSetName,
 		allowFromRegExp: allowFromRegExp,
 		denyToRegExp:    denyToRegExp,
-	}
+		tags:            tags,
+		logger:          logger,
+	}, nil
 }
@@ -4,12 +4,16 @@ Package relay provides an interface to relay emails via Amazon SES/Pinpoint API.
 package relay
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"fmt"
+	"log/slog"
 	"net"
 	"regexp"
-	"time"
+	"strconv"
+	"strings"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/logger"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/message"
 )
 
 var (
@@ -29,39 +33,97 @@ type ARNs struct {
 	ReturnPathArn *string
 }
 
+// RecipientResult holds the outcome of a relayed email for one recipient.
+type RecipientResult struct {
+	Address string
+	// MessageID is the ID assigned to the email by the Amazon SES/Pinpoint API.
+	MessageID string
+	Error     error
+}
+
+// Result holds the outcome of a relayed email.
+type Result struct {
+	Recipients []RecipientResult
+}
+
+// MessageID returns the comma-separated list of unique message IDs assigned to
+// the email, as it might have been sent in multiple batches.
+func (r Result) MessageID() string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, recipient := range r.Recipients {
+		if recipient.MessageID != "" && !seen[recipient.MessageID] {
+			seen[recipient.MessageID] = true
+			ids = append(ids, recipient.MessageID)
+		}
+	}
+	return strings.Join(ids, ",")
+}
+
+// maxReplyRecipients is the maximum number of failed recipients listed in the
+// reply, which is limited to 512 characters by RFC 5321.
+const maxReplyRecipients = 5
+
+// Reply returns the message IDs for the reply to the SMTP client, followed by
+// the failed recipients if the email has only been sent to some of them, e.g.
+// "id-1 (partial delivery, failed recipients: bob@example.org)".
+func (r Result) Reply() string {
+	reply := r.MessageID()
+	var failed []string
+	for _, recipient := range r.Recipients {
+		if recipient.Error != nil {
+			failed = append(failed, recipient.Address)
+		}
+	}
+	if reply == "" || len(failed) == 0 {
+		return reply
+	}
+	more := ""
+	if len(failed) > maxReplyRecipients {
+		more = " and " + strconv.Itoa(len(failed)-maxReplyRecipients) + " more"
+		failed = failed[:maxReplyRecipients]
+	}
+	// Addresses are sanitized, as smtpd sends replies as format strings:
+	return reply + " (partial delivery, failed recipients: " +
+		message.Sanitize(strings.Join(failed, ", ")) + more + ")"
+}
+
 // Client provides an interface to send emails.
 type Client interface {
 	Send(
+		ctx context.Context,
 		origin net.Addr,
 		from string,
 		to []string,
 		data []byte,
-	) error
-}
-
-type logEntry struct {
-	Time  time.Time
-	IP    string
-	From  string
-	To    []string
-	Error *string
+	) (Result, error)
 }
 
-// Log creates a log entry and prints it as JSON to STDOUT.
-func Log(origin net.Addr, from string, to []string, err error) {
-	ip := origin.(*net.TCPAddr).IP.String()
-	entry := &logEntry{
-		Time: time.Now().UTC(),
-		IP:   ip,
-		From: from,
-		To:   to,
-	}
+// Log creates a relay log entry with the given logger.
+// Entries with an error are logged with level error, others with level info.
+// The messageID is only logged if it is not empty.
+func Log(
+	log *slog.Logger,
+	origin net.Addr,
+	from string,
+	to []string,
+	messageID string,
+	err error,
+) {
+	level := slog.LevelInfo
 	if err != nil {
-		errString := err.Error()
-		entry.Error = &errString
+		level = slog.LevelError
+	}
+	attrs := []slog.Attr{
+		slog.String(logger.FieldIP, origin.(*net.TCPAddr).IP.String()),
+		slog.String(logger.FieldFrom, from),
+		slog.Any(logger.FieldTo, to),
+	}
+	if messageID != "" {
+		attrs = append(attrs, slog.String(logger.FieldMessageID, messageID))
 	}
-	b, _ := json.Marshal(entry)
-	fmt.Println(string(b))
+	attrs = append(attrs, logger.Error(err))
+	log.LogAttrs(context.Background(), level, "relay", attrs...)
 }
 
 // FilterAddresses validates sender and recipients and returns lists for allowed
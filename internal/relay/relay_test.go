@@ -1,38 +1,39 @@
 package relay
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
+	"log/slog"
 	"net"
-	"os"
 	"regexp"
 	"testing"
 	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/logger"
 )
 
-func logHelper(addr net.Addr, from string, to []string, err error) (
+var testLogger, _ = logger.New("json", slog.LevelInfo, "plain", io.Discard, io.Discard)
+
+type logEntry struct {
+	Time      time.Time `json:"time"`
+	Level     string    `json:"level"`
+	IP        string    `json:"ip"`
+	From      string    `json:"from"`
+	To        []string  `json:"to"`
+	MessageID *string   `json:"message_id"`
+	Error     *string   `json:"error"`
+}
+
+func logHelper(addr net.Addr, from string, to []string, messageID string, err error) (
 	[]byte,
 	[]byte,
 ) {
-	outReader, outWriter, _ := os.Pipe()
-	errReader, errWriter, _ := os.Pipe()
-	originalOut := os.Stdout
-	originalErr := os.Stderr
-	defer func() {
-		os.Stdout = originalOut
-		os.Stderr = originalErr
-	}()
-	os.Stdout = outWriter
-	os.Stderr = errWriter
-	func() {
-		Log(addr, from, to, err)
-		outWriter.Close()
-		errWriter.Close()
-	}()
-	stdout, _ := io.ReadAll(outReader)
-	stderr, _ := io.ReadAll(errReader)
-	return stdout, stderr
+	var stdout, stderr bytes.Buffer
+	log, _ := logger.New("json", slog.LevelInfo, "plain", &stdout, &stderr)
+	Log(log, addr, from, to, messageID, err)
+	return stdout.Bytes(), stderr.Bytes()
 }
 
 func TestLog(t *testing.T) {
@@ -45,7 +46,7 @@ func TestLog(t *testing.T) {
 	from := emails[0]
 	to := []string{emails[1], emails[2]}
 	timeBefore := time.Now()
-	out, err := logHelper(&origin, from, to, nil)
+	out, err := logHelper(&origin, from, to, "", nil)
 	timeAfter := time.Now()
 	var entry logEntry
 	json.Unmarshal(out, &entry)
@@ -71,6 +72,9 @@ func TestLog(t *testing.T) {
 		toVals[0] != expectedToVals[0] || toVals[1] != expectedToVals[1] {
 		t.Errorf("Unexpected 'To' log: %s. Expected: %s", toVals, expectedToVals)
 	}
+	if entry.MessageID != nil {
+		t.Errorf("Unexpected 'MessageID' log: %s. Expected: %v", *entry.MessageID, nil)
+	}
 	if entry.Error != nil {
 		t.Errorf("Unexpected 'Error' log: %s. Expected: %v", *entry.Error, nil)
 	}
@@ -79,6 +83,21 @@ func TestLog(t *testing.T) {
 	}
 }
 
+func TestLogWithMessageID(t *testing.T) {
+	origin := net.TCPAddr{IP: []byte{127, 0, 0, 1}}
+	out, err := logHelper(&origin, "alice@example.org", []string{"bob@example.org"}, "0100018f-example", nil)
+	var entry logEntry
+	json.Unmarshal(out, &entry)
+	if entry.MessageID == nil {
+		t.Errorf("Unexpected 'MessageID' log: %v. Expected: %s", nil, "0100018f-example")
+	} else if *entry.MessageID != "0100018f-example" {
+		t.Errorf("Unexpected 'MessageID' log: %s. Expected: %s", *entry.MessageID, "0100018f-example")
+	}
+	if len(err) != 0 {
+		t.Errorf("Unexpected stderr: %s", err)
+	}
+}
+
 func TestLogWithOriginIPv6(t *testing.T) {
 	origin := net.TCPAddr{IP: []byte{
 		0x20, 0x01, 0x48, 0x60, 0, 0, 0x20, 0x01, 0, 0, 0, 0, 0, 0, 0x00, 0x68,
@@ -90,7 +109,7 @@ func TestLogWithOriginIPv6(t *testing.T) {
 	}
 	from := emails[0]
 	to := []string{emails[1], emails[2]}
-	out, err := logHelper(&origin, from, to, nil)
+	out, err := logHelper(&origin, from, to, "", nil)
 	var entry logEntry
 	json.Unmarshal(out, &entry)
 	if entry.IP != "2001:4860:0:2001::68" {
@@ -117,16 +136,19 @@ func TestLogWithError(t *testing.T) {
 	}
 	from := emails[0]
 	to := []string{emails[1], emails[2]}
-	out, err := logHelper(&origin, from, to, errors.New("ERROR"))
+	out, err := logHelper(&origin, from, to, "", errors.New("ERROR"))
 	var entry logEntry
-	json.Unmarshal(out, &entry)
+	json.Unmarshal(err, &entry)
 	if entry.Error == nil {
 		t.Errorf("Unexpected 'Error' log: %v. Expected: %s", nil, "ERROR")
 	} else if *entry.Error != "ERROR" {
 		t.Errorf("Unexpected 'Error' log: %s. Expected: %s", *entry.Error, "ERROR")
 	}
-	if len(err) != 0 {
-		t.Errorf("Unexpected stderr: %s", err)
+	if entry.Level != "ERROR" {
+		t.Errorf("Unexpected 'Level' log: %s. Expected: %s", entry.Level, "ERROR")
+	}
+	if len(out) != 0 {
+		t.Errorf("Unexpected stdout: %s", out)
 	}
 }
 
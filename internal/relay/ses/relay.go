@@ -2,10 +2,13 @@ package relay
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net"
 	"regexp"
 
 	"github.com/KamorionLabs/aws-smtp-relay/internal/relay"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/tracing"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 	sesv2types "github.com/aws/aws-sdk-go-v2/service/sesv2/types"
@@ -16,6 +19,10 @@ type SESEmailClient interface {
 	SendEmail(context.Context, *sesv2.SendEmailInput, ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
 }
 
+// MaxMessageSize is the maximum size in bytes of raw messages accepted by the
+// SESv2 API.
+const MaxMessageSize = 40 * 1024 * 1024
+
 // Client implements the Relay interface.
 type Client struct {
 	sesClient       SESEmailClient
@@ -23,37 +30,54 @@ type Client struct {
 	allowFromRegExp *regexp.Regexp
 	denyToRegExp    *regexp.Regexp
 	arns            *relay.ARNs
+	tags            *relay.MessageTags
+	logger          *slog.Logger
 }
 
-// Send uses the client SESEmailClient to send email data via SESv2 API
+// Send uses the client SESEmailClient to send email data via SESv2 API and
+// returns the MessageIds assigned by SES per recipient.
 func (c Client) Send(
+	ctx context.Context,
 	origin net.Addr,
 	from string,
 	to []string,
 	data []byte,
-) error {
+) (relay.Result, error) {
+	var result relay.Result
+	_, span := tracing.Tracer().Start(ctx, "relay.FilterAddresses")
 	allowedRecipients, deniedRecipients, err := relay.FilterAddresses(
 		from,
 		to,
 		c.allowFromRegExp,
 		c.denyToRegExp,
 	)
+	tracing.End(span, err)
 	if err != nil {
-		relay.Log(origin, from, deniedRecipients, err)
+		relay.Log(c.logger, origin, from, deniedRecipients, "", err)
+		result.Recipients = relay.Failed(deniedRecipients, err)
 	}
 	if len(allowedRecipients) > 0 {
+		tags, data, tagsErr := c.tags.Apply(data)
+		if tagsErr != nil {
+			relay.Log(c.logger, origin, from, allowedRecipients, "", tagsErr)
+			result.Recipients = append(result.Recipients, relay.Failed(allowedRecipients, tagsErr)...)
+			return result, tagsErr
+		}
 		input := &sesv2.SendEmailInput{
 			ConfigurationSetName: c.setName,
 			FromEmailAddress:     &from,
-			Destination: &sesv2types.Destination{
-				ToAddresses: allowedRecipients,
-			},
 			Content: &sesv2types.EmailContent{
 				Raw: &sesv2types.RawMessage{
 					Data: data,
 				},
 			},
 		}
+		for _, tag := range tags {
+			input.EmailTags = append(input.EmailTags, sesv2types.MessageTag{
+				Name:  &tag.Name,
+				Value: &tag.Value,
+			})
+		}
 		// Map ARNs to SESv2 format
 		// FromArn and SourceArn both map to FromEmailAddressIdentityArn
 		if c.arns != nil {
@@ -67,31 +91,47 @@ func (c Client) Send(
 				input.FeedbackForwardingEmailAddressIdentityArn = c.arns.ReturnPathArn
 			}
 		}
-		_, err := c.sesClient.SendEmail(context.Background(), input)
-		relay.Log(origin, from, allowedRecipients, err)
-		if err != nil {
-			return err
+		// The Destination defines the envelope recipients of raw messages,
+		// which are sent in batches to respect the per-call recipients limit:
+		sent, sendErr := relay.SendBatches(c.logger, origin, from, allowedRecipients, func(to []string) (string, error) {
+			batchInput := *input
+			batchInput.Destination = &sesv2types.Destination{ToAddresses: to}
+			out, err := c.sesClient.SendEmail(ctx, &batchInput)
+			if out != nil && out.MessageId != nil {
+				return *out.MessageId, err
+			}
+			return "", err
+		})
+		result.Recipients = append(result.Recipients, sent.Recipients...)
+		if sendErr != nil {
+			return result, sendErr
 		}
 	}
-	return err
+	return result, err
 }
 
 // New creates a new client with AWS SDK v2 configuration using SESv2 API.
+// It returns an error if the AWS configuration cannot be loaded.
 func New(
 	configurationSetName *string,
 	allowFromRegExp *regexp.Regexp,
 	denyToRegExp *regexp.Regexp,
 	arns *relay.ARNs,
-) Client {
+	tags *relay.MessageTags,
+	logger *slog.Logger,
+) (Client, error) {
 	cfg, err := config.LoadDefaultConfig(context.Background())
 	if err != nil {
-		panic("unable to load SDK config, " + err.Error())
+		return Client{}, errors.New("unable to load SDK config, " + err.Error())
 	}
+	tracing.AppendMiddlewares(&cfg.APIOptions)
 	return Client{
 		sesClient:       sesv2.NewFromConfig(cfg),
 		setName:         configurationSetName,
 		allowFromRegExp: allowFromRegExp,
 		denyToRegExp:    denyToRegExp,
 		arns:            arns,
-	}
+		tags:            tags,
+		logger:          logger,
+	}, nil
 }
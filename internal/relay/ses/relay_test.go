@@ -1,21 +1,29 @@
 package relay
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"net"
-	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/KamorionLabs/aws-smtp-relay/internal/logger"
 	"github.com/KamorionLabs/aws-smtp-relay/internal/relay"
 	"github.com/aws/aws-sdk-go-v2/service/sesv2"
 )
 
+var testLogger, _ = logger.New("json", slog.LevelInfo, "plain", io.Discard, io.Discard)
+
 var testData = struct {
-	input *sesv2.SendEmailInput
-	err   error
+	input     *sesv2.SendEmailInput
+	messageID *string
+	err       error
 }{}
 
 type mockSESClient struct{}
@@ -25,9 +33,32 @@ func (m *mockSESClient) SendEmail(ctx context.Context, input *sesv2.SendEmailInp
 	error,
 ) {
 	testData.input = input
+	if testData.messageID != nil {
+		return &sesv2.SendEmailOutput{MessageId: testData.messageID}, testData.err
+	}
 	return nil, testData.err
 }
 
+// batchClient records the recipients of each API call and fails on call failOn.
+type batchClient struct {
+	calls  [][]string
+	failOn int
+	err    error
+}
+
+func (m *batchClient) SendEmail(
+	ctx context.Context,
+	input *sesv2.SendEmailInput,
+	opts ...func(*sesv2.Options),
+) (*sesv2.SendEmailOutput, error) {
+	m.calls = append(m.calls, input.Destination.ToAddresses)
+	if len(m.calls) == m.failOn {
+		return nil, m.err
+	}
+	messageID := fmt.Sprintf("id-%d", len(m.calls))
+	return &sesv2.SendEmailOutput{MessageId: &messageID}, nil
+}
+
 func sendHelper(
 	origin net.Addr,
 	from string,
@@ -37,36 +68,27 @@ func sendHelper(
 	allowFromRegExp *regexp.Regexp,
 	denyToRegExp *regexp.Regexp,
 	arns *relay.ARNs,
+	tags *relay.MessageTags,
 	apiErr error,
 ) (email *sesv2.SendEmailInput, out []byte, err []byte, sendErr error) {
-	outReader, outWriter, _ := os.Pipe()
-	errReader, errWriter, _ := os.Pipe()
-	originalOut := os.Stdout
-	originalErr := os.Stderr
+	var stdout, stderr bytes.Buffer
+	log, _ := logger.New("json", slog.LevelInfo, "plain", &stdout, &stderr)
 	defer func() {
 		testData.input = nil
 		testData.err = nil
-		os.Stdout = originalOut
-		os.Stderr = originalErr
-	}()
-	os.Stdout = outWriter
-	os.Stderr = errWriter
-	func() {
-		c := Client{
-			sesClient:       &mockSESClient{},
-			setName:         configurationSetName,
-			allowFromRegExp: allowFromRegExp,
-			denyToRegExp:    denyToRegExp,
-			arns:            arns,
-		}
-		testData.err = apiErr
-		sendErr = c.Send(origin, from, to, data)
-		outWriter.Close()
-		errWriter.Close()
 	}()
-	stdout, _ := io.ReadAll(outReader)
-	stderr, _ := io.ReadAll(errReader)
-	return testData.input, stdout, stderr, sendErr
+	c := Client{
+		sesClient:       &mockSESClient{},
+		setName:         configurationSetName,
+		allowFromRegExp: allowFromRegExp,
+		denyToRegExp:    denyToRegExp,
+		arns:            arns,
+		tags:            tags,
+		logger:          log,
+	}
+	testData.err = apiErr
+	_, sendErr = c.Send(context.Background(), origin, from, to, data)
+	return testData.input, stdout.Bytes(), stderr.Bytes(), sendErr
 }
 
 func TestSend(t *testing.T) {
@@ -75,7 +97,7 @@ func TestSend(t *testing.T) {
 	to := []string{"bob@example.org"}
 	data := []byte{'T', 'E', 'S', 'T'}
 	setName := ""
-	input, out, err, _ := sendHelper(&origin, from, to, data, &setName, nil, nil, nil, nil)
+	input, out, err, _ := sendHelper(&origin, from, to, data, &setName, nil, nil, nil, nil, nil)
 	if *input.FromEmailAddress != from {
 		t.Errorf(
 			"Unexpected source: %s. Expected: %s",
@@ -115,7 +137,7 @@ func TestSendWithMultipleRecipients(t *testing.T) {
 	to := []string{"bob@example.org", "charlie@example.org"}
 	data := []byte{'T', 'E', 'S', 'T'}
 	setName := ""
-	input, out, err, _ := sendHelper(&origin, from, to, data, &setName, nil, nil, nil, nil)
+	input, out, err, _ := sendHelper(&origin, from, to, data, &setName, nil, nil, nil, nil, nil)
 	if len(input.Destination.ToAddresses) != 2 {
 		t.Errorf(
 			"Unexpected number of destinations: %d. Expected: %d",
@@ -145,7 +167,7 @@ func TestSendWithDeniedSender(t *testing.T) {
 	data := []byte{'T', 'E', 'S', 'T'}
 	setName := ""
 	regexp, _ := regexp.Compile(`^admin@example\.org$`)
-	input, out, err, sendErr := sendHelper(&origin, from, to, data, &setName, regexp, nil, nil, nil)
+	input, out, err, sendErr := sendHelper(&origin, from, to, data, &setName, regexp, nil, nil, nil, nil)
 	if input != nil {
 		t.Errorf(
 			"Unexpected number of destinations: %d. Expected: %d",
@@ -156,11 +178,11 @@ func TestSendWithDeniedSender(t *testing.T) {
 	if sendErr != relay.ErrDeniedSender {
 		t.Errorf("Unexpected error: %s. Expected: %s", sendErr, relay.ErrDeniedSender)
 	}
-	if len(out) == 0 {
-		t.Error("Unexpected empty stdout")
+	if len(out) != 0 {
+		t.Errorf("Unexpected stdout: %s", out)
 	}
-	if len(err) != 0 {
-		t.Errorf("Unexpected stderr: %s", err)
+	if len(err) == 0 {
+		t.Error("Unexpected empty stderr")
 	}
 }
 
@@ -171,7 +193,7 @@ func TestSendWithDeniedRecipient(t *testing.T) {
 	data := []byte{'T', 'E', 'S', 'T'}
 	setName := ""
 	regexp, _ := regexp.Compile(`^bob@example\.org$`)
-	input, out, err, sendErr := sendHelper(&origin, from, to, data, &setName, nil, regexp, nil, nil)
+	input, out, err, sendErr := sendHelper(&origin, from, to, data, &setName, nil, regexp, nil, nil, nil)
 	if len(input.Destination.ToAddresses) != 1 {
 		t.Errorf(
 			"Unexpected number of destinations: %d. Expected: %d",
@@ -192,8 +214,8 @@ func TestSendWithDeniedRecipient(t *testing.T) {
 	if len(out) == 0 {
 		t.Error("Unexpected empty stdout")
 	}
-	if len(err) != 0 {
-		t.Errorf("Unexpected stderr: %s", err)
+	if len(err) == 0 {
+		t.Error("Unexpected empty stderr")
 	}
 }
 
@@ -204,7 +226,7 @@ func TestSendWithApiError(t *testing.T) {
 	data := []byte{'T', 'E', 'S', 'T'}
 	setName := ""
 	apiErr := errors.New("API failure")
-	input, out, err, sendErr := sendHelper(&origin, from, to, data, &setName, nil, nil, nil, apiErr)
+	input, out, err, sendErr := sendHelper(&origin, from, to, data, &setName, nil, nil, nil, nil, apiErr)
 	if *input.FromEmailAddress != from {
 		t.Errorf(
 			"Unexpected source: %s. Expected: %s",
@@ -233,11 +255,137 @@ func TestSendWithApiError(t *testing.T) {
 	if sendErr != apiErr {
 		t.Errorf("Send did not report API error: %s. Expected: %s", sendErr, apiErr)
 	}
-	if len(out) == 0 {
-		t.Error("Unexpected empty stdout")
+	if len(out) != 0 {
+		t.Errorf("Unexpected stdout: %s", out)
 	}
-	if len(err) != 0 {
-		t.Errorf("Unexpected stderr: %s", err)
+	if len(err) == 0 {
+		t.Error("Unexpected empty stderr")
+	}
+}
+
+func TestSendWithMessageTags(t *testing.T) {
+	origin := net.TCPAddr{IP: []byte{127, 0, 0, 1}}
+	from := "alice@example.org"
+	to := []string{"bob@example.org"}
+	data := []byte("X-SES-MESSAGE-TAGS: app=billing, env=dev\r\nSubject: Test\r\n\r\nTEST")
+	setName := ""
+	tags := &relay.MessageTags{
+		Header:      "X-SES-MESSAGE-TAGS",
+		Static:      map[string]string{"env": "prod"},
+		StripHeader: true,
+	}
+	input, _, _, sendErr := sendHelper(&origin, from, to, data, &setName, nil, nil, nil, tags, nil)
+	if sendErr != nil {
+		t.Errorf("Unexpected error: %s", sendErr)
+	}
+	if len(input.EmailTags) != 2 {
+		t.Fatalf("Unexpected number of tags: %d. Expected: %d", len(input.EmailTags), 2)
+	}
+	if *input.EmailTags[0].Name != "app" || *input.EmailTags[0].Value != "billing" {
+		t.Errorf("Unexpected tag: %s=%s", *input.EmailTags[0].Name, *input.EmailTags[0].Value)
+	}
+	if *input.EmailTags[1].Name != "env" || *input.EmailTags[1].Value != "prod" {
+		t.Errorf("Unexpected tag: %s=%s", *input.EmailTags[1].Name, *input.EmailTags[1].Value)
+	}
+	inputData := string(input.Content.Raw.Data)
+	if inputData != "Subject: Test\r\n\r\nTEST" {
+		t.Errorf("Unexpected data: %q", inputData)
+	}
+}
+
+func TestSendWithInvalidMessageTags(t *testing.T) {
+	origin := net.TCPAddr{IP: []byte{127, 0, 0, 1}}
+	from := "alice@example.org"
+	to := []string{"bob@example.org"}
+	data := []byte("X-SES-MESSAGE-TAGS: app=billing service\r\n\r\nTEST")
+	setName := ""
+	tags := &relay.MessageTags{Header: "X-SES-MESSAGE-TAGS"}
+	input, _, err, sendErr := sendHelper(&origin, from, to, data, &setName, nil, nil, nil, tags, nil)
+	if input != nil {
+		t.Error("Unexpected API call with invalid message tags")
+	}
+	if sendErr == nil || !strings.HasPrefix(sendErr.Error(), "554 5.6.0 Invalid message tags: ") {
+		t.Errorf("Unexpected error: %v. Expected: 554 5.6.0 Invalid message tags: ...", sendErr)
+	}
+	if len(err) == 0 {
+		t.Error("Unexpected empty stderr")
+	}
+}
+
+func TestSendWithMessageID(t *testing.T) {
+	origin := net.TCPAddr{IP: []byte{127, 0, 0, 1}}
+	messageID := "0100018f-example"
+	testData.messageID = &messageID
+	defer func() {
+		testData.input = nil
+		testData.messageID = nil
+	}()
+	c := Client{sesClient: &mockSESClient{}, logger: testLogger}
+	result, err := c.Send(context.Background(), &origin, "alice@example.org", []string{"bob@example.org"}, []byte("TEST"))
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if result.MessageID() != messageID {
+		t.Errorf("Unexpected message ID: %s. Expected: %s", result.MessageID(), messageID)
+	}
+}
+
+func TestSendWithRecipientBatches(t *testing.T) {
+	origin := net.TCPAddr{IP: []byte{127, 0, 0, 1}}
+	to := make([]string, 120)
+	for i := range to {
+		to[i] = fmt.Sprintf("user%d@example.org", i)
+	}
+	mock := &batchClient{}
+	c := Client{sesClient: mock, logger: testLogger}
+	result, err := c.Send(context.Background(), &origin, "alice@example.org", to, []byte("TEST"))
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if len(mock.calls) != 3 {
+		t.Fatalf("Unexpected number of API calls: %d. Expected: %d", len(mock.calls), 3)
+	}
+	for i, size := range []int{50, 50, 20} {
+		if len(mock.calls[i]) != size {
+			t.Errorf("Unexpected batch size: %d. Expected: %d", len(mock.calls[i]), size)
+		}
+	}
+	if mock.calls[2][19] != to[119] {
+		t.Errorf("Unexpected destination: %s. Expected: %s", mock.calls[2][19], to[119])
+	}
+	if result.MessageID() != "id-1,id-2,id-3" {
+		t.Errorf("Unexpected message ID: %s. Expected: %s", result.MessageID(), "id-1,id-2,id-3")
+	}
+}
+
+func TestSendWithPartialFailure(t *testing.T) {
+	origin := net.TCPAddr{IP: []byte{127, 0, 0, 1}}
+	to := make([]string, 60)
+	for i := range to {
+		to[i] = fmt.Sprintf("user%d@example.org", i)
+	}
+	apiErr := errors.New("API failure")
+	c := Client{sesClient: &batchClient{failOn: 2, err: apiErr}, logger: testLogger}
+	result, err := c.Send(context.Background(), &origin, "alice@example.org", to, []byte("TEST"))
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if len(result.Recipients) != len(to) {
+		t.Fatalf("Unexpected number of results: %d. Expected: %d", len(result.Recipients), len(to))
+	}
+	for i, recipient := range result.Recipients {
+		if recipient.Address != to[i] {
+			t.Errorf("Unexpected address: %s. Expected: %s", recipient.Address, to[i])
+		}
+		if i < relay.MaxRecipients && (recipient.Error != nil || recipient.MessageID != "id-1") {
+			t.Errorf("Unexpected result for %s: %v", recipient.Address, recipient)
+		}
+		if i >= relay.MaxRecipients && (recipient.Error != apiErr || recipient.MessageID != "") {
+			t.Errorf("Unexpected result for %s: %v", recipient.Address, recipient)
+		}
+	}
+	if result.MessageID() != "id-1" {
+		t.Errorf("Unexpected message ID: %s. Expected: %s", result.MessageID(), "id-1")
 	}
 }
 
@@ -253,7 +401,11 @@ func TestNew(t *testing.T) {
 		FromArn:       &fromArn,
 		ReturnPathArn: &returnPathArn,
 	}
-	client := New(&setName, allowFromRegExp, denyToRegExp, arns)
+	tags := &relay.MessageTags{Header: "X-SES-MESSAGE-TAGS"}
+	client, err := New(&setName, allowFromRegExp, denyToRegExp, arns, tags, testLogger)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
 	_, ok := interface{}(client).(relay.Client)
 	if !ok {
 		t.Error("Unexpected: client is not a relay.Client")
@@ -270,6 +422,12 @@ func TestNew(t *testing.T) {
 	if client.arns != arns {
 		t.Errorf("Unexpected arns: %v", client.arns)
 	}
+	if client.tags != tags {
+		t.Errorf("Unexpected tags: %v", client.tags)
+	}
+	if client.logger != testLogger {
+		t.Errorf("Unexpected logger: %v", client.logger)
+	}
 	if client.arns.SourceArn != &sourceArn {
 		t.Errorf("Unexpected sourceArn: %s", *client.arns.SourceArn)
 	}
@@ -280,3 +438,13 @@ func TestNew(t *testing.T) {
 		t.Errorf("Unexpected returnPathArn: %s", *client.arns.ReturnPathArn)
 	}
 }
+
+func TestNewWithInvalidConfig(t *testing.T) {
+	t.Setenv("AWS_PROFILE", "missing-profile")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	setName := ""
+	_, err := New(&setName, nil, nil, nil, nil, testLogger)
+	if err == nil || !strings.HasPrefix(err.Error(), "unable to load SDK config, ") {
+		t.Errorf("Unexpected error: %v. Expected: unable to load SDK config, ...", err)
+	}
+}
@@ -0,0 +1,102 @@
+package relay
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/message"
+)
+
+// ErrInvalidMessageTag is returned for tags not matching the SES naming rules.
+var ErrInvalidMessageTag = errors.New(
+	"invalid message tag: names and values must contain 1-256 ASCII letters, numbers, underscores or dashes",
+)
+
+// SES tag names and values may only contain ASCII letters, numbers,
+// underscores and dashes and must be at most 256 characters long.
+var messageTagRegExp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// MessageTag is a name/value pair attached to a sent email.
+type MessageTag struct {
+	Name  string
+	Value string
+}
+
+// MessageTags configures the tags attached to relayed emails.
+type MessageTags struct {
+	// Header holds comma-separated name=value pairs, e.g. X-SES-MESSAGE-TAGS.
+	Header string
+	// Static tags are added to every email and take precedence over tags with
+	// the same name provided via Header.
+	Static map[string]string
+	// StripHeader removes Header from the raw data before sending.
+	StripHeader bool
+}
+
+// ValidateMessageTag checks the given tag against the SES naming rules.
+func ValidateMessageTag(name string, value string) error {
+	if !messageTagRegExp.MatchString(name) || !messageTagRegExp.MatchString(value) {
+		return ErrInvalidMessageTag
+	}
+	return nil
+}
+
+// ParseMessageTags parses a list of comma-separated name=value pairs.
+func ParseMessageTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+		if err := ValidateMessageTag(name, value); err != nil {
+			return nil, errors.New(err.Error() + ": " + pair)
+		}
+		tags[name] = value
+	}
+	return tags, nil
+}
+
+// Apply returns the tags for the given raw email data, sorted by name.
+// If StripHeader is set, the returned data no longer contains the tags header.
+// Invalid tags in the header are returned as message.RejectError.
+// A nil MessageTags returns no tags and the unmodified data.
+func (m *MessageTags) Apply(data []byte) ([]MessageTag, []byte, error) {
+	if m == nil {
+		return nil, data, nil
+	}
+	tags := make(map[string]string)
+	if m.Header != "" {
+		for _, value := range header.Values(data, m.Header) {
+			parsed, err := ParseMessageTags(value)
+			if err != nil {
+				// Retrying the email would fail again:
+				return nil, data, &message.RejectError{
+					Status: "5.6.0",
+					Reason: "Invalid message tags: " + err.Error(),
+				}
+			}
+			for name, value := range parsed {
+				tags[name] = value
+			}
+		}
+		if m.StripHeader {
+			data = header.Remove(data, m.Header)
+		}
+	}
+	for name, value := range m.Static {
+		tags[name] = value
+	}
+	list := make([]MessageTag, 0, len(tags))
+	for name, value := range tags {
+		list = append(list, MessageTag{Name: name, Value: value})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, data, nil
+}
@@ -0,0 +1,105 @@
+package relay
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/message"
+)
+
+func TestParseMessageTags(t *testing.T) {
+	tags, err := ParseMessageTags(" app=billing, env=prod ,")
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	expected := map[string]string{"app": "billing", "env": "prod"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Unexpected tags: %v. Expected: %v", tags, expected)
+	}
+}
+
+func TestParseMessageTagsWithInvalidTags(t *testing.T) {
+	for _, s := range []string{
+		"app",
+		"app=",
+		"=billing",
+		"app=billing service",
+		"app=billing@example.org",
+		"app=" + strings.Repeat("a", 257),
+	} {
+		_, err := ParseMessageTags(s)
+		if err == nil {
+			t.Errorf("Unexpected nil error for tags: %s", s)
+		}
+	}
+}
+
+func TestMessageTagsApply(t *testing.T) {
+	data := []byte("X-SES-MESSAGE-TAGS: app=billing, env=dev\r\n\r\nTEST")
+	m := &MessageTags{
+		Header: "X-SES-MESSAGE-TAGS",
+		Static: map[string]string{"env": "prod", "team": "core"},
+	}
+	tags, out, err := m.Apply(data)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	expected := []MessageTag{
+		{Name: "app", Value: "billing"},
+		{Name: "env", Value: "prod"},
+		{Name: "team", Value: "core"},
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("Unexpected tags: %v. Expected: %v", tags, expected)
+	}
+	if string(out) != string(data) {
+		t.Errorf("Unexpected data: %q", out)
+	}
+}
+
+func TestMessageTagsApplyWithStripHeader(t *testing.T) {
+	data := []byte("X-SES-MESSAGE-TAGS: app=billing\r\nSubject: Test\r\n\r\nTEST")
+	m := &MessageTags{Header: "X-SES-MESSAGE-TAGS", StripHeader: true}
+	tags, out, err := m.Apply(data)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if len(tags) != 1 {
+		t.Errorf("Unexpected number of tags: %d. Expected: %d", len(tags), 1)
+	}
+	if string(out) != "Subject: Test\r\n\r\nTEST" {
+		t.Errorf("Unexpected data: %q", out)
+	}
+}
+
+func TestMessageTagsApplyWithInvalidHeader(t *testing.T) {
+	data := []byte("X-SES-MESSAGE-TAGS: app=billing service\r\n\r\nTEST")
+	m := &MessageTags{Header: "X-SES-MESSAGE-TAGS"}
+	_, _, err := m.Apply(data)
+	var rejectErr *message.RejectError
+	if !errors.As(err, &rejectErr) {
+		t.Fatalf("Unexpected error: %v. Expected: RejectError", err)
+	}
+	// Invalid tags are rejected permanently, as retrying fails again:
+	expected := "554 5.6.0 Invalid message tags: "
+	if !strings.HasPrefix(err.Error(), expected) {
+		t.Errorf("Unexpected error: %s. Expected: %s...", err, expected)
+	}
+}
+
+func TestMessageTagsApplyWithNilConfig(t *testing.T) {
+	var m *MessageTags
+	data := []byte("X-SES-MESSAGE-TAGS: app=billing\r\n\r\nTEST")
+	tags, out, err := m.Apply(data)
+	if err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if tags != nil {
+		t.Errorf("Unexpected tags: %v", tags)
+	}
+	if string(out) != string(data) {
+		t.Errorf("Unexpected data: %q", out)
+	}
+}
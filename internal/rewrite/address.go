@@ -0,0 +1,98 @@
+package rewrite
+
+import (
+	"io"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+)
+
+// addressParser parses address lists without decoding the display names of
+// unknown charsets, as only the addresses are rewritten.
+var addressParser = mail.AddressParser{WordDecoder: &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	},
+}}
+
+// rewriteFunc returns the rewritten address and true, or the unmodified
+// address and false.
+type rewriteFunc func(address string) (string, bool)
+
+// rewriteField returns the raw header field with its addresses rewritten and
+// true, or nil and false if no address is rewritten.
+func rewriteField(field header.Field, rewrite rewriteFunc) ([]byte, bool) {
+	addresses, err := addressParser.ParseList(field.Value())
+	if err != nil {
+		return nil, false
+	}
+	raw := string(field.Raw)
+	changed := false
+	rebuild := false
+	for _, address := range addresses {
+		rewritten, ok := rewrite(address.Address)
+		if !ok {
+			continue
+		}
+		changed = true
+		var found bool
+		raw, found = replaceAddress(raw, address.Address, rewritten)
+		if !found {
+			// The address is not found verbatim, e.g. for quoted local parts:
+			rebuild = true
+		}
+	}
+	if !changed {
+		return nil, false
+	}
+	if rebuild {
+		return formatField(field, rewrite)
+	}
+	return []byte(raw), true
+}
+
+// formatField returns the header field formatted from its parsed addresses,
+// which is used if the addresses cannot be replaced in place.
+func formatField(field header.Field, rewrite rewriteFunc) ([]byte, bool) {
+	addresses, err := mail.ParseAddressList(field.Value())
+	if err != nil {
+		return nil, false
+	}
+	list := make([]string, len(addresses))
+	for i, address := range addresses {
+		address.Address, _ = rewrite(address.Address)
+		list[i] = address.String()
+	}
+	raw := string(field.Raw)
+	name := raw[:strings.IndexByte(raw, ':')]
+	lineBreak := "\n"
+	if strings.HasSuffix(raw, "\r\n") {
+		lineBreak = "\r\n"
+	}
+	return []byte(name + ": " + strings.Join(list, ", ") + lineBreak), true
+}
+
+// replaceAddress replaces all occurrences of the address in the raw header
+// field, which are delimited by angle brackets, whitespace, commas or comments.
+func replaceAddress(raw string, address string, replacement string) (string, bool) {
+	re := regexp.MustCompile(`(?i)[\s:<,](` + regexp.QuoteMeta(address) + `)`)
+	var builder strings.Builder
+	offset := 0
+	for _, match := range re.FindAllStringSubmatchIndex(raw, -1) {
+		start, end := match[2], match[3]
+		if end < len(raw) && !strings.ContainsRune(" \t\r\n>,;(", rune(raw[end])) {
+			continue
+		}
+		builder.WriteString(raw[offset:start])
+		builder.WriteString(replacement)
+		offset = end
+	}
+	if offset == 0 {
+		return raw, false
+	}
+	builder.WriteString(raw[offset:])
+	return builder.String(), true
+}
@@ -0,0 +1,90 @@
+package rewrite
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+)
+
+// OriginalToHeader lists the original recipients of redirected emails.
+const OriginalToHeader = "X-Original-To"
+
+// Recipients redirects recipients to a catch-all address, e.g. to prevent
+// staging environments from sending emails to real customers.
+type Recipients struct {
+	// Allow matches the recipients which are not redirected.
+	// If nil, all recipients are redirected.
+	Allow *regexp.Regexp
+	// Address is the catch-all address, e.g. qa@example.org.
+	Address string
+	// PlusAddressing redirects to a subaddress of the catch-all address, which
+	// contains the original recipient, e.g. qa+alice_example.com@example.org.
+	PlusAddressing bool
+}
+
+// Redirect returns the catch-all address for the given recipient and true, or
+// the unmodified recipient and false if it is allowed.
+func (r *Recipients) Redirect(address string) (string, bool) {
+	if r.Allow != nil && r.Allow.MatchString(address) {
+		return address, false
+	}
+	if !r.PlusAddressing {
+		return r.Address, !strings.EqualFold(address, r.Address)
+	}
+	local, domain, _ := strings.Cut(r.Address, "@")
+	tag := strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '.', c == '-', c == '_', c == '+', c == '=':
+			return c
+		}
+		return '_'
+	}, address)
+	return local + "+" + tag + "@" + domain, true
+}
+
+// Apply returns the redirected envelope recipients and raw email data.
+// The addresses of the To and Cc headers are edited in place and the original
+// envelope recipients of redirected emails are listed in the X-Original-To
+// header, which replaces any existing one.
+// A nil Recipients returns the unmodified recipients and data.
+func (r *Recipients) Apply(to []string, data []byte) ([]string, []byte) {
+	if r == nil {
+		return to, data
+	}
+	var redirected []string
+	var originals []string
+	seen := make(map[string]bool)
+	for _, address := range to {
+		rewritten, ok := r.Redirect(address)
+		if ok {
+			originals = append(originals, address)
+		}
+		if !seen[strings.ToLower(rewritten)] {
+			seen[strings.ToLower(rewritten)] = true
+			redirected = append(redirected, rewritten)
+		}
+	}
+	if len(originals) == 0 {
+		return to, data
+	}
+	lineBreak := header.LineBreak(data)
+	fields, rest := header.Split(header.Remove(data, OriginalToHeader))
+	for i, field := range fields {
+		if !strings.EqualFold(field.Name, "To") && !strings.EqualFold(field.Name, "Cc") {
+			continue
+		}
+		if raw, ok := rewriteField(field, r.Redirect); ok {
+			fields[i].Raw = raw
+		}
+	}
+	// Each original recipient is listed on its own (folded) line:
+	originalTo := header.Field{
+		Name: OriginalToHeader,
+		Raw: []byte(OriginalToHeader + ": " +
+			strings.Join(originals, ","+lineBreak+" ") + lineBreak),
+	}
+	fields = append([]header.Field{originalTo}, fields...)
+	return redirected, header.Join(fields, rest)
+}
@@ -0,0 +1,94 @@
+package rewrite
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRecipientsRedirect(t *testing.T) {
+	r := &Recipients{
+		Allow:   regexp.MustCompile(`@ourcorp\.com$`),
+		Address: "qa@ourcorp.com",
+	}
+	for address, expected := range map[string]string{
+		"alice@example.com": "qa@ourcorp.com",
+		"bob@ourcorp.com":   "bob@ourcorp.com",
+	} {
+		if rewritten, _ := r.Redirect(address); rewritten != expected {
+			t.Errorf("Unexpected redirect of %s: %s. Expected: %s", address, rewritten, expected)
+		}
+	}
+	r.PlusAddressing = true
+	for address, expected := range map[string]string{
+		"alice@example.com":        "qa+alice_example.com@ourcorp.com",
+		"bob+news@example.com":     "qa+bob+news_example.com@ourcorp.com",
+		"\"john doe\"@example.com": "qa+_john_doe__example.com@ourcorp.com",
+	} {
+		if rewritten, _ := r.Redirect(address); rewritten != expected {
+			t.Errorf("Unexpected redirect of %s: %s. Expected: %s", address, rewritten, expected)
+		}
+	}
+}
+
+func TestRecipientsApply(t *testing.T) {
+	r := &Recipients{
+		Allow:   regexp.MustCompile(`@ourcorp\.com$`),
+		Address: "qa@ourcorp.com",
+	}
+	data := []byte("X-Original-To: forged@example.com\r\n" +
+		"To: =?UTF-8?Q?Al=C3=AFce?= <alice@example.com>,\r\n" +
+		" Bob <bob@ourcorp.com>\r\n" +
+		"Cc: carol@example.com (Carol)\r\n" +
+		"Subject: Test\r\n" +
+		"\r\n" +
+		"To: alice@example.com\r\n")
+	to, out := r.Apply([]string{"alice@example.com", "bob@ourcorp.com", "carol@example.com"}, data)
+	expectedTo := []string{"qa@ourcorp.com", "bob@ourcorp.com"}
+	if !reflect.DeepEqual(to, expectedTo) {
+		t.Errorf("Unexpected recipients: %v. Expected: %v", to, expectedTo)
+	}
+	expected := "X-Original-To: alice@example.com,\r\n" +
+		" carol@example.com\r\n" +
+		"To: =?UTF-8?Q?Al=C3=AFce?= <qa@ourcorp.com>,\r\n" +
+		" Bob <bob@ourcorp.com>\r\n" +
+		"Cc: qa@ourcorp.com (Carol)\r\n" +
+		"Subject: Test\r\n" +
+		"\r\n" +
+		"To: alice@example.com\r\n"
+	if string(out) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", out, expected)
+	}
+}
+
+func TestRecipientsApplyWithPlusAddressing(t *testing.T) {
+	r := &Recipients{Address: "qa@ourcorp.com", PlusAddressing: true}
+	data := []byte("To: alice@example.com\nSubject: Test\n\nTEST")
+	to, out := r.Apply([]string{"alice@example.com"}, data)
+	expectedTo := []string{"qa+alice_example.com@ourcorp.com"}
+	if !reflect.DeepEqual(to, expectedTo) {
+		t.Errorf("Unexpected recipients: %v. Expected: %v", to, expectedTo)
+	}
+	expected := "X-Original-To: alice@example.com\n" +
+		"To: qa+alice_example.com@ourcorp.com\n" +
+		"Subject: Test\n" +
+		"\n" +
+		"TEST"
+	if string(out) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", out, expected)
+	}
+}
+
+func TestRecipientsApplyWithAllowedRecipients(t *testing.T) {
+	r := &Recipients{Allow: regexp.MustCompile(`@ourcorp\.com$`), Address: "qa@ourcorp.com"}
+	data := []byte("To: bob@ourcorp.com\r\n\r\nTEST")
+	to, out := r.Apply([]string{"bob@ourcorp.com"}, data)
+	if !reflect.DeepEqual(to, []string{"bob@ourcorp.com"}) || string(out) != string(data) {
+		t.Errorf("Unexpected redirect: %v, %q", to, out)
+	}
+	var nilRecipients *Recipients
+	to, out = nilRecipients.Apply([]string{"alice@example.com"}, data)
+	if !reflect.DeepEqual(to, []string{"alice@example.com"}) || string(out) != string(data) {
+		t.Errorf("Unexpected nil redirect: %v, %q", to, out)
+	}
+}
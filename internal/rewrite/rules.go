@@ -0,0 +1,102 @@
+/*
+Package rewrite provides rules to rewrite the envelope and header addresses of
+relayed emails.
+*/
+package rewrite
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rule rewrites addresses matching its pattern.
+type Rule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Rules is a list of rules, of which the first matching one applies.
+type Rules []Rule
+
+// ParseRule creates a rule for the given pattern and replacement.
+// Patterns enclosed in slashes are regular expressions, which are applied
+// as-is, e.g. /^(.+)@legacy\.example$/.
+// Other patterns match whole addresses case-insensitively and may contain
+// asterisks as wildcards, e.g. *@*.internal.
+// The replacement may reference capture groups or wildcard matches via $1, $2,
+// etc.
+func ParseRule(pattern string, replacement string) (Rule, error) {
+	if pattern == "" || replacement == "" {
+		return Rule{}, errors.New("missing pattern or replacement")
+	}
+	var expr string
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr = pattern[1 : len(pattern)-1]
+	} else {
+		parts := strings.Split(pattern, "*")
+		for i, part := range parts {
+			parts[i] = regexp.QuoteMeta(part)
+		}
+		expr = "(?i)^" + strings.Join(parts, "(.*)") + "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Rule{}, err
+	}
+	return Rule{Pattern: re, Replacement: replacement}, nil
+}
+
+// ParseRules reads rules with one whitespace-separated pattern and replacement
+// per line, e.g. "*@*.internal noreply@example.org".
+// Empty lines and lines starting with # are ignored.
+func ParseRules(r io.Reader) (Rules, error) {
+	var rules Rules
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.New("line " + strconv.Itoa(number) +
+				": expected pattern and replacement")
+		}
+		rule, err := ParseRule(fields[0], fields[1])
+		if err != nil {
+			return nil, errors.New("line " + strconv.Itoa(number) + ": " + err.Error())
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// LoadRules reads the rules from the file at the given path.
+func LoadRules(path string) (Rules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseRules(file)
+}
+
+// Rewrite returns the address rewritten by the first matching rule and true,
+// or the unmodified address and false if no rule matches.
+func (r Rules) Rewrite(address string) (string, bool) {
+	for _, rule := range r {
+		if rule.Pattern.MatchString(address) {
+			rewritten := rule.Pattern.ReplaceAllString(address, rule.Replacement)
+			if rewritten == "" || rewritten == address {
+				return address, false
+			}
+			return rewritten, true
+		}
+	}
+	return address, false
+}
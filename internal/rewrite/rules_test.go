@@ -0,0 +1,94 @@
+package rewrite
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, test := range []struct {
+		pattern     string
+		replacement string
+		address     string
+		expected    string
+		ok          bool
+	}{
+		{"root@host.internal", "noreply@example.org", "ROOT@host.internal", "noreply@example.org", true},
+		{"root@host.internal", "noreply@example.org", "root@host.internal.org", "root@host.internal.org", false},
+		{"*@*.internal", "noreply@example.org", "cron@db1.internal", "noreply@example.org", true},
+		{"*@*.internal", "noreply@example.org", "cron@example.org", "cron@example.org", false},
+		{"*@legacy.example", "$1@example.org", "alice@legacy.example", "alice@example.org", true},
+		{`/^(.+)@(.+)\.local$/`, "$1+$2@example.org", "bob@app.local", "bob+app@example.org", true},
+		{"*@example.org", "$1@example.org", "alice@example.org", "alice@example.org", false},
+	} {
+		rule, err := ParseRule(test.pattern, test.replacement)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		address, ok := Rules{rule}.Rewrite(test.address)
+		if address != test.expected || ok != test.ok {
+			t.Errorf(
+				"Unexpected rewrite of %s with %s: %s, %t. Expected: %s, %t",
+				test.address,
+				test.pattern,
+				address,
+				ok,
+				test.expected,
+				test.ok,
+			)
+		}
+	}
+}
+
+func TestParseRuleWithInvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"", "/(/"} {
+		_, err := ParseRule(pattern, "noreply@example.org")
+		if err == nil {
+			t.Errorf("Unexpected nil error for pattern: %s", pattern)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(
+		"# Legacy hosts\n\nroot@host.internal admin@example.org\n*@*.internal  noreply@example.org\n",
+	))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Unexpected number of rules: %d. Expected: %d", len(rules), 2)
+	}
+	// The first matching rule applies:
+	if address, _ := rules.Rewrite("root@host.internal"); address != "admin@example.org" {
+		t.Errorf("Unexpected address: %s. Expected: %s", address, "admin@example.org")
+	}
+	if address, _ := rules.Rewrite("cron@host.internal"); address != "noreply@example.org" {
+		t.Errorf("Unexpected address: %s. Expected: %s", address, "noreply@example.org")
+	}
+}
+
+func TestParseRulesWithInvalidLine(t *testing.T) {
+	_, err := ParseRules(strings.NewReader("root@host.internal\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 1:") {
+		t.Errorf("Unexpected error: %v. Expected: line 1: ...", err)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules")
+	os.WriteFile(path, []byte("*@*.internal noreply@example.org\n"), 0600)
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(rules) != 1 {
+		t.Errorf("Unexpected number of rules: %d. Expected: %d", len(rules), 1)
+	}
+	_, err = LoadRules(path + ".missing")
+	if err == nil {
+		t.Error("Unexpected nil error for missing file")
+	}
+}
@@ -0,0 +1,66 @@
+package rewrite
+
+import (
+	"strings"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+)
+
+// Sender rewrites the envelope sender and the addresses of the From, Sender
+// and Reply-To headers.
+type Sender struct {
+	Rules Rules
+	// ReplyTo adds the original From header as Reply-To header if the From
+	// header is rewritten and the email has no Reply-To header.
+	ReplyTo bool
+}
+
+// Apply returns the rewritten envelope sender and raw email data.
+// Header fields are edited in place, so that folding, encoded display names
+// and the body remain unchanged.
+// A nil Sender returns the unmodified sender and data.
+func (s *Sender) Apply(from string, data []byte) (string, []byte) {
+	if s == nil {
+		return from, data
+	}
+	if from != "" {
+		from, _ = s.Rules.Rewrite(from)
+	}
+	fields, rest := header.Split(data)
+	changed := false
+	hasReplyTo := false
+	var originalFrom []byte
+	fromIndex := -1
+	for i, field := range fields {
+		name := strings.ToLower(field.Name)
+		switch name {
+		case "reply-to":
+			hasReplyTo = true
+		case "from", "sender":
+		default:
+			continue
+		}
+		raw, ok := rewriteField(field, s.Rules.Rewrite)
+		if !ok {
+			continue
+		}
+		if name == "from" && fromIndex < 0 {
+			originalFrom = field.Raw
+			fromIndex = i
+		}
+		fields[i].Raw = raw
+		changed = true
+	}
+	if !changed {
+		return from, data
+	}
+	if s.ReplyTo && fromIndex >= 0 && !hasReplyTo {
+		value := originalFrom[strings.IndexByte(string(originalFrom), ':')+1:]
+		replyTo := header.Field{
+			Name: "Reply-To",
+			Raw:  append([]byte("Reply-To:"), value...),
+		}
+		fields = append(fields[:fromIndex+1], append([]header.Field{replyTo}, fields[fromIndex+1:]...)...)
+	}
+	return from, header.Join(fields, rest)
+}
@@ -0,0 +1,89 @@
+package rewrite
+
+import (
+	"testing"
+)
+
+func testSender(t *testing.T, replyTo bool) *Sender {
+	rule, err := ParseRule("*@*.internal", "noreply@example.org")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	return &Sender{Rules: Rules{rule}, ReplyTo: replyTo}
+}
+
+func TestSenderApply(t *testing.T) {
+	data := []byte("Received: from localhost\r\n" +
+		"From: =?UTF-8?B?w4lxdWlwZSBPcHM=?= <root@host.internal>\r\n" +
+		"Sender: cron@db1.internal (Cron\r\n" +
+		"  Daemon)\r\n" +
+		"Reply-To: ops@example.org, root@host.internal\r\n" +
+		"To: root@host.internal\r\n" +
+		"Subject: =?ISO-8859-1?Q?Caf=E9?=\r\n" +
+		"\r\n" +
+		"From: root@host.internal\r\n")
+	from, out := testSender(t, false).Apply("root@host.internal", data)
+	if from != "noreply@example.org" {
+		t.Errorf("Unexpected from: %s. Expected: %s", from, "noreply@example.org")
+	}
+	expected := "Received: from localhost\r\n" +
+		"From: =?UTF-8?B?w4lxdWlwZSBPcHM=?= <noreply@example.org>\r\n" +
+		"Sender: noreply@example.org (Cron\r\n" +
+		"  Daemon)\r\n" +
+		"Reply-To: ops@example.org, noreply@example.org\r\n" +
+		"To: root@host.internal\r\n" +
+		"Subject: =?ISO-8859-1?Q?Caf=E9?=\r\n" +
+		"\r\n" +
+		"From: root@host.internal\r\n"
+	if string(out) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", out, expected)
+	}
+}
+
+func TestSenderApplyWithReplyTo(t *testing.T) {
+	data := []byte("From: =?KOI8-R?B?8NLP18XSy8E=?= <check@host.internal>\n" +
+		"Subject: Test\n" +
+		"\n" +
+		"TEST")
+	_, out := testSender(t, true).Apply("check@host.internal", data)
+	expected := "From: =?KOI8-R?B?8NLP18XSy8E=?= <noreply@example.org>\n" +
+		"Reply-To: =?KOI8-R?B?8NLP18XSy8E=?= <check@host.internal>\n" +
+		"Subject: Test\n" +
+		"\n" +
+		"TEST"
+	if string(out) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", out, expected)
+	}
+	// An existing Reply-To header is kept:
+	data = []byte("Reply-To: ops@example.org\r\nFrom: check@host.internal\r\n\r\nTEST")
+	_, out = testSender(t, true).Apply("check@host.internal", data)
+	expected = "Reply-To: ops@example.org\r\nFrom: noreply@example.org\r\n\r\nTEST"
+	if string(out) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", out, expected)
+	}
+}
+
+func TestSenderApplyWithQuotedLocalPart(t *testing.T) {
+	data := []byte("From: \"Caf\xc3\xa9\" <\"root user\"@host.internal>\r\n\r\nTEST")
+	_, out := testSender(t, false).Apply("", data)
+	expected := "From: =?utf-8?q?Caf=C3=A9?= <noreply@example.org>\r\n\r\nTEST"
+	if string(out) != expected {
+		t.Errorf("Unexpected data: %q. Expected: %q", out, expected)
+	}
+}
+
+func TestSenderApplyWithoutMatch(t *testing.T) {
+	data := []byte("From: Alice <alice@example.org>\r\nSender: invalid\r\n\r\nTEST")
+	from, out := testSender(t, true).Apply("alice@example.org", data)
+	if from != "alice@example.org" {
+		t.Errorf("Unexpected from: %s. Expected: %s", from, "alice@example.org")
+	}
+	if &out[0] != &data[0] {
+		t.Errorf("Unexpected data copy: %q", out)
+	}
+	var sender *Sender
+	from, out = sender.Apply("root@host.internal", data)
+	if from != "root@host.internal" || string(out) != string(data) {
+		t.Errorf("Unexpected nil sender rewrite: %s, %q", from, out)
+	}
+}
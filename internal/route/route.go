@@ -0,0 +1,121 @@
+/*
+Package route provides the conditions of routing rules, which select the policy
+settings applying to an email by its envelope sender and recipients.
+*/
+package route
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Condition matches emails by envelope sender and recipients.
+type Condition struct {
+	// From matches the envelope sender, if set.
+	From *regexp.Regexp
+	// To matches any of the envelope recipients, if set.
+	To *regexp.Regexp
+}
+
+// Match reports if the condition applies to the given envelope.
+func (c Condition) Match(from string, to []string) bool {
+	if c.From != nil && !c.From.MatchString(from) {
+		return false
+	}
+	if c.To == nil {
+		return true
+	}
+	for _, address := range to {
+		if c.To.MatchString(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSection reports if the line starts a routing rule, e.g. [from /regexp/].
+func IsSection(line string) bool {
+	return strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]")
+}
+
+// ParseSection parses the condition of a routing rule line like
+// [from /regexp/ to /regexp/], of which either part can be omitted.
+// A regular expression ends at the first slash followed by whitespace or the
+// end of the line, so it can contain spaces, e.g. [from /^Jane Doe/], while
+// such slashes within it have to be escaped as \/.
+func ParseSection(line string) (c Condition, err error) {
+	rest := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
+	if rest == "" {
+		return c, errors.New("expected from and/or to conditions")
+	}
+	for rest != "" {
+		var name, pattern string
+		name, rest = cutField(rest)
+		pattern, rest = cutPattern(rest)
+		if pattern == "" {
+			return c, errors.New("expected from and/or to conditions")
+		}
+		re, err := ParsePattern(pattern)
+		if err != nil {
+			return c, err
+		}
+		switch name {
+		case "from":
+			c.From = re
+		case "to":
+			c.To = re
+		default:
+			return c, errors.New("invalid condition: " + name)
+		}
+	}
+	return c, nil
+}
+
+// cutField returns the first whitespace-separated field of s and the
+// remainder without leading whitespace.
+func cutField(s string) (field string, rest string) {
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimLeftFunc(s[i:], unicode.IsSpace)
+}
+
+// cutPattern returns the leading regular expression enclosed in slashes of s,
+// which ends at the first slash followed by whitespace or the end of s, and
+// the remainder without leading whitespace.
+// Other strings are cut like fields.
+func cutPattern(s string) (pattern string, rest string) {
+	if !strings.HasPrefix(s, "/") {
+		return cutField(s)
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] != '/' || s[i-1] == '\\' {
+			continue
+		}
+		if i+1 == len(s) {
+			return s, ""
+		}
+		if r, _ := utf8.DecodeRuneInString(s[i+1:]); unicode.IsSpace(r) {
+			return s[:i+1], strings.TrimLeftFunc(s[i+1:], unicode.IsSpace)
+		}
+	}
+	return s, ""
+}
+
+// IsPattern reports if the string is a regular expression enclosed in
+// slashes.
+func IsPattern(s string) bool {
+	return len(s) > 2 && strings.HasPrefix(s, "/") && strings.HasSuffix(s, "/")
+}
+
+// ParsePattern compiles a regular expression enclosed in slashes.
+func ParsePattern(s string) (*regexp.Regexp, error) {
+	if !IsPattern(s) {
+		return nil, errors.New("expected regular expression enclosed in slashes: " + s)
+	}
+	return regexp.Compile(s[1 : len(s)-1])
+}
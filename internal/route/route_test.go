@@ -0,0 +1,71 @@
+package route
+
+import (
+	"testing"
+)
+
+func TestParseSection(t *testing.T) {
+	c, err := ParseSection(`[from /@billing\.example\.org$/ to /@example\.com$/]`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, test := range []struct {
+		from     string
+		to       []string
+		expected bool
+	}{
+		{"alice@billing.example.org", []string{"bob@example.org", "carol@example.com"}, true},
+		{"alice@billing.example.org", []string{"bob@example.org"}, false},
+		{"alice@example.org", []string{"carol@example.com"}, false},
+	} {
+		if match := c.Match(test.from, test.to); match != test.expected {
+			t.Errorf("Unexpected match for %s %v: %t. Expected: %t", test.from, test.to, match, test.expected)
+		}
+	}
+	c, _ = ParseSection(`[to /@example\.com$/]`)
+	if !c.Match("", []string{"carol@example.com"}) {
+		t.Error("Unexpected mismatch for recipient condition")
+	}
+	if !(Condition{}).Match("alice@example.org", nil) {
+		t.Error("Unexpected mismatch for empty condition")
+	}
+}
+
+func TestParseSectionWithSpaces(t *testing.T) {
+	c, err := ParseSection(`[from /^Jane Doe|a\/ b/  to /@example\.com$/ ]`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if c.From == nil || c.From.String() != `^Jane Doe|a\/ b` {
+		t.Errorf("Unexpected from pattern: %v. Expected: %s", c.From, `^Jane Doe|a\/ b`)
+	}
+	if c.To == nil || c.To.String() != `@example\.com$` {
+		t.Errorf("Unexpected to pattern: %v. Expected: %s", c.To, `@example\.com$`)
+	}
+	if !c.Match("Jane Doe <jane@example.org>", []string{"bob@example.com"}) {
+		t.Error("Unexpected mismatch for pattern with space")
+	}
+}
+
+func TestParseSectionWithInvalidCondition(t *testing.T) {
+	for _, line := range []string{
+		"[]",
+		"[from]",
+		"[subject /test/]",
+		"[from @example.org]",
+		"[from /(/]",
+		"[from /a/ to]",
+		"[from /a/b/ /c/]",
+	} {
+		_, err := ParseSection(line)
+		if err == nil {
+			t.Errorf("Unexpected nil error for %s", line)
+		}
+	}
+}
+
+func TestIsSection(t *testing.T) {
+	if !IsSection("[from /a/]") || IsSection("remove X-Test") {
+		t.Error("Unexpected section detection")
+	}
+}
@@ -0,0 +1,62 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// chunkSize is the maximum size of the data chunks streamed to clamd.
+const chunkSize = 64 * 1024
+
+// Clamd scans emails with the INSTREAM command of a ClamAV daemon.
+type Clamd struct {
+	// Network is either tcp or unix.
+	Network string
+	Address string
+	// Timeout limits the duration of each scan (0: unlimited).
+	Timeout time.Duration
+}
+
+// Scan streams the data to clamd and returns the name of the found signature,
+// e.g. Eicar-Signature.
+func (c *Clamd) Scan(ctx context.Context, data []byte) (string, error) {
+	conn, err := dial(ctx, c.Network, c.Address, c.Timeout)
+	if err != nil {
+		return "", errors.New("clamd: " + err.Error())
+	}
+	defer conn.Close()
+	writer := bufio.NewWriterSize(conn, chunkSize+4)
+	writer.WriteString("zINSTREAM\x00")
+	size := make([]byte, 4)
+	for len(data) > 0 {
+		chunk := data[:min(len(data), chunkSize)]
+		data = data[len(chunk):]
+		binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+		writer.Write(size)
+		writer.Write(chunk)
+	}
+	// A zero-length chunk marks the end of the stream:
+	binary.BigEndian.PutUint32(size, 0)
+	writer.Write(size)
+	if err := writer.Flush(); err != nil {
+		return "", errors.New("clamd: " + err.Error())
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && (err != io.EOF || reply == "") {
+		return "", errors.New("clamd: " + err.Error())
+	}
+	// Replies look like "stream: OK" or "stream: Eicar-Signature FOUND":
+	reply = strings.TrimPrefix(strings.TrimRight(reply, "\x00\n"), "stream: ")
+	if reply == "OK" {
+		return "", nil
+	}
+	if threat, found := strings.CutSuffix(reply, " FOUND"); found {
+		return threat, nil
+	}
+	return "", errors.New("clamd: " + reply)
+}
@@ -0,0 +1,138 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eicar is the EICAR anti-malware test string.
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd serves INSTREAM commands like clamd, reporting the EICAR test
+// string as Eicar-Signature and streams larger than maxSize as error.
+// The received streams are sent to the returned channel.
+func fakeClamd(t *testing.T, ln net.Listener, maxSize int) <-chan []byte {
+	streams := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			command, _ := reader.ReadString(0)
+			var stream []byte
+			reply := "stream: OK"
+			if command != "zINSTREAM\x00" {
+				reply = "UNKNOWN COMMAND"
+			}
+			for command == "zINSTREAM\x00" {
+				size := make([]byte, 4)
+				if _, err := io.ReadFull(reader, size); err != nil {
+					break
+				}
+				n := binary.BigEndian.Uint32(size)
+				if n == 0 {
+					break
+				}
+				chunk := make([]byte, n)
+				io.ReadFull(reader, chunk)
+				stream = append(stream, chunk...)
+			}
+			if len(stream) > maxSize {
+				reply = "INSTREAM size limit exceeded. ERROR"
+			} else if bytes.Contains(stream, []byte(eicar)) {
+				reply = "stream: Eicar-Signature FOUND"
+			}
+			streams <- stream
+			conn.Write([]byte(reply + "\x00"))
+			conn.Close()
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return streams
+}
+
+func TestClamdScan(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams := fakeClamd(t, ln, 1<<20)
+	clamd := &Clamd{Network: "tcp", Address: ln.Addr().String(), Timeout: time.Second}
+	// Larger than a single chunk:
+	data := []byte("Subject: Test\r\n\r\n" + strings.Repeat("TEST\r\n", 20000))
+	threat, err := clamd.Scan(context.Background(), data)
+	if err != nil || threat != "" {
+		t.Errorf("Unexpected result: %q %v", threat, err)
+	}
+	if stream := <-streams; !bytes.Equal(stream, data) {
+		t.Errorf("Unexpected stream size: %d. Expected: %d", len(stream), len(data))
+	}
+	threat, err = clamd.Scan(context.Background(), []byte("Subject: Test\r\n\r\n"+eicar))
+	if err != nil || threat != "Eicar-Signature" {
+		t.Errorf("Unexpected result: %q %v. Expected: %s", threat, err, "Eicar-Signature")
+	}
+	<-streams
+}
+
+func TestClamdScanWithUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clamd.ctl")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeClamd(t, ln, 1<<20)
+	clamd := &Clamd{Network: "unix", Address: path}
+	threat, err := clamd.Scan(context.Background(), []byte(eicar))
+	if err != nil || threat != "Eicar-Signature" {
+		t.Errorf("Unexpected result: %q %v. Expected: %s", threat, err, "Eicar-Signature")
+	}
+}
+
+func TestClamdScanWithError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fakeClamd(t, ln, 10)
+	clamd := &Clamd{Network: "tcp", Address: ln.Addr().String()}
+	_, err = clamd.Scan(context.Background(), []byte("Subject: Test\r\n\r\nTEST"))
+	expected := "clamd: INSTREAM size limit exceeded. ERROR"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, expected)
+	}
+	ln.Close()
+	_, err = clamd.Scan(context.Background(), []byte("Subject: Test\r\n\r\nTEST"))
+	if err == nil || !strings.HasPrefix(err.Error(), "clamd: ") {
+		t.Errorf("Unexpected error: %v. Expected: clamd: ...", err)
+	}
+}
+
+func TestClamdScanWithTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		// Accept the connection without replying:
+		conn, err := ln.Accept()
+		if err == nil {
+			io.Copy(io.Discard, conn)
+		}
+	}()
+	clamd := &Clamd{Network: "tcp", Address: ln.Addr().String(), Timeout: 50 * time.Millisecond}
+	_, err = clamd.Scan(context.Background(), []byte("Subject: Test\r\n\r\nTEST"))
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("Unexpected error: %v. Expected: timeout", err)
+	}
+}
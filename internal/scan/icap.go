@@ -0,0 +1,93 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ICAP scans emails with RESPMOD requests (RFC 3507) to an ICAP service, e.g.
+// c-icap with the virus scan module.
+type ICAP struct {
+	// URL is the service URL, e.g. icap://localhost:1344/avscan.
+	URL *url.URL
+	// Timeout limits the duration of each scan (0: unlimited).
+	Timeout time.Duration
+}
+
+// Scan sends the data as encapsulated HTTP response body to the ICAP service.
+// Unmodified data (204 No Content) is clean, while modified data means a
+// threat was found, which is named by the X-Infection-Found or X-Virus-ID
+// header of the response.
+func (i *ICAP) Scan(ctx context.Context, data []byte) (string, error) {
+	address := i.URL.Host
+	if i.URL.Port() == "" {
+		address = net.JoinHostPort(i.URL.Hostname(), "1344")
+	}
+	conn, err := dial(ctx, "tcp", address, i.Timeout)
+	if err != nil {
+		return "", errors.New("ICAP: " + err.Error())
+	}
+	defer conn.Close()
+	httpHeader := "HTTP/1.1 200 OK\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"Content-Length: " + strconv.Itoa(len(data)) + "\r\n" +
+		"\r\n"
+	writer := bufio.NewWriter(conn)
+	writer.WriteString("RESPMOD " + i.URL.String() + " ICAP/1.0\r\n" +
+		"Host: " + i.URL.Host + "\r\n" +
+		"Allow: 204\r\n" +
+		"Encapsulated: res-hdr=0, res-body=" + strconv.Itoa(len(httpHeader)) + "\r\n" +
+		"\r\n" +
+		httpHeader)
+	// The body is sent as single chunk with chunked transfer encoding:
+	if len(data) > 0 {
+		writer.WriteString(strconv.FormatInt(int64(len(data)), 16) + "\r\n")
+		writer.Write(data)
+		writer.WriteString("\r\n")
+	}
+	writer.WriteString("0\r\n\r\n")
+	if err := writer.Flush(); err != nil {
+		return "", errors.New("ICAP: " + err.Error())
+	}
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	status, err := reader.ReadLine()
+	if err != nil {
+		return "", errors.New("ICAP: " + err.Error())
+	}
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		return "", errors.New("ICAP: " + err.Error())
+	}
+	fields := strings.Fields(status)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "ICAP/") {
+		return "", errors.New("ICAP: invalid response: " + status)
+	}
+	switch fields[1] {
+	case "204":
+		return "", nil
+	case "200":
+		return threat(header), nil
+	}
+	return "", errors.New("ICAP: " + status)
+}
+
+// threat returns the threat name of the ICAP response header, e.g. from
+// "X-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Signature;".
+func threat(header textproto.MIMEHeader) string {
+	for _, param := range strings.Split(header.Get("X-Infection-Found"), ";") {
+		if name, found := strings.CutPrefix(strings.TrimSpace(param), "Threat="); found {
+			return name
+		}
+	}
+	if name := header.Get("X-Virus-ID"); name != "" {
+		return name
+	}
+	return "unknown threat"
+}
@@ -0,0 +1,109 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeICAP answers RESPMOD requests with the given response for data
+// containing the EICAR test string and 204 No Content otherwise.
+// The received encapsulated bodies are sent to the returned channel.
+func fakeICAP(t *testing.T, response string) (*url.URL, <-chan []byte) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	bodies := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			reader := textproto.NewReader(bufio.NewReader(conn))
+			reader.ReadLine()
+			header, _ := reader.ReadMIMEHeader()
+			// Skip the encapsulated HTTP header:
+			offset, _ := strconv.Atoi(strings.TrimPrefix(
+				strings.Split(header.Get("Encapsulated"), ", ")[1], "res-body="))
+			io.ReadFull(reader.R, make([]byte, offset))
+			var body []byte
+			for {
+				line, _ := reader.ReadLine()
+				size, err := strconv.ParseInt(line, 16, 64)
+				if err != nil || size == 0 {
+					break
+				}
+				chunk := make([]byte, size+2)
+				io.ReadFull(reader.R, chunk)
+				body = append(body, chunk[:size]...)
+			}
+			bodies <- body
+			if bytes.Contains(body, []byte(eicar)) {
+				conn.Write([]byte(response))
+			} else {
+				conn.Write([]byte("ICAP/1.0 204 No Content\r\nISTag: \"test\"\r\n\r\n"))
+			}
+			conn.Close()
+		}
+	}()
+	u, _ := url.Parse("icap://" + ln.Addr().String() + "/avscan")
+	return u, bodies
+}
+
+func TestICAPScan(t *testing.T) {
+	u, bodies := fakeICAP(t, "ICAP/1.0 200 OK\r\n"+
+		"ISTag: \"test\"\r\n"+
+		"X-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Signature;\r\n"+
+		"Encapsulated: res-hdr=0, res-body=100\r\n\r\n")
+	icap := &ICAP{URL: u}
+	data := []byte("Subject: Test\r\n\r\nTEST")
+	threat, err := icap.Scan(context.Background(), data)
+	if err != nil || threat != "" {
+		t.Errorf("Unexpected result: %q %v", threat, err)
+	}
+	if body := <-bodies; !bytes.Equal(body, data) {
+		t.Errorf("Unexpected body: %q. Expected: %q", body, data)
+	}
+	threat, err = icap.Scan(context.Background(), []byte(eicar))
+	if err != nil || threat != "Eicar-Signature" {
+		t.Errorf("Unexpected result: %q %v. Expected: %s", threat, err, "Eicar-Signature")
+	}
+}
+
+func TestICAPScanWithVirusID(t *testing.T) {
+	u, _ := fakeICAP(t, "ICAP/1.0 200 OK\r\nX-Virus-ID: EICAR\r\n\r\n")
+	threat, err := (&ICAP{URL: u}).Scan(context.Background(), []byte(eicar))
+	if err != nil || threat != "EICAR" {
+		t.Errorf("Unexpected result: %q %v. Expected: %s", threat, err, "EICAR")
+	}
+	u, _ = fakeICAP(t, "ICAP/1.0 200 OK\r\n\r\n")
+	threat, err = (&ICAP{URL: u}).Scan(context.Background(), []byte(eicar))
+	if err != nil || threat != "unknown threat" {
+		t.Errorf("Unexpected result: %q %v. Expected: %s", threat, err, "unknown threat")
+	}
+}
+
+func TestICAPScanWithError(t *testing.T) {
+	u, _ := fakeICAP(t, "ICAP/1.0 500 Server Error\r\n\r\n")
+	_, err := (&ICAP{URL: u}).Scan(context.Background(), []byte(eicar))
+	expected := "ICAP: ICAP/1.0 500 Server Error"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, expected)
+	}
+	u, _ = fakeICAP(t, "HTTP/1.1 200 OK\r\n\r\n")
+	_, err = (&ICAP{URL: u}).Scan(context.Background(), []byte(eicar))
+	expected = "ICAP: invalid response: HTTP/1.1 200 OK"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, expected)
+	}
+}
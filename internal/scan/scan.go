@@ -0,0 +1,120 @@
+/*
+Package scan provides malware scanning of raw email data via a ClamAV daemon or
+an ICAP service.
+*/
+package scan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/message"
+)
+
+// ErrScanFailed is returned for failed scans unless the hook fails open.
+// It is passed to the client as temporary SMTP error, which causes a retry.
+var ErrScanFailed = errors.New("451 4.7.0 Content scan failed, try again later")
+
+// Scanner scans raw email data for malware.
+type Scanner interface {
+	// Scan returns the name of the threat found in the data or an empty string
+	// if the data is clean.
+	Scan(ctx context.Context, data []byte) (string, error)
+}
+
+// New creates a Scanner for the given URL, which is either a clamd URL like
+// clamd://localhost:3310 or clamd:///var/run/clamav/clamd.ctl (unix socket) or
+// an ICAP service URL like icap://localhost:1344/avscan.
+// The timeout limits the duration of each scan (0: unlimited).
+func New(rawURL string, timeout time.Duration) (Scanner, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "clamd":
+		if u.Host != "" {
+			address := u.Host
+			if u.Port() == "" {
+				address = net.JoinHostPort(u.Hostname(), "3310")
+			}
+			return &Clamd{Network: "tcp", Address: address, Timeout: timeout}, nil
+		}
+		if u.Path == "" {
+			return nil, errors.New("missing clamd address: " + rawURL)
+		}
+		return &Clamd{Network: "unix", Address: u.Path, Timeout: timeout}, nil
+	case "icap":
+		if u.Host == "" {
+			return nil, errors.New("missing ICAP server address: " + rawURL)
+		}
+		return &ICAP{URL: u, Timeout: timeout}, nil
+	}
+	return nil, errors.New("invalid scanner URL scheme: " + u.Scheme)
+}
+
+// Hook scans emails before they are relayed.
+type Hook struct {
+	Scanner Scanner
+	// FailOpen relays emails which could not be scanned instead of rejecting
+	// them with ErrScanFailed.
+	FailOpen bool
+}
+
+// Result describes the outcome of a scan.
+type Result struct {
+	// Threat is the name of the threat found, if any.
+	Threat string
+	// Error is the error of a failed scan, even if the hook fails open.
+	Error error
+}
+
+// Check scans the raw data and rejects infected emails with a
+// message.RejectError and failed scans with ErrScanFailed, unless the hook
+// fails open.
+// A nil Hook accepts all emails.
+func (h *Hook) Check(ctx context.Context, data []byte) (Result, error) {
+	var result Result
+	if h == nil {
+		return result, nil
+	}
+	result.Threat, result.Error = h.Scanner.Scan(ctx, data)
+	if result.Error != nil {
+		if h.FailOpen {
+			return result, nil
+		}
+		return result, ErrScanFailed
+	}
+	if result.Threat != "" {
+		return result, &message.RejectError{
+			Status: "5.7.1",
+			// The threat name is reported by the scanner for the untrusted data:
+			Reason: "Message rejected: malware found: " + message.Sanitize(result.Threat),
+		}
+	}
+	return result, nil
+}
+
+// dial connects to the address with the timeout, which also applies as
+// deadline to the returned connection.
+func dial(ctx context.Context, network string, address string, timeout time.Duration) (
+	net.Conn,
+	error,
+) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	conn, err := new(net.Dialer).DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
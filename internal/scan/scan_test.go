@@ -0,0 +1,81 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type mockScanner struct {
+	threat string
+	err    error
+}
+
+func (s mockScanner) Scan(ctx context.Context, data []byte) (string, error) {
+	return s.threat, s.err
+}
+
+func TestNew(t *testing.T) {
+	for rawURL, expected := range map[string]Scanner{
+		"clamd://localhost:3310":            &Clamd{Network: "tcp", Address: "localhost:3310", Timeout: time.Second},
+		"clamd://localhost":                 &Clamd{Network: "tcp", Address: "localhost:3310", Timeout: time.Second},
+		"clamd:///var/run/clamav/clamd.ctl": &Clamd{Network: "unix", Address: "/var/run/clamav/clamd.ctl", Timeout: time.Second},
+	} {
+		scanner, err := New(rawURL, time.Second)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %s", rawURL, err)
+		} else if *scanner.(*Clamd) != *expected.(*Clamd) {
+			t.Errorf("Unexpected scanner for %s: %+v. Expected: %+v", rawURL, scanner, expected)
+		}
+	}
+	scanner, err := New("icap://localhost:1344/avscan", time.Second)
+	if icap, ok := scanner.(*ICAP); !ok || err != nil || icap.URL.Path != "/avscan" {
+		t.Errorf("Unexpected ICAP scanner: %+v %v", scanner, err)
+	}
+	for _, rawURL := range []string{"clamd://", "icap:///avscan", "http://localhost", ":"} {
+		if _, err := New(rawURL, 0); err == nil {
+			t.Errorf("Unexpected nil error for %s", rawURL)
+		}
+	}
+}
+
+func TestHookCheck(t *testing.T) {
+	hook := &Hook{Scanner: mockScanner{}}
+	result, err := hook.Check(context.Background(), nil)
+	if err != nil || result != (Result{}) {
+		t.Errorf("Unexpected result: %+v %v", result, err)
+	}
+	hook = &Hook{Scanner: mockScanner{threat: "Eicar-Signature"}}
+	result, err = hook.Check(context.Background(), nil)
+	expected := "554 5.7.1 Message rejected: malware found: Eicar-Signature"
+	if err == nil || err.Error() != expected || result.Threat != "Eicar-Signature" {
+		t.Errorf("Unexpected result: %+v %v. Expected: %s", result, err, expected)
+	}
+	// Threat names from the scanner are sanitized for the SMTP reply:
+	hook = &Hook{Scanner: mockScanner{threat: "Evil%s\r\n250 OK"}}
+	_, err = hook.Check(context.Background(), nil)
+	expected = "554 5.7.1 Message rejected: malware found: Evil?s 250 OK"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: %q. Expected: %q", err, expected)
+	}
+	var nilHook *Hook
+	result, err = nilHook.Check(context.Background(), nil)
+	if err != nil || result != (Result{}) {
+		t.Errorf("Unexpected nil hook result: %+v %v", result, err)
+	}
+}
+
+func TestHookCheckWithFailure(t *testing.T) {
+	failure := errors.New("clamd: connection refused")
+	hook := &Hook{Scanner: mockScanner{err: failure}}
+	result, err := hook.Check(context.Background(), nil)
+	if err != ErrScanFailed || result.Error != failure {
+		t.Errorf("Unexpected result: %+v %v. Expected: %s", result, err, ErrScanFailed)
+	}
+	hook.FailOpen = true
+	result, err = hook.Check(context.Background(), nil)
+	if err != nil || result.Error != failure {
+		t.Errorf("Unexpected fail-open result: %+v %v", result, err)
+	}
+}
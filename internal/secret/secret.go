@@ -0,0 +1,159 @@
+/*
+Package secret resolves secrets given as environment variables, files named by
+environment variables with _FILE suffix, e.g. Docker and Kubernetes secrets,
+and references to AWS Systems Manager parameters or Secrets Manager secrets.
+*/
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// Reference prefixes, e.g. "ssm:/relay/password" for an SSM parameter or
+// "secretsmanager:relay#password" for the password key of a JSON secret.
+const (
+	SSMPrefix            = "ssm:"
+	SecretsManagerPrefix = "secretsmanager:"
+)
+
+// FileSuffix is the suffix of environment variables naming secret files.
+const FileSuffix = "_FILE"
+
+// SSMClient is the subset of the Systems Manager API used to resolve
+// parameter references.
+type SSMClient interface {
+	GetParameter(context.Context, *ssm.GetParameterInput, ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// SecretsManagerClient is the subset of the Secrets Manager API used to
+// resolve secret references.
+type SecretsManagerClient interface {
+	GetSecretValue(context.Context, *secretsmanager.GetSecretValueInput, ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// Resolver resolves secrets, creating the AWS clients only for references.
+type Resolver struct {
+	SSM            func(context.Context) (SSMClient, error)
+	SecretsManager func(context.Context) (SecretsManagerClient, error)
+}
+
+// NewResolver creates a Resolver with AWS clients for the default AWS
+// configuration.
+func NewResolver() *Resolver {
+	return &Resolver{
+		SSM: func(ctx context.Context) (SSMClient, error) {
+			cfg, err := config.LoadDefaultConfig(ctx)
+			return ssm.NewFromConfig(cfg), err
+		},
+		SecretsManager: func(ctx context.Context) (SecretsManagerClient, error) {
+			cfg, err := config.LoadDefaultConfig(ctx)
+			return secretsmanager.NewFromConfig(cfg), err
+		},
+	}
+}
+
+// Lookup returns the secret of the environment variable with the given key.
+func (r *Resolver) Lookup(ctx context.Context, key string) (string, error) {
+	return r.Value(ctx, key, os.Getenv(key))
+}
+
+// Value returns the secret given for the key, e.g. by an option, with
+// references resolved, or the content of the file named by the environment
+// variable with the key and _FILE suffix if the value is empty.
+// Setting both is an error, as it is ambiguous which secret is used.
+func (r *Resolver) Value(ctx context.Context, key string, value string) (string, error) {
+	if path := os.Getenv(key + FileSuffix); path != "" {
+		if value != "" {
+			return "", errors.New(key + " and " + key + FileSuffix + " are mutually exclusive")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", errors.New(key + FileSuffix + ": " + err.Error())
+		}
+		// Secret files are commonly created with a trailing newline:
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	secret, err := r.Resolve(ctx, value)
+	if err != nil {
+		return "", errors.New(key + ": " + err.Error())
+	}
+	return secret, nil
+}
+
+// Resolve returns the secret referenced by the value, or the value itself if
+// it is no reference.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	if name, ok := strings.CutPrefix(value, SSMPrefix); ok {
+		return r.parameter(ctx, name)
+	}
+	if name, ok := strings.CutPrefix(value, SecretsManagerPrefix); ok {
+		return r.secret(ctx, name)
+	}
+	return value, nil
+}
+
+// parameter returns the decrypted value of the SSM parameter.
+func (r *Resolver) parameter(ctx context.Context, name string) (string, error) {
+	if name == "" {
+		return "", errors.New("missing SSM parameter name")
+	}
+	client, err := r.SSM(ctx)
+	if err != nil {
+		return "", err
+	}
+	out, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           &name,
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.Parameter == nil || out.Parameter.Value == nil {
+		return "", errors.New("empty SSM parameter: " + name)
+	}
+	return *out.Parameter.Value, nil
+}
+
+// secret returns the value of the secret, or of the given key of a JSON
+// secret, e.g. "relay#password".
+func (r *Resolver) secret(ctx context.Context, name string) (string, error) {
+	name, key, hasKey := strings.Cut(name, "#")
+	if name == "" {
+		return "", errors.New("missing secret name")
+	}
+	client, err := r.SecretsManager(ctx)
+	if err != nil {
+		return "", err
+	}
+	out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: &name,
+	})
+	if err != nil {
+		return "", err
+	}
+	value := string(out.SecretBinary)
+	if out.SecretString != nil {
+		value = *out.SecretString
+	}
+	if !hasKey {
+		return value, nil
+	}
+	var values map[string]any
+	if err := json.Unmarshal([]byte(value), &values); err != nil {
+		return "", errors.New("secret " + name + " is no JSON object")
+	}
+	secret, ok := values[key].(string)
+	if !ok {
+		return "", errors.New("secret " + name + " has no string key " + key)
+	}
+	return secret, nil
+}
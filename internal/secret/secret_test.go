@@ -0,0 +1,153 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+type mockSSM map[string]string
+
+func (m mockSSM) GetParameter(
+	_ context.Context,
+	input *ssm.GetParameterInput,
+	_ ...func(*ssm.Options),
+) (*ssm.GetParameterOutput, error) {
+	if !aws.ToBool(input.WithDecryption) {
+		return nil, errors.New("missing decryption")
+	}
+	value, ok := m[*input.Name]
+	if !ok {
+		return nil, &ssmtypes.ParameterNotFound{Message: aws.String("parameter not found")}
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssmtypes.Parameter{Value: &value}}, nil
+}
+
+type mockSecretsManager map[string]string
+
+func (m mockSecretsManager) GetSecretValue(
+	_ context.Context,
+	input *secretsmanager.GetSecretValueInput,
+	_ ...func(*secretsmanager.Options),
+) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := m[*input.SecretId]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	if value == "binary" {
+		return &secretsmanager.GetSecretValueOutput{SecretBinary: []byte(value)}, nil
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: &value}, nil
+}
+
+func resolver() *Resolver {
+	return &Resolver{
+		SSM: func(context.Context) (SSMClient, error) {
+			return mockSSM{"/relay/password": "ssm-secret"}, nil
+		},
+		SecretsManager: func(context.Context) (SecretsManagerClient, error) {
+			return mockSecretsManager{
+				"relay":  `{"password":"json-secret","port":25}`,
+				"plain":  "plain-secret",
+				"binary": "binary",
+			}, nil
+		},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	r := resolver()
+	for _, test := range []struct {
+		value  string
+		secret string
+		err    string
+	}{
+		{"", "", ""},
+		{"literal", "literal", ""},
+		{"ssm:/relay/password", "ssm-secret", ""},
+		{"ssm:/relay/missing", "", "ParameterNotFound: parameter not found"},
+		{"ssm:", "", "missing SSM parameter name"},
+		{"secretsmanager:plain", "plain-secret", ""},
+		{"secretsmanager:binary", "binary", ""},
+		{"secretsmanager:relay#password", "json-secret", ""},
+		{"secretsmanager:relay#port", "", "secret relay has no string key port"},
+		{"secretsmanager:plain#password", "", "secret plain is no JSON object"},
+		{"secretsmanager:missing", "", "secret not found"},
+		{"secretsmanager:#password", "", "missing secret name"},
+	} {
+		secret, err := r.Resolve(context.Background(), test.value)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Unexpected error for %s: %v. Expected: %s", test.value, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %s", test.value, err)
+		}
+		if secret != test.secret {
+			t.Errorf("Unexpected secret: %s. Expected: %s", secret, test.secret)
+		}
+	}
+}
+
+func TestResolveWithClientError(t *testing.T) {
+	r := &Resolver{
+		SSM: func(context.Context) (SSMClient, error) {
+			return nil, errors.New("invalid AWS config")
+		},
+	}
+	_, err := r.Resolve(context.Background(), "ssm:/relay/password")
+	if err == nil || err.Error() != "invalid AWS config" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	r := resolver()
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET", "ssm:/relay/password")
+	secret, err := r.Lookup(context.Background(), "TEST_SECRET")
+	if err != nil || secret != "ssm-secret" {
+		t.Errorf("Unexpected secret: %s %v. Expected: ssm-secret", secret, err)
+	}
+	t.Setenv("TEST_SECRET_FILE", file)
+	_, err = r.Lookup(context.Background(), "TEST_SECRET")
+	expected := "TEST_SECRET and TEST_SECRET_FILE are mutually exclusive"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, expected)
+	}
+	t.Setenv("TEST_SECRET", "")
+	secret, err = r.Lookup(context.Background(), "TEST_SECRET")
+	if err != nil || secret != "file-secret" {
+		t.Errorf("Unexpected secret: %s %v. Expected: file-secret", secret, err)
+	}
+	if err := os.WriteFile(file, []byte("secretsmanager:relay#password\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// References are only resolved in values, not in files:
+	secret, err = r.Lookup(context.Background(), "TEST_SECRET")
+	if err != nil || secret != "secretsmanager:relay#password" {
+		t.Errorf("Unexpected secret: %s %v. Expected: secretsmanager:relay#password", secret, err)
+	}
+	t.Setenv("TEST_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+	if _, err = r.Lookup(context.Background(), "TEST_SECRET"); err == nil {
+		t.Error("Unexpected nil error for missing file")
+	}
+	t.Setenv("TEST_SECRET_FILE", "")
+	_, err = r.Value(context.Background(), "TEST_SECRET", "ssm:/relay/missing")
+	expected = "TEST_SECRET: ParameterNotFound: parameter not found"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, expected)
+	}
+}
@@ -0,0 +1,179 @@
+package sns
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/logger"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/suppression"
+)
+
+// maxBodySize is the maximum size of SNS message payloads (256 KiB plus the
+// JSON envelope).
+const maxBodySize = 512 * 1024
+
+// notification is an SES bounce or complaint notification, either published
+// as identity notification (notificationType) or as configuration set event
+// (eventType).
+type notification struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Bounce           struct {
+		BounceType        string `json:"bounceType"`
+		BounceSubType     string `json:"bounceSubType"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+	} `json:"bounce"`
+	Complaint struct {
+		ComplaintFeedbackType string `json:"complaintFeedbackType"`
+		ComplainedRecipients  []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+	} `json:"complaint"`
+}
+
+// Handler adds the recipients of hard bounces and complaints posted by SNS to
+// the suppression list and confirms subscriptions to the allowed topics.
+type Handler struct {
+	Store    *suppression.Store
+	Verifier *Verifier
+	// TopicARNs are the allowed topics (empty: all).
+	TopicARNs []string
+	// TTL is the duration after which added entries expire (0: never).
+	TTL time.Duration
+	Log *slog.Logger
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var m Message
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&m); err != nil {
+		h.reject(w, http.StatusBadRequest, "invalid JSON body", &m)
+		return
+	}
+	if !h.allowed(m.TopicArn) {
+		h.reject(w, http.StatusForbidden, "topic not allowed", &m)
+		return
+	}
+	if err := h.Verifier.Verify(r.Context(), &m); err != nil {
+		h.reject(w, http.StatusForbidden, err.Error(), &m)
+		return
+	}
+	switch m.Type {
+	case "SubscriptionConfirmation":
+		err := checkURL(m.SubscribeURL)
+		if err == nil {
+			_, err = h.Verifier.get(r.Context(), m.SubscribeURL)
+		}
+		if err != nil {
+			h.reject(w, http.StatusBadGateway, "subscription confirmation failed: "+err.Error(), &m)
+			return
+		}
+		h.Log.Info("sns subscription confirmed", "topic_arn", m.TopicArn)
+	case "Notification":
+		if err := h.record(r.Context(), m.Message); err != nil {
+			h.reject(w, http.StatusInternalServerError, err.Error(), &m)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) allowed(topicARN string) bool {
+	if len(h.TopicARNs) == 0 {
+		return true
+	}
+	for _, allowed := range h.TopicARNs {
+		if topicARN == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// record adds the recipients of hard bounce and complaint notifications to
+// the suppression list and ignores other notifications.
+func (h *Handler) record(ctx context.Context, message string) error {
+	var n notification
+	if err := json.Unmarshal([]byte(message), &n); err != nil {
+		// Other messages published to the topic are ignored:
+		return nil
+	}
+	kind := n.NotificationType
+	if kind == "" {
+		kind = n.EventType
+	}
+	var entries []suppression.Entry
+	switch kind {
+	case "Bounce":
+		if n.Bounce.BounceType != "Permanent" {
+			return nil
+		}
+		for _, recipient := range n.Bounce.BouncedRecipients {
+			reason := "bounce: " + n.Bounce.BounceType + "/" + n.Bounce.BounceSubType
+			if recipient.DiagnosticCode != "" {
+				reason += ": " + recipient.DiagnosticCode
+			}
+			entries = append(entries, suppression.Entry{
+				Address: recipient.EmailAddress,
+				Reason:  reason,
+			})
+		}
+	case "Complaint":
+		reason := "complaint"
+		if n.Complaint.ComplaintFeedbackType != "" {
+			reason += ": " + n.Complaint.ComplaintFeedbackType
+		}
+		for _, recipient := range n.Complaint.ComplainedRecipients {
+			entries = append(entries, suppression.Entry{
+				Address: recipient.EmailAddress,
+				Reason:  reason,
+			})
+		}
+	}
+	for _, entry := range entries {
+		if h.TTL > 0 {
+			entry.Expires = time.Now().Add(h.TTL).UTC()
+		}
+		// Addresses with display names are suppressed by their address:
+		address, err := mail.ParseAddress(entry.Address)
+		if err != nil {
+			h.Log.Warn("sns recipient ignored",
+				logger.FieldTo, entry.Address,
+				logger.FieldError, err.Error(),
+			)
+			continue
+		}
+		entry.Address = address.Address
+		entry, err = h.Store.Add(entry)
+		if err != nil {
+			return err
+		}
+		h.Log.LogAttrs(ctx, slog.LevelInfo, "suppression added",
+			slog.String(logger.FieldTo, entry.Address),
+			slog.String("reason", entry.Reason),
+		)
+	}
+	return nil
+}
+
+// reject logs the rejected message and writes the error response.
+func (h *Handler) reject(w http.ResponseWriter, status int, reason string, m *Message) {
+	h.Log.Warn("sns message rejected",
+		"topic_arn", m.TopicArn,
+		"sns_message_id", m.MessageId,
+		logger.FieldError, reason,
+	)
+	http.Error(w, reason, status)
+}
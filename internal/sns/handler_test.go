@@ -0,0 +1,175 @@
+package sns
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/suppression"
+)
+
+const topicARN = "arn:aws:sns:us-east-1:123456789012:ses-notifications"
+
+type testHandler struct {
+	*Handler
+	signer *testSigner
+	logs   *bytes.Buffer
+}
+
+func newTestHandler(t *testing.T) *testHandler {
+	store, _ := suppression.Open("")
+	signer := newTestSigner(t, time.Now().Add(time.Hour))
+	var logs bytes.Buffer
+	return &testHandler{
+		Handler: &Handler{
+			Store:     store,
+			Verifier:  signer.verifier(),
+			TopicARNs: []string{topicARN},
+			Log:       slog.New(slog.NewJSONHandler(&logs, nil)),
+		},
+		signer: signer,
+		logs:   &logs,
+	}
+}
+
+// post sends the signed notification with the sample payload of the file.
+func (h *testHandler) post(t *testing.T, m *Message) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(m)
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest("POST", "/", bytes.NewReader(body)))
+	return recorder
+}
+
+func samplePayload(t *testing.T, name string) *Message {
+	payload, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := notificationMessage()
+	m.Message = string(payload)
+	return m
+}
+
+func TestHandlerWithBounce(t *testing.T) {
+	h := newTestHandler(t)
+	h.TTL = 24 * time.Hour
+	m := samplePayload(t, "bounce.json")
+	h.signer.sign(t, m, "2")
+	response := h.post(t, m)
+	if response.Code != http.StatusNoContent {
+		t.Fatalf("Unexpected status: %d %s", response.Code, response.Body)
+	}
+	entry, ok := h.Store.Lookup("jane@example.com")
+	expected := "bounce: Permanent/General: smtp; 550 5.1.1 user unknown"
+	if !ok || entry.Reason != expected {
+		t.Errorf("Unexpected entry: %+v. Expected reason: %s", entry, expected)
+	}
+	if entry.Expires.Before(time.Now().Add(23*time.Hour)) || entry.Expires.After(time.Now().Add(25*time.Hour)) {
+		t.Errorf("Unexpected expiry: %s", entry.Expires)
+	}
+	if entry, ok := h.Store.Lookup("richard@example.com"); !ok || entry.Reason != "bounce: Permanent/General" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if !strings.Contains(h.logs.String(), `"msg":"suppression added","to":"jane@example.com"`) {
+		t.Errorf("Unexpected logs: %s", h.logs)
+	}
+}
+
+func TestHandlerWithComplaintEvent(t *testing.T) {
+	h := newTestHandler(t)
+	m := samplePayload(t, "complaint.json")
+	h.signer.sign(t, m, "1")
+	if response := h.post(t, m); response.Code != http.StatusNoContent {
+		t.Fatalf("Unexpected status: %d %s", response.Code, response.Body)
+	}
+	entry, ok := h.Store.Lookup("recipient@example.com")
+	if !ok || entry.Reason != "complaint: abuse" || !entry.Expires.IsZero() {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+}
+
+func TestHandlerWithIgnoredNotifications(t *testing.T) {
+	h := newTestHandler(t)
+	for _, name := range []string{"soft-bounce.json", "delivery.json"} {
+		m := samplePayload(t, name)
+		h.signer.sign(t, m, "2")
+		if response := h.post(t, m); response.Code != http.StatusNoContent {
+			t.Errorf("Unexpected status for %s: %d %s", name, response.Code, response.Body)
+		}
+	}
+	m := notificationMessage()
+	m.Message = "Test message"
+	h.signer.sign(t, m, "2")
+	if response := h.post(t, m); response.Code != http.StatusNoContent {
+		t.Errorf("Unexpected status: %d %s", response.Code, response.Body)
+	}
+	if entries := h.Store.List(); len(entries) != 0 {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+}
+
+func TestHandlerWithSubscriptionConfirmation(t *testing.T) {
+	h := newTestHandler(t)
+	subscribeURL := "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&TopicArn=" +
+		topicARN + "&Token=2336412f37"
+	m := &Message{
+		Type:         "SubscriptionConfirmation",
+		MessageId:    "165545c9-2a5c-472c-8df2-7ff2be2b3b1b",
+		Token:        "2336412f37",
+		TopicArn:     topicARN,
+		Message:      "You have chosen to subscribe to the topic.",
+		SubscribeURL: subscribeURL,
+		Timestamp:    "2024-05-01T12:00:00.000Z",
+	}
+	h.signer.sign(t, m, "2")
+	if response := h.post(t, m); response.Code != http.StatusNoContent {
+		t.Fatalf("Unexpected status: %d %s", response.Code, response.Body)
+	}
+	if fetched := h.signer.fetched; len(fetched) != 2 || fetched[1] != subscribeURL {
+		t.Errorf("Unexpected fetched URLs: %v", fetched)
+	}
+	m.SubscribeURL = "https://attacker.example.org/?Action=ConfirmSubscription"
+	h.signer.sign(t, m, "2")
+	if response := h.post(t, m); response.Code != http.StatusBadGateway {
+		t.Errorf("Unexpected status: %d. Expected: %d", response.Code, http.StatusBadGateway)
+	}
+}
+
+func TestHandlerWithInvalidRequests(t *testing.T) {
+	h := newTestHandler(t)
+	m := samplePayload(t, "bounce.json")
+	h.signer.sign(t, m, "2")
+	m.Message = strings.Replace(m.Message, "jane@example.com", "john@example.com", 1)
+	if response := h.post(t, m); response.Code != http.StatusForbidden {
+		t.Errorf("Unexpected status: %d. Expected: %d", response.Code, http.StatusForbidden)
+	}
+	m = samplePayload(t, "bounce.json")
+	m.TopicArn = "arn:aws:sns:us-east-1:123456789012:other"
+	h.signer.sign(t, m, "2")
+	if response := h.post(t, m); response.Code != http.StatusForbidden {
+		t.Errorf("Unexpected status: %d. Expected: %d", response.Code, http.StatusForbidden)
+	}
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest("POST", "/", strings.NewReader("{")))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status: %d. Expected: %d", recorder.Code, http.StatusBadRequest)
+	}
+	recorder = httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status: %d. Expected: %d", recorder.Code, http.StatusMethodNotAllowed)
+	}
+	if entries := h.Store.List(); len(entries) != 0 {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+	if !strings.Contains(h.logs.String(), `"msg":"sns message rejected"`) {
+		t.Errorf("Unexpected logs: %s", h.logs)
+	}
+}
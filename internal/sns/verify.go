@@ -0,0 +1,184 @@
+/*
+Package sns provides an HTTP endpoint for Amazon SNS notifications of SES
+bounce and complaint events, which adds the affected recipients to the
+suppression list.
+*/
+package sns
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	// Register the hash functions of the signature versions:
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+)
+
+// hostRegExp matches the SNS endpoints serving signing certificates and
+// subscription confirmations.
+var hostRegExp = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// Message is an SNS message as posted to HTTP subscriptions.
+type Message struct {
+	Type             string
+	MessageId        string
+	Token            string
+	TopicArn         string
+	Subject          string
+	Message          string
+	Timestamp        string
+	SignatureVersion string
+	Signature        string
+	SigningCertURL   string
+	SubscribeURL     string
+}
+
+// signingString returns the string signed by SNS for the message type.
+func (m *Message) signingString() (string, error) {
+	var fields [][2]string
+	switch m.Type {
+	case "Notification":
+		fields = [][2]string{{"Message", m.Message}, {"MessageId", m.MessageId}}
+		if m.Subject != "" {
+			fields = append(fields, [2]string{"Subject", m.Subject})
+		}
+		fields = append(fields,
+			[2]string{"Timestamp", m.Timestamp},
+			[2]string{"TopicArn", m.TopicArn},
+			[2]string{"Type", m.Type},
+		)
+	case "SubscriptionConfirmation", "UnsubscribeConfirmation":
+		fields = [][2]string{
+			{"Message", m.Message},
+			{"MessageId", m.MessageId},
+			{"SubscribeURL", m.SubscribeURL},
+			{"Timestamp", m.Timestamp},
+			{"Token", m.Token},
+			{"TopicArn", m.TopicArn},
+			{"Type", m.Type},
+		}
+	default:
+		return "", errors.New("invalid message type: " + m.Type)
+	}
+	s := ""
+	for _, field := range fields {
+		s += field[0] + "\n" + field[1] + "\n"
+	}
+	return s, nil
+}
+
+// Verifier verifies SNS message signatures with the signing certificates of
+// SNS, which are cached by URL.
+type Verifier struct {
+	// Get fetches the body of the given SNS URL, which defaults to an HTTP GET
+	// request.
+	Get   func(ctx context.Context, url string) ([]byte, error)
+	mu    sync.Mutex
+	certs map[string]*x509.Certificate
+}
+
+// Verify checks the signature of the message.
+func (v *Verifier) Verify(ctx context.Context, m *Message) error {
+	var hash crypto.Hash
+	switch m.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return errors.New("invalid signature version: " + m.SignatureVersion)
+	}
+	s, err := m.signingString()
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return errors.New("invalid signature encoding")
+	}
+	cert, err := v.certificate(ctx, m.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("invalid signing certificate key type")
+	}
+	h := hash.New()
+	h.Write([]byte(s))
+	if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature); err != nil {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// certificate returns the cached or fetched certificate of the URL.
+func (v *Verifier) certificate(ctx context.Context, certURL string) (*x509.Certificate, error) {
+	if err := checkURL(certURL); err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	cert := v.certs[certURL]
+	if cert == nil {
+		data, err := v.get(ctx, certURL)
+		if err != nil {
+			return nil, errors.New("signing certificate: " + err.Error())
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("signing certificate: no PEM encoded certificate found")
+		}
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.New("signing certificate: " + err.Error())
+		}
+		if v.certs == nil {
+			v.certs = make(map[string]*x509.Certificate)
+		}
+		v.certs[certURL] = cert
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, errors.New("signing certificate expired or not yet valid")
+	}
+	return cert, nil
+}
+
+func (v *Verifier) get(ctx context.Context, rawURL string) ([]byte, error) {
+	if v.Get != nil {
+		return v.Get(ctx, rawURL)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected status: " + response.Status)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, 1<<20))
+}
+
+// checkURL checks if the URL is an HTTPS URL of an SNS endpoint.
+func checkURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || !hostRegExp.MatchString(u.Host) {
+		return errors.New("invalid SNS URL: " + rawURL)
+	}
+	return nil
+}
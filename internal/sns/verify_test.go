@@ -0,0 +1,159 @@
+package sns
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+const certURL = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-test.pem"
+
+// testSigner signs messages with a locally generated key and certificate.
+type testSigner struct {
+	key     *rsa.PrivateKey
+	certPEM []byte
+	// fetched holds the URLs requested via the verifier.
+	fetched []string
+}
+
+func newTestSigner(t *testing.T, notAfter time.Time) *testSigner {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (s *testSigner) sign(t *testing.T, m *Message, version string) {
+	m.SignatureVersion = version
+	m.SigningCertURL = certURL
+	hash := crypto.SHA1
+	if version == "2" {
+		hash = crypto.SHA256
+	}
+	str, err := m.signingString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hash.New()
+	h.Write([]byte(str))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, hash, h.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(signature)
+}
+
+func (s *testSigner) verifier() *Verifier {
+	return &Verifier{Get: func(ctx context.Context, url string) ([]byte, error) {
+		s.fetched = append(s.fetched, url)
+		if url == certURL {
+			return s.certPEM, nil
+		}
+		if strings.Contains(url, "Action=ConfirmSubscription") {
+			return []byte("<ConfirmSubscriptionResponse/>"), nil
+		}
+		return nil, errors.New("not found")
+	}}
+}
+
+func notificationMessage() *Message {
+	return &Message{
+		Type:      "Notification",
+		MessageId: "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+		TopicArn:  "arn:aws:sns:us-east-1:123456789012:ses-notifications",
+		Subject:   "Amazon SES Email Event Notification",
+		Message:   `{"notificationType":"Delivery"}`,
+		Timestamp: "2024-05-01T12:00:00.000Z",
+	}
+}
+
+func TestVerify(t *testing.T) {
+	signer := newTestSigner(t, time.Now().Add(time.Hour))
+	verifier := signer.verifier()
+	for _, version := range []string{"1", "2"} {
+		m := notificationMessage()
+		signer.sign(t, m, version)
+		if err := verifier.Verify(context.Background(), m); err != nil {
+			t.Errorf("Unexpected error for version %s: %s", version, err)
+		}
+	}
+	m := &Message{
+		Type:         "SubscriptionConfirmation",
+		MessageId:    "165545c9-2a5c-472c-8df2-7ff2be2b3b1b",
+		Token:        "2336412f37",
+		TopicArn:     "arn:aws:sns:us-east-1:123456789012:ses-notifications",
+		Message:      "You have chosen to subscribe to the topic.",
+		SubscribeURL: "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=2336412f37",
+		Timestamp:    "2024-05-01T12:00:00.000Z",
+	}
+	signer.sign(t, m, "2")
+	if err := verifier.Verify(context.Background(), m); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	// The certificate is only fetched once:
+	if len(signer.fetched) != 1 {
+		t.Errorf("Unexpected fetched URLs: %v", signer.fetched)
+	}
+}
+
+func TestVerifyWithInvalidMessages(t *testing.T) {
+	signer := newTestSigner(t, time.Now().Add(time.Hour))
+	for expected, modify := range map[string]func(m *Message){
+		"invalid signature":             func(m *Message) { m.Message = `{"notificationType":"Bounce"}` },
+		"invalid signature version: 3":  func(m *Message) { m.SignatureVersion = "3" },
+		"invalid signature encoding":    func(m *Message) { m.Signature = "!" },
+		"invalid message type: Unknown": func(m *Message) { m.Type = "Unknown" },
+		"invalid SNS URL: http://sns.us-east-1.amazonaws.com/cert.pem": func(m *Message) {
+			m.SigningCertURL = "http://sns.us-east-1.amazonaws.com/cert.pem"
+		},
+		"invalid SNS URL: https://sns.us-east-1.amazonaws.com.example.org/cert.pem": func(m *Message) {
+			m.SigningCertURL = "https://sns.us-east-1.amazonaws.com.example.org/cert.pem"
+		},
+		"signing certificate: not found": func(m *Message) {
+			m.SigningCertURL = "https://sns.us-east-1.amazonaws.com/missing.pem"
+		},
+	} {
+		m := notificationMessage()
+		signer.sign(t, m, "1")
+		modify(m)
+		err := signer.verifier().Verify(context.Background(), m)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Unexpected error: %v. Expected: %s", err, expected)
+		}
+	}
+}
+
+func TestVerifyWithExpiredCertificate(t *testing.T) {
+	signer := newTestSigner(t, time.Now().Add(-time.Minute))
+	m := notificationMessage()
+	signer.sign(t, m, "2")
+	err := signer.verifier().Verify(context.Background(), m)
+	expected := "signing certificate expired or not yet valid"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Unexpected error: %v. Expected: %s", err, expected)
+	}
+}
@@ -0,0 +1,59 @@
+package suppression
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/admin"
+)
+
+// NewHandler returns the admin API handler managing the entries of the store:
+//
+//	GET    /suppressions            lists the entries
+//	GET    /suppressions/{address}  returns the entry of the address
+//	POST   /suppressions            adds or replaces the entry of the JSON body
+//	DELETE /suppressions/{address}  removes the entry of the address
+func NewHandler(s *Store) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /suppressions", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, s.List())
+	})
+	mux.HandleFunc("GET /suppressions/{address}", func(w http.ResponseWriter, r *http.Request) {
+		entry, ok := s.Lookup(r.PathValue("address"))
+		if !ok || entry.Address != normalize(r.PathValue("address")) {
+			admin.WriteError(w, http.StatusNotFound, "suppression not found")
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, entry)
+	})
+	mux.HandleFunc("POST /suppressions", func(w http.ResponseWriter, r *http.Request) {
+		var entry Entry
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&entry); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+		if err := validate(normalize(entry.Address)); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		entry, err := s.Add(entry)
+		if err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		admin.WriteJSON(w, http.StatusCreated, entry)
+	})
+	mux.HandleFunc("DELETE /suppressions/{address}", func(w http.ResponseWriter, r *http.Request) {
+		removed, err := s.Remove(r.PathValue("address"))
+		if err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !removed {
+			admin.WriteError(w, http.StatusNotFound, "suppression not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
@@ -0,0 +1,92 @@
+package suppression
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func request(h http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return recorder
+}
+
+func TestHandler(t *testing.T) {
+	s, _ := Open("")
+	h := NewHandler(s)
+	response := request(h, "POST", "/suppressions",
+		`{"address":"Bob@example.org","reason":"bounce","expires":"2099-01-01T00:00:00Z"}`)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Unexpected status: %d. Expected: %d", response.Code, http.StatusCreated)
+	}
+	var entry Entry
+	json.Unmarshal(response.Body.Bytes(), &entry)
+	if entry.Address != "bob@example.org" || entry.Reason != "bounce" || entry.Expires.Year() != 2099 {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	response = request(h, "GET", "/suppressions", "")
+	var entries []Entry
+	json.Unmarshal(response.Body.Bytes(), &entries)
+	if response.Code != http.StatusOK || len(entries) != 1 {
+		t.Errorf("Unexpected response: %d %s", response.Code, response.Body)
+	}
+	response = request(h, "GET", "/suppressions/bob@example.org", "")
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"reason":"bounce"`) {
+		t.Errorf("Unexpected response: %d %s", response.Code, response.Body)
+	}
+	response = request(h, "DELETE", "/suppressions/bob@example.org", "")
+	if response.Code != http.StatusNoContent {
+		t.Errorf("Unexpected status: %d. Expected: %d", response.Code, http.StatusNoContent)
+	}
+	for _, path := range []string{"/suppressions/bob@example.org", "/suppressions/alice@example.org"} {
+		response = request(h, "GET", path, "")
+		if response.Code != http.StatusNotFound {
+			t.Errorf("Unexpected status for %s: %d. Expected: %d", path, response.Code, http.StatusNotFound)
+		}
+	}
+	response = request(h, "DELETE", "/suppressions/bob@example.org", "")
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status: %d. Expected: %d", response.Code, http.StatusNotFound)
+	}
+}
+
+func TestHandlerWithFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "suppressions.json")
+	os.WriteFile(path, []byte(`[{"address":" Bob@Example.org","reason":"bounce"}]`), 0600)
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	h := NewHandler(s)
+	response := request(h, "GET", "/suppressions/bob@example.org", "")
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), `"address":"bob@example.org"`) {
+		t.Errorf("Unexpected response: %d %s", response.Code, response.Body)
+	}
+	response = request(h, "GET", "/suppressions", "")
+	if !strings.Contains(response.Body.String(), `"address":"bob@example.org"`) {
+		t.Errorf("Unexpected response: %d %s", response.Code, response.Body)
+	}
+	if _, suppressed := s.Filter([]string{"BOB@example.org"}); len(suppressed) != 1 {
+		t.Errorf("Unexpected suppressed recipients: %v", suppressed)
+	}
+}
+
+func TestHandlerWithInvalidRequests(t *testing.T) {
+	s, _ := Open("")
+	h := NewHandler(s)
+	for _, body := range []string{`{`, `{"address":"example org"}`, `{"address":""}`} {
+		response := request(h, "POST", "/suppressions", body)
+		if response.Code != http.StatusBadRequest || !strings.Contains(response.Body.String(), `"error":`) {
+			t.Errorf("Unexpected response for %s: %d %s", body, response.Code, response.Body)
+		}
+	}
+	response := request(h, "PUT", "/suppressions", `{}`)
+	if response.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Unexpected status: %d. Expected: %d", response.Code, http.StatusMethodNotAllowed)
+	}
+}
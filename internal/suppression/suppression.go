@@ -0,0 +1,223 @@
+/*
+Package suppression provides a local list of suppressed recipient addresses and
+domains, which emails are not sent to.
+*/
+package suppression
+
+import (
+	"encoding/json"
+	"errors"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry suppresses an email address or all addresses of a domain.
+type Entry struct {
+	// Address is a lowercase email address or domain, e.g. example.org.
+	Address string    `json:"address"`
+	Reason  string    `json:"reason"`
+	Created time.Time `json:"created"`
+	// Expires is the time the entry expires (zero: never).
+	Expires time.Time `json:"expires"`
+}
+
+// Expired reports if the entry is expired at the given time.
+func (e Entry) Expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// Store holds the suppression entries, which are persisted to a JSON file if
+// a path is given.
+type Store struct {
+	path    string
+	mu      sync.RWMutex
+	entries map[string]Entry
+}
+
+// Open loads the store from the JSON file at the given path, which is created
+// on the first modification if it does not exist.
+// An empty path creates a store held in memory only.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, entries: make(map[string]Entry)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	for _, entry := range entries {
+		// Edited files might contain mixed-case addresses:
+		entry.Address = normalize(entry.Address)
+		s.entries[entry.Address] = entry
+	}
+	return s, nil
+}
+
+// normalize returns the lowercase address without surrounding whitespace.
+func normalize(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// validate checks if the normalized address is an email address or a domain.
+func validate(address string) error {
+	if address == "" {
+		return errors.New("missing address")
+	}
+	if strings.Contains(address, "@") {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil || parsed.Address != address {
+			return errors.New("invalid address: " + address)
+		}
+		return nil
+	}
+	if strings.ContainsAny(address, " \t<>/\\\"") {
+		return errors.New("invalid domain: " + address)
+	}
+	return nil
+}
+
+// Lookup returns the unexpired entry suppressing the given email address,
+// either by address or by its domain.
+func (s *Store) Lookup(address string) (Entry, bool) {
+	address = normalize(address)
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if entry, ok := s.entries[address]; ok && !entry.Expired(now) {
+		return entry, true
+	}
+	if i := strings.LastIndexByte(address, '@'); i >= 0 {
+		if entry, ok := s.entries[address[i+1:]]; ok && !entry.Expired(now) {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Filter returns the given recipients split into allowed and suppressed ones.
+// A nil Store allows all recipients.
+func (s *Store) Filter(to []string) (allowed []string, suppressed []string) {
+	if s == nil {
+		return to, nil
+	}
+	for _, address := range to {
+		if _, ok := s.Lookup(address); ok {
+			suppressed = append(suppressed, address)
+		} else {
+			allowed = append(allowed, address)
+		}
+	}
+	return allowed, suppressed
+}
+
+// Add adds the entry or replaces the existing entry for its address and
+// returns the stored entry, of which the creation time defaults to now.
+func (s *Store) Add(entry Entry) (Entry, error) {
+	entry.Address = normalize(entry.Address)
+	if err := validate(entry.Address); err != nil {
+		return entry, err
+	}
+	if entry.Created.IsZero() {
+		entry.Created = time.Now().UTC()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, exists := s.entries[entry.Address]
+	s.entries[entry.Address] = entry
+	if err := s.save(); err != nil {
+		if exists {
+			s.entries[entry.Address] = previous
+		} else {
+			delete(s.entries, entry.Address)
+		}
+		return entry, err
+	}
+	return entry, nil
+}
+
+// Remove removes the entry for the given address and reports if it existed.
+func (s *Store) Remove(address string) (bool, error) {
+	address = normalize(address)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, exists := s.entries[address]
+	if !exists {
+		return false, nil
+	}
+	delete(s.entries, address)
+	if err := s.save(); err != nil {
+		s.entries[address] = entry
+		return false, err
+	}
+	return true, nil
+}
+
+// List returns the unexpired entries sorted by address.
+func (s *Store) List() []Entry {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := []Entry{}
+	for _, entry := range s.entries {
+		if !entry.Expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Address < entries[j].Address
+	})
+	return entries
+}
+
+// save writes the unexpired entries to the file, if any, which is replaced
+// atomically. Expired entries are dropped.
+func (s *Store) save() error {
+	now := time.Now()
+	for address, entry := range s.entries {
+		if entry.Expired(now) {
+			delete(s.entries, address)
+		}
+	}
+	if s.path == "" {
+		return nil
+	}
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Address < entries[j].Address
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package suppression
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "suppressions.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, entry := range []Entry{
+		{Address: " Bob@Example.org", Reason: "bounce"},
+		{Address: "example.com", Reason: "complaint"},
+		{Address: "charlie@example.org", Expires: time.Now().Add(-time.Minute)},
+	} {
+		if _, err := s.Add(entry); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	if entry, ok := s.Lookup("BOB@example.org"); !ok || entry.Reason != "bounce" || entry.Created.IsZero() {
+		t.Errorf("Unexpected entry: %+v %v", entry, ok)
+	}
+	if entry, ok := s.Lookup("alice@example.com"); !ok || entry.Address != "example.com" {
+		t.Errorf("Unexpected domain entry: %+v %v", entry, ok)
+	}
+	for _, address := range []string{"alice@example.org", "charlie@example.org"} {
+		if _, ok := s.Lookup(address); ok {
+			t.Errorf("Unexpected entry for %s", address)
+		}
+	}
+	allowed, suppressed := s.Filter([]string{"alice@example.org", "bob@example.org", "dave@example.com"})
+	if !reflect.DeepEqual(allowed, []string{"alice@example.org"}) ||
+		!reflect.DeepEqual(suppressed, []string{"bob@example.org", "dave@example.com"}) {
+		t.Errorf("Unexpected recipients: %v %v", allowed, suppressed)
+	}
+	// The file holds the unexpired entries:
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	var addresses []string
+	for _, entry := range reopened.List() {
+		addresses = append(addresses, entry.Address)
+	}
+	if !reflect.DeepEqual(addresses, []string{"bob@example.org", "example.com"}) {
+		t.Errorf("Unexpected addresses: %v", addresses)
+	}
+	removed, err := reopened.Remove("Example.com")
+	if !removed || err != nil {
+		t.Errorf("Unexpected remove result: %v %v", removed, err)
+	}
+	removed, err = reopened.Remove("example.com")
+	if removed || err != nil {
+		t.Errorf("Unexpected second remove result: %v %v", removed, err)
+	}
+	if _, ok := reopened.Lookup("dave@example.com"); ok {
+		t.Error("Unexpected entry for removed domain")
+	}
+}
+
+func TestStoreWithInvalidAddresses(t *testing.T) {
+	s, _ := Open("")
+	for _, address := range []string{"", "Bob <bob@example.org>", "@example.org", "example org"} {
+		if _, err := s.Add(Entry{Address: address}); err == nil {
+			t.Errorf("Unexpected nil error for %q", address)
+		}
+	}
+	if entries := s.List(); len(entries) != 0 {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+}
+
+func TestStoreWithFileError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "suppressions.json")
+	os.WriteFile(path, []byte("{"), 0600)
+	_, err := Open(path)
+	if err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	s, _ := Open(filepath.Join(dir, "missing", "suppressions.json"))
+	if _, err := s.Add(Entry{Address: "bob@example.org"}); err == nil {
+		t.Error("Unexpected nil error for missing directory")
+	}
+	if _, ok := s.Lookup("bob@example.org"); ok {
+		t.Error("Unexpected entry after failed save")
+	}
+	var nilStore *Store
+	allowed, suppressed := nilStore.Filter([]string{"bob@example.org"})
+	if len(allowed) != 1 || suppressed != nil {
+		t.Errorf("Unexpected nil store recipients: %v %v", allowed, suppressed)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Package tracing provides OpenTelemetry instrumentation for SMTP sessions and
+relay API calls.
+Spans are created with the global tracer provider, which discards them unless
+tracing has been enabled with Setup.
+*/
+package tracing
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name is the instrumentation scope name of the created spans.
+const Name = "github.com/KamorionLabs/aws-smtp-relay"
+
+// Tracer returns the tracer of the global tracer provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(Name)
+}
+
+// Setup registers a global tracer provider, which exports spans via OTLP/HTTP
+// as configured with the standard OTEL_EXPORTER_OTLP_* environment variables.
+// The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, serviceVersion string) (
+	shutdown func(context.Context) error,
+	err error,
+) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Register(exporter, serviceVersion)
+}
+
+// Register registers a global tracer provider for the given exporter.
+func Register(exporter sdktrace.SpanExporter, serviceVersion string) (
+	shutdown func(context.Context) error,
+	err error,
+) {
+	options := []resource.Option{
+		resource.WithAttributes(semconv.ServiceName("aws-smtp-relay")),
+	}
+	if serviceVersion != "" {
+		options = append(options, resource.WithAttributes(semconv.ServiceVersion(serviceVersion)))
+	}
+	// Attributes set via OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take
+	// precedence over the defaults:
+	options = append(options, resource.WithFromEnv())
+	res, err := resource.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// AppendMiddlewares adds the AWS SDK middlewares creating a span per API call,
+// e.g. SendEmail, as child of the span in the request context.
+func AppendMiddlewares(apiOptions *[]func(*middleware.Stack) error) {
+	otelaws.AppendMiddlewares(apiOptions)
+}
+
+// StartTransaction starts a span for an SMTP transaction beginning at the given
+// time, as child of the session span in ctx.
+// If the raw email data contains a trace context in the given header, e.g.
+// traceparent, the span continues that trace instead and is linked to the
+// session span.
+func StartTransaction(
+	ctx context.Context,
+	start time.Time,
+	data []byte,
+	name string,
+) (context.Context, trace.Span) {
+	options := []trace.SpanStartOption{
+		trace.WithTimestamp(start),
+		trace.WithSpanKind(trace.SpanKindServer),
+	}
+	if name != "" {
+		if values := header.Values(data, name); len(values) > 0 {
+			carrier := propagation.MapCarrier{"traceparent": values[0]}
+			if values := header.Values(data, "tracestate"); len(values) > 0 {
+				carrier["tracestate"] = strings.Join(values, ",")
+			}
+			parent := propagation.TraceContext{}.Extract(context.Background(), carrier)
+			if remote := trace.SpanContextFromContext(parent); remote.IsValid() {
+				options = append(options, trace.WithLinks(
+					trace.LinkFromContext(ctx),
+				))
+				ctx = trace.ContextWithRemoteSpanContext(ctx, remote)
+			}
+		}
+	}
+	return Tracer().Start(ctx, "smtp.transaction", options...)
+}
+
+// End records the given error on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+func registerHelper(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := Register(exporter, "test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	t.Cleanup(func() { shutdown(context.Background()) })
+	return exporter
+}
+
+func spansHelper(t *testing.T, exporter *tracetest.InMemoryExporter) tracetest.SpanStubs {
+	provider := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("Unexpected flush error: %s", err)
+	}
+	return exporter.GetSpans()
+}
+
+func TestStartTransaction(t *testing.T) {
+	exporter := registerHelper(t)
+	ctx, session := Tracer().Start(context.Background(), "smtp.session")
+	start := time.Now().Add(-time.Second)
+	_, span := StartTransaction(ctx, start, []byte("Subject: Test\r\n\r\nTEST"), "traceparent")
+	span.End()
+	session.End()
+	spans := spansHelper(t, exporter)
+	if len(spans) != 2 {
+		t.Fatalf("Unexpected number of spans: %d. Expected: %d", len(spans), 2)
+	}
+	transaction := spans[0]
+	if transaction.Name != "smtp.transaction" {
+		t.Errorf("Unexpected span name: %s. Expected: %s", transaction.Name, "smtp.transaction")
+	}
+	if transaction.Parent.SpanID() != session.SpanContext().SpanID() {
+		t.Error("Unexpected parent span")
+	}
+	if !transaction.StartTime.Equal(start) {
+		t.Errorf("Unexpected start time: %s. Expected: %s", transaction.StartTime, start)
+	}
+	if transaction.Resource.String() == "" {
+		t.Error("Unexpected empty resource")
+	}
+}
+
+func TestStartTransactionWithTraceHeader(t *testing.T) {
+	exporter := registerHelper(t)
+	ctx, session := Tracer().Start(context.Background(), "smtp.session")
+	data := []byte("Traceparent: 00-" + testTraceID + "-00f067aa0ba902b7-01\r\n\r\nTEST")
+	_, span := StartTransaction(ctx, time.Now(), data, "traceparent")
+	span.End()
+	session.End()
+	spans := spansHelper(t, exporter)
+	transaction := spans[0]
+	if transaction.SpanContext.TraceID().String() != testTraceID {
+		t.Errorf(
+			"Unexpected trace ID: %s. Expected: %s",
+			transaction.SpanContext.TraceID(),
+			testTraceID,
+		)
+	}
+	if transaction.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Unexpected parent span ID: %s", transaction.Parent.SpanID())
+	}
+	if len(transaction.Links) != 1 ||
+		transaction.Links[0].SpanContext.SpanID() != session.SpanContext().SpanID() {
+		t.Error("Unexpected links: missing session span")
+	}
+}
+
+func TestStartTransactionWithInvalidTraceHeader(t *testing.T) {
+	exporter := registerHelper(t)
+	ctx, session := Tracer().Start(context.Background(), "smtp.session")
+	data := []byte("traceparent: invalid\r\n\r\nTEST")
+	_, span := StartTransaction(ctx, time.Now(), data, "traceparent")
+	span.End()
+	session.End()
+	spans := spansHelper(t, exporter)
+	if spans[0].SpanContext.TraceID() != session.SpanContext().TraceID() {
+		t.Error("Unexpected trace ID: expected session trace")
+	}
+}
+
+func TestEnd(t *testing.T) {
+	exporter := registerHelper(t)
+	_, span := Tracer().Start(context.Background(), "test")
+	End(span, errors.New("ERROR"))
+	spans := spansHelper(t, exporter)
+	if spans[0].Status.Code != codes.Error || spans[0].Status.Description != "ERROR" {
+		t.Errorf("Unexpected status: %v", spans[0].Status)
+	}
+	if len(spans[0].Events) != 1 {
+		t.Errorf("Unexpected number of events: %d. Expected: %d", len(spans[0].Events), 1)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Package transcript logs the SMTP commands and replies of each session, with
+authentication payloads and message data redacted unless enabled.
+*/
+package transcript
+
+import (
+	"log/slog"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/listener"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/logger"
+)
+
+// Redacted replaces redacted content in the transcript.
+const Redacted = "***"
+
+// addressRegExp matches email addresses, e.g. in MAIL and RCPT commands or
+// replies listing failed recipients.
+var addressRegExp = regexp.MustCompile(`[^\s<>:,()]+@[^\s<>,()]+`)
+
+// Transcript logs transcript lines, which provide only the client IP, with the
+// ID of the matching session.
+type Transcript struct {
+	log      *slog.Logger
+	sessions *listener.Listener
+	auth     bool
+	data     bool
+	// replace modifies addresses as configured by the recipients mode, if set.
+	replace func(string) string
+}
+
+// New creates a Transcript for the sessions of the given listener.
+// If auth is set, AUTH payloads are logged unredacted, if data is set, the
+// message data is logged along with its size.
+// Addresses in command and reply lines are redacted or hashed like recipients
+// of log entries, as configured by the recipients mode (plain|redact|hash).
+func New(
+	log *slog.Logger,
+	sessions *listener.Listener,
+	auth bool,
+	data bool,
+	recipients string,
+) *Transcript {
+	t := &Transcript{
+		log:      log,
+		sessions: sessions,
+		auth:     auth,
+		data:     data,
+	}
+	switch recipients {
+	case logger.RecipientsRedact:
+		t.replace = logger.Redact
+	case logger.RecipientsHash:
+		t.replace = logger.Hash
+	}
+	return t
+}
+
+// verbs are the SMTP commands handled by the server. Other lines read from the
+// client are AUTH continuation lines, e.g. base64 encoded credentials.
+var verbs = map[string]bool{
+	"HELO": true, "EHLO": true, "MAIL": true, "RCPT": true, "DATA": true,
+	"QUIT": true, "RSET": true, "NOOP": true, "XCLIENT": true, "HELP": true,
+	"VRFY": true, "EXPN": true, "STARTTLS": true, "AUTH": true,
+}
+
+// LogRead logs a command line read from the client.
+// It implements the smtpd.LogFunc signature.
+// Message data is not read line by line, so lines not starting with a known
+// verb are redacted, as concurrent sessions from the same IP make it
+// impossible to tell which line answers an AUTH challenge.
+func (t *Transcript) LogRead(remoteIP string, verb string, line string) {
+	if !t.auth {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case !verbs[strings.ToUpper(fields[0])]:
+			line = Redacted
+		case len(fields) > 2 && strings.EqualFold(fields[0], "AUTH"):
+			line = fields[0] + " " + fields[1] + " " + Redacted
+		}
+	}
+	t.write(t.sessions.SessionByIP(remoteIP), remoteIP, "read", t.replaceAddresses(line))
+}
+
+// LogWrite logs a reply line written to the client.
+// It implements the smtpd.LogFunc signature.
+func (t *Transcript) LogWrite(remoteIP string, verb string, line string) {
+	t.write(t.sessions.SessionByIP(remoteIP), remoteIP, "write", t.replaceAddresses(line))
+}
+
+// replaceAddresses returns the line with addresses replaced as configured.
+func (t *Transcript) replaceAddresses(line string) string {
+	if t.replace == nil {
+		return line
+	}
+	return addressRegExp.ReplaceAllStringFunc(line, t.replace)
+}
+
+// LogData logs the message data received from the client at the given address.
+func (t *Transcript) LogData(remoteAddr net.Addr, data []byte) {
+	ip, _, err := net.SplitHostPort(remoteAddr.String())
+	if err != nil {
+		ip = remoteAddr.String()
+	}
+	session := t.sessions.Session(remoteAddr)
+	line := "<" + strconv.Itoa(len(data)) + " bytes " + Redacted + ">"
+	if t.data {
+		line = string(data)
+	}
+	t.write(session, ip, "data", line)
+}
+
+func (t *Transcript) write(session *listener.Session, ip string, direction string, line string) {
+	id := ""
+	if session != nil {
+		id = session.Info().ID
+	}
+	t.log.Info("transcript",
+		"session_id", id,
+		logger.FieldIP, ip,
+		"direction", direction,
+		"line", line,
+	)
+}
@@ -0,0 +1,192 @@
+package transcript
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/listener"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/logger"
+)
+
+type entry struct {
+	Msg       string `json:"msg"`
+	SessionID string `json:"session_id"`
+	IP        string `json:"ip"`
+	Direction string `json:"direction"`
+	Line      string `json:"line"`
+}
+
+func sessionHelper(t *testing.T) (*listener.Listener, *listener.Session) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %s", err)
+	}
+	log := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	l := listener.New(ln, listener.Limits{}, "localhost", log)
+	t.Cleanup(func() { l.Close() })
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected dial error: %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("Unexpected accept error: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return l, l.Session(conn.RemoteAddr())
+}
+
+func transcriptHelper(t *testing.T, auth bool, data bool) (*Transcript, *bytes.Buffer, *listener.Session) {
+	l, session := sessionHelper(t)
+	var stdout bytes.Buffer
+	log, _ := logger.New("json", slog.LevelInfo, logger.RecipientsPlain, &stdout, io.Discard)
+	return New(log, l, auth, data, logger.RecipientsPlain), &stdout, session
+}
+
+func entriesHelper(t *testing.T, out *bytes.Buffer) (entries []entry) {
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("Unexpected JSON error: %s", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestTranscript(t *testing.T) {
+	transcript, out, session := transcriptHelper(t, false, false)
+	transcript.LogWrite("127.0.0.1", "WROTE", "220 localhost ESMTP Service ready")
+	transcript.LogRead("127.0.0.1", "READ", "EHLO client.example.org")
+	entries := entriesHelper(t, out)
+	if len(entries) != 2 {
+		t.Fatalf("Unexpected number of entries: %d. Expected: %d", len(entries), 2)
+	}
+	expected := []entry{
+		{"transcript", session.Info().ID, "127.0.0.1", "write", "220 localhost ESMTP Service ready"},
+		{"transcript", session.Info().ID, "127.0.0.1", "read", "EHLO client.example.org"},
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Unexpected entry: %+v. Expected: %+v", entries[i], expected[i])
+		}
+	}
+}
+
+func TestTranscriptWithRedactedAuth(t *testing.T) {
+	transcript, out, _ := transcriptHelper(t, false, false)
+	transcript.LogRead("127.0.0.1", "READ", "AUTH PLAIN AGFsaWNlAHNlY3JldA==")
+	transcript.LogRead("127.0.0.1", "READ", "AUTH LOGIN")
+	transcript.LogWrite("127.0.0.1", "WROTE", "334 VXNlcm5hbWU6")
+	transcript.LogRead("127.0.0.1", "READ", "YWxpY2U=")
+	// Continuation lines are redacted without challenge, e.g. if it was sent to
+	// another session from the same IP:
+	transcript.LogRead("127.0.0.1", "READ", "c2VjcmV0")
+	transcript.LogRead("127.0.0.1", "READ", "alice 3e4f6ca6e7b0fd8d3a4e4f1b4b0bbf38")
+	transcript.LogRead("127.0.0.1", "READ", "MAIL FROM:<alice@example.org>")
+	transcript.LogRead("127.0.0.1", "READ", "quit")
+	lines := []string{}
+	for _, e := range entriesHelper(t, out) {
+		lines = append(lines, e.Line)
+	}
+	expected := []string{
+		"AUTH PLAIN ***",
+		"AUTH LOGIN",
+		"334 VXNlcm5hbWU6",
+		"***",
+		"***",
+		"***",
+		"MAIL FROM:<alice@example.org>",
+		"quit",
+	}
+	if strings.Join(lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("Unexpected lines: %q. Expected: %q", lines, expected)
+	}
+}
+
+func TestTranscriptWithRedactedRecipients(t *testing.T) {
+	for recipients, expected := range map[string][]string{
+		logger.RecipientsRedact: {
+			"MAIL FROM:<***@example.org> SIZE=100",
+			"RCPT TO:<***@example.com>",
+			"rcpt to: ***@example.com",
+			"MAIL FROM:<>",
+			"250 2.0.0 Ok: queued as id-1 (partial delivery, failed recipients: ***@example.com, ***@example.net)",
+		},
+		logger.RecipientsHash: {
+			"MAIL FROM:<" + logger.Hash("alice@example.org") + "> SIZE=100",
+			"RCPT TO:<" + logger.Hash("bob@example.com") + ">",
+			"rcpt to: " + logger.Hash("carol@example.com"),
+			"MAIL FROM:<>",
+			"250 2.0.0 Ok: queued as id-1 (partial delivery, failed recipients: " +
+				logger.Hash("bob@example.com") + ", " + logger.Hash("dave@example.net") + ")",
+		},
+	} {
+		l, _ := sessionHelper(t)
+		var out bytes.Buffer
+		log, _ := logger.New("json", slog.LevelInfo, recipients, &out, io.Discard)
+		transcript := New(log, l, false, false, recipients)
+		transcript.LogRead("127.0.0.1", "READ", "MAIL FROM:<alice@example.org> SIZE=100")
+		transcript.LogRead("127.0.0.1", "READ", "RCPT TO:<bob@example.com>")
+		transcript.LogRead("127.0.0.1", "READ", "rcpt to: carol@example.com")
+		transcript.LogRead("127.0.0.1", "READ", "MAIL FROM:<>")
+		transcript.LogWrite("127.0.0.1", "WROTE", "250 2.0.0 Ok: queued as id-1 "+
+			"(partial delivery, failed recipients: bob@example.com, dave@example.net)")
+		lines := []string{}
+		for _, e := range entriesHelper(t, &out) {
+			lines = append(lines, e.Line)
+		}
+		if strings.Join(lines, "|") != strings.Join(expected, "|") {
+			t.Errorf("Unexpected %s lines: %q. Expected: %q", recipients, lines, expected)
+		}
+	}
+}
+
+func TestTranscriptWithAuth(t *testing.T) {
+	transcript, out, _ := transcriptHelper(t, true, false)
+	transcript.LogRead("127.0.0.1", "READ", "AUTH PLAIN AGFsaWNlAHNlY3JldA==")
+	transcript.LogWrite("127.0.0.1", "WROTE", "334 VXNlcm5hbWU6")
+	transcript.LogRead("127.0.0.1", "READ", "YWxpY2U=")
+	entries := entriesHelper(t, out)
+	if entries[0].Line != "AUTH PLAIN AGFsaWNlAHNlY3JldA==" || entries[2].Line != "YWxpY2U=" {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
+
+func TestTranscriptWithRedactedData(t *testing.T) {
+	transcript, out, session := transcriptHelper(t, false, false)
+	addr, _ := net.ResolveTCPAddr("tcp", session.Info().RemoteAddr)
+	transcript.LogData(addr, []byte("Subject: Test\r\n\r\nTEST"))
+	entries := entriesHelper(t, out)
+	if entries[0].Line != "<21 bytes ***>" || entries[0].Direction != "data" {
+		t.Errorf("Unexpected entry: %+v", entries[0])
+	}
+	if entries[0].SessionID != session.Info().ID {
+		t.Errorf("Unexpected session ID: %s. Expected: %s", entries[0].SessionID, session.Info().ID)
+	}
+}
+
+func TestTranscriptWithData(t *testing.T) {
+	transcript, out, session := transcriptHelper(t, false, true)
+	addr, _ := net.ResolveTCPAddr("tcp", session.Info().RemoteAddr)
+	transcript.LogData(addr, []byte("Subject: Test\r\n\r\nTEST"))
+	entries := entriesHelper(t, out)
+	if entries[0].Line != "Subject: Test\r\n\r\nTEST" {
+		t.Errorf("Unexpected entry: %+v", entries[0])
+	}
+}
+
+func TestTranscriptWithUnknownSession(t *testing.T) {
+	transcript, out, _ := transcriptHelper(t, false, false)
+	transcript.LogRead("192.0.2.1", "READ", "QUIT")
+	entries := entriesHelper(t, out)
+	if entries[0].SessionID != "" || entries[0].IP != "192.0.2.1" {
+		t.Errorf("Unexpected entry: %+v", entries[0])
+	}
+}
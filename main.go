@@ -1,20 +1,47 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
 	"os"
 	"regexp"
-	"strings"
 	"strconv"
-	"log"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/KamorionLabs/aws-smtp-relay/internal/admin"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/attachment"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/audit"
 	"github.com/KamorionLabs/aws-smtp-relay/internal/auth"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/dkim"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/dlp"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/header"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/listener"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/logger"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/message"
 	"github.com/KamorionLabs/aws-smtp-relay/internal/relay"
 	pinpointrelay "github.com/KamorionLabs/aws-smtp-relay/internal/relay/pinpoint"
 	sesrelay "github.com/KamorionLabs/aws-smtp-relay/internal/relay/ses"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/rewrite"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/scan"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/secret"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/sns"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/suppression"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/tracing"
+	"github.com/KamorionLabs/aws-smtp-relay/internal/transcript"
 	"github.com/mhale/smtpd"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -34,12 +61,149 @@ var (
 	sourceArn     = flag.String("o", LookupEnvOrString("SES_SOURCE_ARN", ""), "Amazon SES SourceArn")
 	fromArn       = flag.String("f", LookupEnvOrString("SES_FROM_ARN", ""), "Amazon SES FromArn")
 	returnPathArn = flag.String("p", LookupEnvOrString("SES_RETURN_PATH_ARN", ""), "Amazon SES ReturnPathArn")
+	tagsHeader    = flag.String("tags-header", LookupEnvOrString("MESSAGE_TAGS_HEADER", ""), "Header with message tags as comma-separated name=value pairs")
+	staticTags    = flag.String("tags", LookupEnvOrString("MESSAGE_TAGS", ""), "Message tags added to every email (comma-separated name=value pairs)")
+	stripTags     = flag.Bool("tags-strip", LookupEnvOrBool("MESSAGE_TAGS_STRIP_HEADER", false), "Remove the message tags header before sending")
+	maxSizeFlag   = flag.Int("max-size", LookupEnvOrInt("MAX_MESSAGE_SIZE", 0), "Maximum message size in bytes (default: relay API limit)")
+	maxConns      = flag.Int("max-connections", LookupEnvOrInt("MAX_CONNECTIONS", 0), "Maximum number of concurrent connections (0: unlimited)")
+	maxConnsPerIP = flag.Int("max-connections-per-ip", LookupEnvOrInt("MAX_CONNECTIONS_PER_IP", 0), "Maximum number of concurrent connections per client IP (0: unlimited)")
+	timeout       = flag.Duration("timeout", LookupEnvOrDuration("SMTP_TIMEOUT", 5*time.Minute), "Idle timeout for SMTP commands and data lines")
+	maxDataTime   = flag.Duration("max-data-duration", LookupEnvOrDuration("MAX_DATA_DURATION", 0), "Maximum duration to receive message data (0: unlimited)")
+	logFormat     = flag.String("log-format", LookupEnvOrString("LOG_FORMAT", "json"), "Log format (json|logfmt)")
+	logLevel      = flag.String("log-level", LookupEnvOrString("LOG_LEVEL", "info"), "Minimum log level (debug|info|warn|error)")
+	auditStdout   = flag.Bool("audit-stdout", LookupEnvOrBool("AUDIT_STDOUT", true), "Write audit entries to stdout/stderr")
+	auditFile     = flag.String("audit-file", LookupEnvOrString("AUDIT_FILE", ""), "Audit log file path")
+	auditFileSize = flag.Int64("audit-file-max-size", LookupEnvOrInt64("AUDIT_FILE_MAX_SIZE", 0), "Maximum audit log file size in bytes before rotation (0: unlimited)")
+	auditFileAge  = flag.Duration("audit-file-max-age", LookupEnvOrDuration("AUDIT_FILE_MAX_AGE", 0), "Maximum audit log file age before rotation (0: unlimited)")
+	auditFileKeep = flag.Int("audit-file-max-backups", LookupEnvOrInt("AUDIT_FILE_MAX_BACKUPS", 0), "Maximum number of rotated audit log files (0: unlimited)")
+	auditSyslog   = flag.String("audit-syslog", LookupEnvOrString("AUDIT_SYSLOG", ""), "Audit syslog server URL (udp|tcp|unix), e.g. udp://localhost:514")
+	tracingFlag   = flag.Bool("tracing", LookupEnvOrBool("TRACING", false), "Export OpenTelemetry traces via OTLP/HTTP")
+	traceHeader   = flag.String("tracing-header", LookupEnvOrString("TRACING_HEADER", "traceparent"), "Message header with a W3C trace context to continue")
+	debugSMTP     = flag.Bool("transcript", LookupEnvOrBool("TRANSCRIPT", false), "Log the SMTP command/reply transcript of each session")
+	debugAuth     = flag.Bool("transcript-auth", LookupEnvOrBool("TRANSCRIPT_AUTH", false), "Log unredacted AUTH payloads in the transcript")
+	debugData     = flag.Bool("transcript-data", LookupEnvOrBool("TRANSCRIPT_DATA", false), "Log unredacted message data in the transcript")
+	logRecipients = flag.String("log-recipients", LookupEnvOrString("LOG_RECIPIENTS", "plain"), "Log recipient addresses (plain|redact|hash)")
+	headerRules   = flag.String("header-policy", LookupEnvOrString("HEADER_POLICY_FILE", ""), "Header policy file with rules to add, set or remove headers")
+	senderRules   = flag.String("sender-rewrite-file", LookupEnvOrString("SENDER_REWRITE_FILE", ""), "Sender address rewrite rules file")
+	senderReplyTo = flag.Bool("sender-rewrite-reply-to", LookupEnvOrBool("SENDER_REWRITE_REPLY_TO", false), "Add the original From header as Reply-To header when rewriting it")
+	redirectTo    = flag.String("recipient-redirect", LookupEnvOrString("RECIPIENT_REDIRECT", ""), "Catch-all address receiving the emails of all recipients not exempt from redirection")
+	redirectAllow = flag.String("recipient-redirect-allow", LookupEnvOrString("RECIPIENT_REDIRECT_ALLOW", ""), "Recipient emails regular expression exempt from redirection")
+	redirectPlus  = flag.Bool("recipient-redirect-plus", LookupEnvOrBool("RECIPIENT_REDIRECT_PLUS", false), "Redirect to a subaddress of the catch-all address containing the original recipient")
+	dkimKeys      = flag.String("dkim-keys", LookupEnvOrString("DKIM_KEYS", ""), "DKIM signing keys (comma-separated domain:selector:path entries)")
+	dkimCanon     = flag.String("dkim-canonicalization", LookupEnvOrString("DKIM_CANONICALIZATION", "relaxed/relaxed"), "DKIM header/body canonicalization (relaxed|simple)")
+	dkimHeaders   = flag.String("dkim-headers", LookupEnvOrString("DKIM_HEADERS", ""), "DKIM signed header fields (comma-separated, default: RFC 6376 recommendation)")
+	normalize     = flag.Bool("normalize", LookupEnvOrBool("NORMALIZE_MESSAGES", false), "Validate messages and normalize line breaks, headers and missing Date/Message-ID")
+	attachRules   = flag.String("attachment-policy", LookupEnvOrString("ATTACHMENT_POLICY_FILE", ""), "Attachment policy file to reject or strip attachments by type, extension, size and count")
+	scanURL       = flag.String("scan-url", LookupEnvOrString("SCAN_URL", ""), "Malware scanner URL, e.g. clamd://localhost:3310, clamd:///path/to/clamd.ctl or icap://localhost:1344/avscan")
+	scanFailOpen  = flag.Bool("scan-fail-open", LookupEnvOrBool("SCAN_FAIL_OPEN", false), "Relay emails if the malware scan fails instead of rejecting them temporarily")
+	scanTimeout   = flag.Duration("scan-timeout", LookupEnvOrDuration("SCAN_TIMEOUT", 30*time.Second), "Timeout of the malware scan of each email (0: unlimited)")
+	dlpRules      = flag.String("dlp-rules", LookupEnvOrString("DLP_RULES_FILE", ""), "Data loss prevention rules file to reject, quarantine or tag emails with sensitive content")
+	dlpQuarantine = flag.String("dlp-quarantine-dir", LookupEnvOrString("DLP_QUARANTINE_DIR", ""), "Directory of emails quarantined by data loss prevention rules")
+	dlpTagHeader  = flag.String("dlp-tag-header", LookupEnvOrString("DLP_TAG_HEADER", "X-DLP-Rules"), "Header listing the data loss prevention rules matching tagged emails")
+	suppressFile  = flag.String("suppression-file", LookupEnvOrString("SUPPRESSION_FILE", ""), "Suppression list file of recipient addresses and domains not sent to")
+	suppressMode  = flag.String("suppression-mode", LookupEnvOrString("SUPPRESSION_MODE", "reject"), "Handling of suppressed recipients (reject|remove)")
+	adminAddr     = flag.String("admin-address", LookupEnvOrString("ADMIN_ADDRESS", ""), "Admin API listen address, e.g. localhost:8025")
+	adminToken    = flag.String("admin-token", LookupEnvOrString("ADMIN_TOKEN", ""), "Admin API bearer token")
+	snsAddr       = flag.String("sns-address", LookupEnvOrString("SNS_ADDRESS", ""), "SNS bounce and complaint notification endpoint listen address, e.g. :8026")
+	snsTopics     = flag.String("sns-topic-arns", LookupEnvOrString("SNS_TOPIC_ARNS", ""), "SNS topic ARNs accepted by the notification endpoint (comma-separated, default: all)")
+	snsTTL        = flag.Duration("sns-suppression-ttl", LookupEnvOrDuration("SNS_SUPPRESSION_TTL", 0), "Expiry of suppression list entries added for bounces and complaints (0: never)")
+	credFile      = flag.String("credentials-file", LookupEnvOrString("CREDENTIALS_FILE", ""), "Credentials file with usernames and bcrypt password hashes")
 )
 
+// log is replaced with a logger for the configured format and level.
+var log = defaultLogger()
+
 var ipMap map[string]bool
 var bcryptHash []byte
 var password []byte
+
+// tlsKeyPass and apiToken hold the resolved TLS key passphrase and admin API
+// token.
+var tlsKeyPass string
+var apiToken string
+
+// secretTimeout limits the duration of resolving secret references.
+const secretTimeout = 30 * time.Second
+
+// secrets resolves the secrets of environment variables, their _FILE variants
+// and references, which is replaced in tests.
+var secrets = secret.NewResolver()
+
+// authentication validates the client IPs and users, which is replaced on
+// reload.
+var authentication auth.Authentication
 var relayClient relay.Client
+var maxSize int
+
+// credentials holds the users of the credentials file, if configured.
+var credentials auth.Credentials
+
+// commands are the subcommands, called with the remaining arguments.
+var commands = map[string]func(
+	args []string,
+	stdin io.Reader,
+	stdout io.Writer,
+	stderr io.Writer,
+) int{
+	"send":        sendCommand,
+	"hash":        hashCommand,
+	"verify":      verifyCommand,
+	"credentials": credentialsCommand,
+	"doctor":      doctorCommand,
+}
+
+// normalizer validates and normalizes the emails before relaying, if enabled.
+var normalizer *message.Normalizer
+
+// attachmentPolicy rejects or strips attachments before relaying, if
+// configured.
+var attachmentPolicy attachment.Policy
+
+// contentScan scans the emails for malware before relaying, if configured.
+var contentScan *scan.Hook
+
+// dlpPolicy rejects, quarantines or tags emails with sensitive content before
+// relaying, if configured.
+var dlpPolicy *dlp.Policy
+
+// suppressions holds the recipients not sent to, if configured.
+var suppressions *suppression.Store
+
+// configMu guards the policies, which are replaced on reload.
+var configMu sync.RWMutex
+
+// errPaused rejects emails received while relaying is paused.
+var errPaused = errors.New("421 4.3.2 Relaying paused, try again later")
+
+// headerPolicy adds, sets or removes headers before relaying, if configured.
+var headerPolicy header.Policy
+
+// senderRewrite rewrites the sender addresses before relaying, if configured.
+var senderRewrite *rewrite.Sender
+
+// dkimSigner signs the emails of domains with DKIM keys, if configured.
+var dkimSigner *dkim.Signer
+
+// recipientRedirect redirects the recipients to a catch-all address, if
+// configured.
+var recipientRedirect *rewrite.Recipients
+
+// auditLog writes the audit entries to the configured sinks, which are closed
+// on reconfiguration.
+var auditLog = log
+var auditSinks []io.Closer
+
+// adminAPI is the admin API server, whose token is replaced on reload.
+var adminAPI *admin.Server
+
+// sessions is the listener keeping track of the SMTP sessions.
+var sessions *listener.Listener
+
+// transcriptLog logs the message data of transcripts, if enabled.
+var transcriptLog *transcript.Transcript
+
+// shutdownTracing flushes the exported traces, if tracing is enabled.
+var shutdownTracing func(context.Context) error
 
 // toStringPtr returns nil for empty strings, otherwise returns a pointer to the string
 func toStringPtr(s string) *string {
@@ -49,9 +213,188 @@ func toStringPtr(s string) *string {
 	return &s
 }
 
+func defaultLogger() *slog.Logger {
+	l, _ := logger.New("json", slog.LevelInfo, logger.RecipientsPlain, os.Stdout, os.Stderr)
+	return l
+}
+
+// authHandler logs the outcome of authentication attempts.
+func authHandler() smtpd.AuthHandler {
+	return func(
+		remoteAddr net.Addr,
+		mechanism string,
+		username []byte,
+		password []byte,
+		shared []byte,
+	) (bool, error) {
+		ctx := context.Background()
+		session := sessions.Session(remoteAddr)
+		if session != nil {
+			ctx = session.Context()
+		}
+		_, span := tracing.Tracer().Start(ctx, "smtp.auth", trace.WithAttributes(
+			attribute.String("smtp.auth.mechanism", mechanism),
+			attribute.String("smtp.auth.username", string(username)),
+		))
+		configMu.RLock()
+		handler := authentication.WithCredentials(credentials).Handler
+		configMu.RUnlock()
+		success, err := handler(remoteAddr, mechanism, username, password, shared)
+		span.SetAttributes(attribute.Bool("smtp.auth.success", success))
+		tracing.End(span, err)
+		level := slog.LevelInfo
+		if !success {
+			level = slog.LevelWarn
+		} else if session != nil {
+			session.SetAuth(mechanism, string(username))
+		}
+		log.LogAttrs(context.Background(), level, "auth",
+			slog.String(logger.FieldIP, remoteAddr.(*net.TCPAddr).IP.String()),
+			slog.String("mechanism", mechanism),
+			slog.String("username", string(username)),
+			slog.Bool("success", success),
+			logger.Error(err),
+		)
+		return success, err
+	}
+}
+
+// rcptHandler records accepted recipients, which mark the start of an SMTP
+// transaction.
+// Suppressed recipients are rejected if configured.
+func rcptHandler(remoteAddr net.Addr, from string, to string) bool {
+	if suppressions != nil && *suppressMode == "reject" {
+		if entry, ok := suppressions.Lookup(to); ok {
+			log.LogAttrs(context.Background(), slog.LevelInfo, "suppressed",
+				slog.String(logger.FieldIP, remoteAddr.(*net.TCPAddr).IP.String()),
+				slog.String(logger.FieldFrom, from),
+				slog.String(logger.FieldTo, to),
+				slog.String("reason", entry.Reason),
+			)
+			return false
+		}
+	}
+	if session := sessions.Session(remoteAddr); session != nil {
+		session.AddRecipient()
+	}
+	return true
+}
+
+// handler relays the received email and returns the message IDs assigned by
+// the relay API, which is included in the SMTP reply to the client.
+// Each email is logged with an audit entry and traced with a transaction span.
+func handler(origin net.Addr, from string, to []string, data []byte) (string, error) {
+	start := time.Now()
+	ctx := context.Background()
+	transactionStart, dataStart := start, start
+	entry := audit.New(origin, from, data)
+	if session := sessions.Session(origin); session != nil {
+		entry.SetSession(session.Info())
+		ctx = session.Context()
+		if first, last := session.EndTransaction(); !first.IsZero() {
+			transactionStart, dataStart = first, last
+		}
+	}
+	entry.RelayAPI = *relayAPI
+	entry.ConfigurationSet = *setName
+	ctx, span := tracing.StartTransaction(ctx, transactionStart, data, *traceHeader)
+	_, dataSpan := tracing.Tracer().Start(ctx, "smtp.data", trace.WithTimestamp(dataStart))
+	dataSpan.SetAttributes(attribute.Int("smtp.message.size", len(data)))
+	dataSpan.End(trace.WithTimestamp(start))
+	if spanContext := span.SpanContext(); spanContext.IsValid() {
+		entry.TraceID = spanContext.TraceID().String()
+	}
+	if transcriptLog != nil {
+		transcriptLog.LogData(origin, data)
+	}
+	// The envelope recipients are logged for emails without relay result, e.g.
+	// rejected or quarantined ones:
+	entry.To = to
+	err := errPaused
+	if !sessions.Paused() {
+		configMu.RLock()
+		from, to, data, err = prepare(ctx, entry, from, to, data)
+		configMu.RUnlock()
+	}
+	var result relay.Result
+	// Quarantined emails and those to suppressed recipients only are accepted
+	// without relaying them:
+	if err == nil && len(to) > 0 && entry.DLPAction != dlp.ActionQuarantine {
+		result, err = relayClient.Send(ctx, origin, from, to, data)
+	}
+	entry.SetResult(result, err)
+	entry.Duration = time.Since(start)
+	entry.Log(auditLog)
+	span.SetAttributes(
+		attribute.Int("smtp.recipients", len(to)),
+		attribute.String("relay.api", *relayAPI),
+		attribute.String("relay.message_id", result.MessageID()),
+	)
+	tracing.End(span, err)
+	return result.Reply(), err
+}
+
+// prepare validates and modifies the received email as configured before it is
+// relayed and returns the envelope and data to send.
+func prepare(ctx context.Context, entry *audit.Entry, from string, to []string, data []byte) (
+	string,
+	[]string,
+	[]byte,
+	error,
+) {
+	to, entry.SuppressedTo = suppressions.Filter(to)
+	entry.To = to
+	if len(to) == 0 {
+		return from, to, data, nil
+	}
+	data, err := normalizer.Apply(data)
+	if err != nil {
+		return from, to, data, err
+	}
+	data, checked, err := attachmentPolicy.Apply(from, to, data)
+	entry.Attachments = checked.Attachments
+	entry.AttachmentAction = checked.Action
+	entry.AttachmentViolations = checked.Violations
+	if err != nil {
+		return from, to, data, err
+	}
+	if contentScan != nil {
+		_, span := tracing.Tracer().Start(ctx, "scan.Check")
+		scanned, err := contentScan.Check(ctx, data)
+		span.SetAttributes(attribute.String("scan.threat", scanned.Threat))
+		tracing.End(span, err)
+		entry.ScanThreat = scanned.Threat
+		if scanned.Error != nil {
+			entry.ScanError = scanned.Error.Error()
+		}
+		if err != nil {
+			return from, to, data, err
+		}
+	}
+	data, detected, err := dlpPolicy.Apply(data)
+	entry.DLPHits = detected.Hits
+	entry.DLPAction = detected.Action
+	entry.DLPQuarantineFile = detected.QuarantineFile
+	if err != nil || detected.Action == dlp.ActionQuarantine {
+		return from, to, data, err
+	}
+	data = headerPolicy.Apply(from, to, data)
+	rewrittenFrom, data := senderRewrite.Apply(from, data)
+	if rewrittenFrom != from {
+		entry.RewrittenFrom = rewrittenFrom
+		from = rewrittenFrom
+	}
+	to, data = recipientRedirect.Apply(to, data)
+	// Signing must be the last modification of the data, apart from stripping
+	// the message tags header, which must not be signed:
+	data, entry.DKIMDomain, err = dkimSigner.Sign(from, data)
+	return from, to, data, err
+}
+
 func server() (srv *smtpd.Server, err error) {
 	authMechs := make(map[string]bool)
-	if *user != "" && len(bcryptHash) > 0 && len(password) == 0 {
+	// CRAM-MD5 requires a plain text password:
+	if (*user != "" && len(bcryptHash) > 0 || *credFile != "") && len(password) == 0 {
 		authMechs["CRAM-MD5"] = false
 	}
 
@@ -59,39 +402,83 @@ func server() (srv *smtpd.Server, err error) {
 	if LookupEnvOrString("ENABLE_LOGIN", "") == "true" {
 		authMechs["LOGIN"] = true
 	}
-	
-	version := LookupEnvOrString("GIT_REV", "")
-	if version == "" {
-		log.Printf("Listening on %v\r\n", *addr)
-	}else{
-		log.Printf("(Revision: %s) Listening on %v\r\n", version, *addr)
+
+	attrs := []any{"addr", *addr, "relay_api", *relayAPI}
+	if version := LookupEnvOrString("GIT_REV", ""); version != "" {
+		attrs = append(attrs, "revision", version)
 	}
+	log.Info("listening", attrs...)
 	srv = &smtpd.Server{
 		Addr:         *addr,
-		Handler:      relayClient.Send,
+		MsgIDHandler: handler,
+		HandlerRcpt:  rcptHandler,
 		Appname:      *name,
 		Hostname:     *host,
 		TLSRequired:  *startTLS,
 		TLSListener:  *onlyTLS,
-		AuthRequired: ipMap != nil || *user != "",
-		AuthHandler:  auth.New(ipMap, *user, bcryptHash, password).Handler,
+		AuthRequired: ipMap != nil || *user != "" || *credFile != "",
+		AuthHandler:  authHandler(),
 		AuthMechs:    authMechs,
+		MaxSize:      maxSize,
+		Timeout:      *timeout,
 	}
 	if *certFile != "" && *keyFile != "" {
-		keyPass := os.Getenv("TLS_KEY_PASS")
-		if keyPass != "" {
-			err = srv.ConfigureTLSWithPassphrase(*certFile, *keyFile, keyPass)
-		} else {
-			err = srv.ConfigureTLS(*certFile, *keyFile)
-		}
+		err = configureTLS(srv)
 	}
 	return
 }
 
+// configureTLS loads the TLS certificate and key, which is decrypted with the
+// TLS key passphrase, if set.
+func configureTLS(srv *smtpd.Server) error {
+	if tlsKeyPass != "" {
+		return srv.ConfigureTLSWithPassphrase(*certFile, *keyFile, tlsKeyPass)
+	}
+	return srv.ConfigureTLS(*certFile, *keyFile)
+}
+
+// configure validates the options and sets up logging, the audit sinks,
+// tracing, the policies and the relay client.
 func configure() error {
+	return setup(false)
+}
+
+// validateConfig validates the options like configure, but without opening
+// the audit sinks, starting the trace exporter or creating the relay client.
+func validateConfig() error {
+	return setup(true)
+}
+
+func setup(validateOnly bool) error {
 	var allowFromRegExp *regexp.Regexp
 	var denyToRegExp *regexp.Regexp
 	var err error
+	level, err := logger.ParseLevel(*logLevel)
+	if err != nil {
+		return err
+	}
+	log, err = logger.New(*logFormat, level, *logRecipients, os.Stdout, os.Stderr)
+	if err != nil {
+		log = defaultLogger()
+		return err
+	}
+	if validateOnly {
+		err = validateAudit()
+	} else {
+		err = configureAudit(level)
+	}
+	if err != nil {
+		return err
+	}
+	if *tracingFlag && shutdownTracing == nil && !validateOnly {
+		shutdownTracing, err = tracing.Setup(
+			context.Background(),
+			LookupEnvOrString("GIT_REV", ""),
+		)
+		if err != nil {
+			return errors.New("Tracing: " + err.Error())
+		}
+	}
 	if *allowFrom != "" {
 		allowFromRegExp, err = regexp.Compile(*allowFrom)
 		if err != nil {
@@ -122,25 +509,336 @@ func configure() error {
 			}
 		}
 	}
+	var tags *relay.MessageTags
+	if *tagsHeader != "" || *staticTags != "" {
+		static, err := relay.ParseMessageTags(*staticTags)
+		if err != nil {
+			return errors.New("Message tags: " + err.Error())
+		}
+		tags = &relay.MessageTags{
+			Header:      *tagsHeader,
+			Static:      static,
+			StripHeader: *stripTags,
+		}
+	}
+	suppressions = nil
+	if *suppressFile != "" {
+		if *suppressMode != "reject" && *suppressMode != "remove" {
+			return errors.New("Invalid suppression mode: " + *suppressMode)
+		}
+		suppressions, err = suppression.Open(*suppressFile)
+		if err != nil {
+			return errors.New("Suppression list: " + err.Error())
+		}
+	}
+	if *ips != "" {
+		ipMap = make(map[string]bool)
+		for _, ip := range strings.Split(*ips, ",") {
+			ipMap[ip] = true
+		}
+	}
+	if *snsAddr != "" && suppressions == nil {
+		return errors.New("SNS endpoint: missing suppression file")
+	}
+	loaded, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	configMu.Lock()
+	loaded.apply()
+	configMu.Unlock()
+	var apiMaxSize int
+	var client relay.Client
 	switch *relayAPI {
 	case "pinpoint":
-		relayClient = pinpointrelay.New(setName, allowFromRegExp, denyToRegExp)
+		apiMaxSize = pinpointrelay.MaxMessageSize
+		if !validateOnly {
+			client, err = pinpointrelay.New(setName, allowFromRegExp, denyToRegExp, tags, log)
+		}
 	case "ses":
-		relayClient = sesrelay.New(setName, allowFromRegExp, denyToRegExp, arns)
+		apiMaxSize = sesrelay.MaxMessageSize
+		if !validateOnly {
+			client, err = sesrelay.New(setName, allowFromRegExp, denyToRegExp, arns, tags, log)
+		}
 	default:
 		return errors.New("Invalid relay API: " + *relayAPI)
 	}
-	if *ips != "" {
-		ipMap = make(map[string]bool)
-		for _, ip := range strings.Split(*ips, ",") {
-			ipMap[ip] = true
+	if err != nil {
+		return errors.New("Relay API: " + err.Error())
+	}
+	if client != nil {
+		relayClient = client
+	}
+	// Reject oversized messages before they are sent to the relay API:
+	if *maxSizeFlag < 0 || *maxSizeFlag > apiMaxSize {
+		return fmt.Errorf(
+			"Max message size: must be between 0 and %d bytes for the %s relay API",
+			apiMaxSize,
+			*relayAPI,
+		)
+	}
+	maxSize = apiMaxSize
+	if *maxSizeFlag > 0 {
+		maxSize = *maxSizeFlag
+	}
+	return nil
+}
+
+// settings holds the configuration replaced on reload, which is loaded
+// without holding configMu and applied at once.
+type settings struct {
+	normalizer        *message.Normalizer
+	attachmentPolicy  attachment.Policy
+	contentScan       *scan.Hook
+	dlpPolicy         *dlp.Policy
+	headerPolicy      header.Policy
+	senderRewrite     *rewrite.Sender
+	recipientRedirect *rewrite.Recipients
+	dkimSigner        *dkim.Signer
+	credentials       auth.Credentials
+	bcryptHash        []byte
+	password          []byte
+	tlsKeyPass        string
+	apiToken          string
+}
+
+// loadSettings resolves the secrets and loads the policy and credentials
+// files, without modifying the current configuration.
+func loadSettings() (*settings, error) {
+	s := &settings{}
+	err := s.loadSecrets()
+	if err == nil {
+		err = s.loadPolicies()
+	}
+	if err == nil {
+		err = s.loadCredentials()
+	}
+	return s, err
+}
+
+// apply replaces the current configuration, which requires holding configMu
+// for writing.
+func (s *settings) apply() {
+	normalizer, attachmentPolicy, contentScan = s.normalizer, s.attachmentPolicy, s.contentScan
+	dlpPolicy, headerPolicy = s.dlpPolicy, s.headerPolicy
+	senderRewrite, recipientRedirect, dkimSigner = s.senderRewrite, s.recipientRedirect, s.dkimSigner
+	credentials = s.credentials
+	bcryptHash, password, tlsKeyPass, apiToken = s.bcryptHash, s.password, s.tlsKeyPass, s.apiToken
+	authentication = auth.New(ipMap, *user, bcryptHash, password)
+}
+
+// loadPolicies creates the policies applied to emails before relaying.
+func (s *settings) loadPolicies() error {
+	var err error
+	if *normalize {
+		hostname := *host
+		if hostname == "" {
+			hostname, _ = os.Hostname()
+		}
+		s.normalizer = &message.Normalizer{Hostname: hostname}
+	}
+	if *attachRules != "" {
+		s.attachmentPolicy, err = attachment.LoadPolicy(*attachRules)
+		if err != nil {
+			return errors.New("Attachment policy: " + err.Error())
+		}
+	}
+	if *scanURL != "" {
+		scanner, err := scan.New(*scanURL, *scanTimeout)
+		if err != nil {
+			return errors.New("Content scan: " + err.Error())
 		}
+		s.contentScan = &scan.Hook{Scanner: scanner, FailOpen: *scanFailOpen}
 	}
-	bcryptHash = []byte(os.Getenv("BCRYPT_HASH"))
-	password = []byte(os.Getenv("PASSWORD"))
+	if *dlpRules != "" {
+		rules, err := dlp.LoadRules(*dlpRules)
+		if err != nil {
+			return errors.New("DLP rules: " + err.Error())
+		}
+		s.dlpPolicy, err = dlp.New(rules, *dlpQuarantine, *dlpTagHeader)
+		if err != nil {
+			return errors.New("DLP: " + err.Error())
+		}
+	}
+	if *headerRules != "" {
+		s.headerPolicy, err = header.LoadPolicy(*headerRules)
+		if err != nil {
+			return errors.New("Header policy: " + err.Error())
+		}
+	}
+	if *senderRules != "" {
+		rules, err := rewrite.LoadRules(*senderRules)
+		if err != nil {
+			return errors.New("Sender rewrite: " + err.Error())
+		}
+		s.senderRewrite = &rewrite.Sender{Rules: rules, ReplyTo: *senderReplyTo}
+	}
+	if *redirectTo != "" {
+		address, err := mail.ParseAddress(*redirectTo)
+		if err != nil {
+			return errors.New("Recipient redirect: " + err.Error())
+		}
+		s.recipientRedirect = &rewrite.Recipients{
+			Address:        address.Address,
+			PlusAddressing: *redirectPlus,
+		}
+		if *redirectAllow != "" {
+			s.recipientRedirect.Allow, err = regexp.Compile(*redirectAllow)
+			if err != nil {
+				return errors.New("Recipient redirect allowed emails: " + err.Error())
+			}
+		}
+	}
+	if *dkimKeys != "" {
+		keys, err := dkim.LoadKeys(*dkimKeys)
+		if err != nil {
+			return errors.New("DKIM keys: " + err.Error())
+		}
+		headers := dkim.DefaultHeaders
+		if *dkimHeaders != "" {
+			headers = strings.Split(*dkimHeaders, ",")
+			for i := range headers {
+				headers[i] = strings.TrimSpace(headers[i])
+			}
+		}
+		// The relay clients strip the message tags header after signing:
+		for _, name := range headers {
+			if *stripTags && strings.EqualFold(name, *tagsHeader) {
+				return errors.New("DKIM: signed header " + name + " is stripped as message tags header")
+			}
+		}
+		s.dkimSigner, err = dkim.New(keys, *dkimCanon, headers)
+		if err != nil {
+			return errors.New("DKIM: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// loadCredentials loads the credentials file, if configured.
+func (s *settings) loadCredentials() error {
+	if *credFile == "" {
+		return nil
+	}
+	loaded, err := auth.LoadCredentials(*credFile)
+	if err != nil {
+		return errors.New("Credentials file: " + err.Error())
+	}
+	s.credentials = loaded
+	return nil
+}
+
+// loadSecrets resolves the secrets given as environment variables, files
+// named by their _FILE variants or references to SSM parameters and Secrets
+// Manager secrets.
+func (s *settings) loadSecrets() error {
+	var err error
+	resolve := func(key string, value string) string {
+		if err != nil {
+			return ""
+		}
+		var secret string
+		secret, err = resolveSecret(key, value)
+		return secret
+	}
+	hash := resolve("BCRYPT_HASH", os.Getenv("BCRYPT_HASH"))
+	pass := resolve("PASSWORD", os.Getenv("PASSWORD"))
+	keyPass := resolve("TLS_KEY_PASS", os.Getenv("TLS_KEY_PASS"))
+	token := resolve("ADMIN_TOKEN", *adminToken)
+	if err != nil {
+		return errors.New("Secrets: " + err.Error())
+	}
+	if *adminAddr != "" && token == "" {
+		return errors.New("Admin API: missing token")
+	}
+	s.bcryptHash, s.password, s.tlsKeyPass, s.apiToken = []byte(hash), []byte(pass), keyPass, token
+	return nil
+}
+
+// resolveSecret returns the secret given for the key, e.g. by an option or
+// environment variable, or the content of the file named by its _FILE variant.
+func resolveSecret(key string, value string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	return secrets.Value(ctx, key, value)
+}
+
+// reload reloads the policy and credentials files and secrets, keeping the
+// current configuration on error.
+// Secrets might be resolved via network, so emails are only blocked while the
+// loaded configuration is applied.
+func reload() error {
+	s, err := loadSettings()
+	if err != nil {
+		log.Error("reload failed", logger.Error(err))
+		return err
+	}
+	configMu.Lock()
+	s.apply()
+	configMu.Unlock()
+	if adminAPI != nil {
+		adminAPI.SetToken(s.apiToken)
+	}
+	log.Info("reloaded")
 	return nil
 }
 
+// configureAudit creates the audit logger for the configured sinks.
+func configureAudit(level slog.Level) error {
+	for _, sink := range auditSinks {
+		sink.Close()
+	}
+	auditSinks = nil
+	var handlers []slog.Handler
+	if *auditStdout {
+		handlers = append(handlers, log.Handler())
+	}
+	if *auditFile != "" {
+		file, err := logger.OpenFile(*auditFile, *auditFileSize, *auditFileAge, *auditFileKeep)
+		if err != nil {
+			return errors.New("Audit file: " + err.Error())
+		}
+		auditSinks = append(auditSinks, file)
+		h, _ := logger.NewHandler(*logFormat, level, *logRecipients, file)
+		handlers = append(handlers, h)
+	}
+	if *auditSyslog != "" {
+		u, err := url.Parse(*auditSyslog)
+		if err != nil {
+			return errors.New("Audit syslog: " + err.Error())
+		}
+		address := u.Host
+		if u.Scheme == "unix" || u.Scheme == "unixgram" {
+			address = u.Path
+		}
+		s, err := logger.DialSyslog(u.Scheme, address, "aws-smtp-relay")
+		if err != nil {
+			return errors.New("Audit syslog: " + err.Error())
+		}
+		auditSinks = append(auditSinks, s)
+		h, _ := s.Handler(*logFormat, level, *logRecipients)
+		handlers = append(handlers, h)
+	}
+	auditLog = slog.New(logger.Tee(handlers...))
+	return nil
+}
+
+// validateAudit validates the audit sink options without opening the sinks.
+func validateAudit() error {
+	if *auditSyslog != "" {
+		if _, err := url.Parse(*auditSyslog); err != nil {
+			return errors.New("Audit syslog: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// fatal logs an invalid environment variable and exits.
+func fatal(msg string, key string, err error) {
+	log.Error(msg, "key", key, logger.Error(err))
+	os.Exit(1)
+}
+
 // returns the value of an environment variable or the default value
 func LookupEnvOrString(key string, defaultVal string) string {
 	if val, ok := os.LookupEnv(key); ok {
@@ -153,7 +851,29 @@ func LookupEnvOrInt(key string, defaultVal int) int {
 	if val, ok := os.LookupEnv(key); ok {
 		v, err := strconv.Atoi(val)
 		if err != nil {
-			log.Fatalf("LookupEnvOrInt[%s]: %v", key, err)
+			fatal("LookupEnvOrInt", key, err)
+		}
+		return v
+	}
+	return defaultVal
+}
+
+func LookupEnvOrInt64(key string, defaultVal int64) int64 {
+	if val, ok := os.LookupEnv(key); ok {
+		v, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			fatal("LookupEnvOrInt64", key, err)
+		}
+		return v
+	}
+	return defaultVal
+}
+
+func LookupEnvOrDuration(key string, defaultVal time.Duration) time.Duration {
+	if val, ok := os.LookupEnv(key); ok {
+		v, err := time.ParseDuration(val)
+		if err != nil {
+			fatal("LookupEnvOrDuration", key, err)
 		}
 		return v
 	}
@@ -165,26 +885,158 @@ func LookupEnvOrBool(key string, defaultVal bool) bool {
 		val = strings.ToLower(val)
 		if val == "true" {
 			return true
-		}else if val == "false" {
+		} else if val == "false" {
 			return false
 		}
-		log.Fatalf("LookupEnvOrBool[%s]: invalid value %v", key, val)
+		fatal("LookupEnvOrBool", key, errors.New("invalid value "+val))
 	}
 	return defaultVal
 }
 
+// listen creates the server listener, which enforces the connection limits.
+func listen(srv *smtpd.Server) (net.Listener, error) {
+	if srv.Hostname == "" {
+		srv.Hostname, _ = os.Hostname()
+	}
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return nil, err
+	}
+	sessions = listener.New(ln, listener.Limits{
+		MaxConnections:      *maxConns,
+		MaxConnectionsPerIP: *maxConnsPerIP,
+		MaxDataDuration:     *maxDataTime,
+	}, srv.Hostname, log)
+	ln = sessions
+	if srv.TLSConfig != nil {
+		sessions.TrackTLS(srv.TLSConfig)
+	}
+	// The smtpd logging hooks are only called in debug mode, which is set on
+	// startup, as running sessions read it. Without transcript, lines are
+	// discarded:
+	srv.LogRead, srv.LogWrite = discardLine, discardLine
+	transcriptLog = nil
+	if *debugSMTP {
+		transcriptLog = transcript.New(log, sessions, *debugAuth, *debugData, *logRecipients)
+		srv.LogRead = transcriptLog.LogRead
+		srv.LogWrite = transcriptLog.LogWrite
+	}
+	// If TLSListener is enabled, listen for TLS connections only:
+	if srv.TLSConfig != nil && srv.TLSListener {
+		ln = tls.NewListener(ln, srv.TLSConfig)
+	}
+	return ln, nil
+}
+
+// discardLine implements the smtpd.LogFunc signature without logging.
+func discardLine(remoteIP string, verb string, line string) {}
+
+// adminHandler returns the admin API handler for the configured features.
+func adminHandler() http.Handler {
+	api := admin.New(apiToken)
+	adminAPI = api
+	api.Handle("/config", admin.NewConfigHandler(flag.CommandLine, "admin-token"))
+	api.HandleFunc("POST /reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := reload(); err != nil {
+			admin.WriteError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, map[string]bool{"reloaded": true})
+	})
+	if sessions != nil {
+		h := listener.NewHandler(sessions)
+		for _, pattern := range []string{"/sessions", "/limits", "/pause", "/resume"} {
+			api.Handle(pattern, h)
+		}
+	}
+	if suppressions != nil {
+		h := suppression.NewHandler(suppressions)
+		api.Handle("/suppressions", h)
+		api.Handle("/suppressions/", h)
+	}
+	return api
+}
+
+// serveAdmin serves the admin API on the configured address, if any.
+func serveAdmin() (net.Listener, error) {
+	if *adminAddr == "" {
+		return nil, nil
+	}
+	ln, err := net.Listen("tcp", *adminAddr)
+	if err != nil {
+		return nil, errors.New("Admin API: " + err.Error())
+	}
+	log.Info("listening", "admin_addr", ln.Addr().String())
+	srv := &http.Server{Handler: adminHandler(), ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	return ln, nil
+}
+
+// snsHandler returns the handler recording SNS bounce and complaint
+// notifications in the suppression list.
+func snsHandler() http.Handler {
+	var topics []string
+	for _, topic := range strings.Split(*snsTopics, ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	return &sns.Handler{
+		Store:     suppressions,
+		Verifier:  &sns.Verifier{},
+		TopicARNs: topics,
+		TTL:       *snsTTL,
+		Log:       log,
+	}
+}
+
+// serveSNS serves the SNS notification endpoint on the configured address, if
+// any.
+func serveSNS() (net.Listener, error) {
+	if *snsAddr == "" {
+		return nil, nil
+	}
+	ln, err := net.Listen("tcp", *snsAddr)
+	if err != nil {
+		return nil, errors.New("SNS endpoint: " + err.Error())
+	}
+	log.Info("listening", "sns_addr", ln.Addr().String())
+	srv := &http.Server{Handler: snsHandler(), ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	return ln, nil
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		}
+	}
 	flag.Parse()
+	smtpd.Debug = *debugSMTP
 	var srv *smtpd.Server
+	var ln net.Listener
 	err := configure()
 	if err == nil {
 		srv, err = server()
 		if err == nil {
-			err = srv.ListenAndServe()
+			ln, err = listen(srv)
 		}
+		if err == nil {
+			_, err = serveAdmin()
+		}
+		if err == nil {
+			_, err = serveSNS()
+		}
+		if err == nil {
+			err = srv.Serve(ln)
+		}
+	}
+	if shutdownTracing != nil {
+		shutdownTracing(context.Background())
 	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		log.Error("exit", logger.Error(err))
 		os.Exit(1)
 	}
 }
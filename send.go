@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/KamorionLabs/aws-smtp-relay/internal/client"
+)
+
+// fileList is a flag.Value collecting the file paths of repeated flags.
+type fileList []string
+
+func (l *fileList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *fileList) Set(path string) error {
+	*l = append(*l, path)
+	return nil
+}
+
+// sendCommand sends a test email to an SMTP server and prints the reply to the
+// message data, which allows using the binary as diagnostic client without
+// shell.
+// It returns the exit code, which is 1 for failures and 2 for invalid usage.
+func sendCommand(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: echo TEXT | aws-smtp-relay send -f FROM -t TO [options]")
+		flags.PrintDefaults()
+	}
+	var attachments fileList
+	var (
+		address   = flags.String("a", "localhost:1025", "SMTP server address")
+		security  = flags.String("security", client.SecurityNone, "Connection security (none|starttls|tls)")
+		insecure  = flags.Bool("insecure", false, "Skip the verification of the TLS server certificate")
+		hostname  = flags.String("helo", "localhost", "Hostname sent with the EHLO command")
+		username  = flags.String("u", "", "Authentication username")
+		password  = flags.String("p", os.Getenv("SMTP_PASSWORD"), "Authentication password (default: SMTP_PASSWORD or SMTP_PASSWORD_FILE environment variable)")
+		mechanism = flags.String("auth", client.AuthPlain, "Authentication mechanism (PLAIN|LOGIN|CRAM-MD5)")
+		from      = flags.String("f", "", "Sender address, e.g. \"Alice <alice@example.org>\"")
+		to        = flags.String("t", "", "Recipient addresses (comma-separated)")
+		subject   = flags.String("s", "Test", "Subject")
+		body      = flags.String("body", "", "Text body (default: read from stdin)")
+		dataFile  = flags.String("data", "", "Raw message file sent instead of a generated message (-: stdin)")
+		timeout   = flags.Duration("timeout", 30*time.Second, "Timeout of the SMTP session (0: unlimited)")
+		verbose   = flags.Bool("v", false, "Print the SMTP transcript to stderr")
+	)
+	flags.Var(&attachments, "attach", "File to attach (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	sender, err := mail.ParseAddress(*from)
+	if err != nil {
+		fmt.Fprintln(stderr, "Invalid sender: "+err.Error())
+		return 2
+	}
+	recipients, err := mail.ParseAddressList(*to)
+	if err != nil {
+		fmt.Fprintln(stderr, "Invalid recipients: "+err.Error())
+		return 2
+	}
+	*password, err = resolveSecret("SMTP_PASSWORD", *password)
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	data, err := sendData(sender, recipients, *subject, *body, *dataFile, attachments, stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	options := client.Options{
+		Address:   *address,
+		Security:  *security,
+		Hostname:  *hostname,
+		Username:  *username,
+		Password:  *password,
+		Mechanism: *mechanism,
+		Timeout:   *timeout,
+	}
+	if *insecure {
+		options.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	if *verbose {
+		options.Transcript = stderr
+	}
+	envelopeTo := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		envelopeTo[i] = recipient.Address
+	}
+	reply, err := client.Send(options, sender.Address, envelopeTo, data)
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+	fmt.Fprintln(stdout, reply.String())
+	return 0
+}
+
+// sendData returns the raw data of the given message file or a generated
+// message with the text body or stdin and the attachments.
+func sendData(
+	from *mail.Address,
+	to []*mail.Address,
+	subject string,
+	body string,
+	dataFile string,
+	attachments []string,
+	stdin io.Reader,
+) ([]byte, error) {
+	if dataFile == "-" {
+		return io.ReadAll(stdin)
+	}
+	if dataFile != "" {
+		return os.ReadFile(dataFile)
+	}
+	if body == "" {
+		text, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, err
+		}
+		body = string(text)
+	}
+	m := &client.Message{From: from.String(), Subject: subject, Text: body}
+	for _, address := range to {
+		m.To = append(m.To, address.String())
+	}
+	for _, path := range attachments {
+		attachment, err := client.LoadAttachment(path)
+		if err != nil {
+			return nil, errors.New("Attachment: " + err.Error())
+		}
+		m.Attachments = append(m.Attachments, attachment)
+	}
+	return m.Bytes()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// relayHelper starts the relay with a mock relay client recording the sent
+// email and returns its address.
+func relayHelper(t *testing.T, sent *sentEmail) string {
+	resetHelper()
+	*user = "alice"
+	t.Setenv("PASSWORD", "secret")
+	t.Setenv("ENABLE_LOGIN", "true")
+	if err := configure(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	relayClient = mockRelayClient{messageID: "id-1", sent: sent}
+	srv, err := server()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected listen error: %s", err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func TestSendCommand(t *testing.T) {
+	sent := &sentEmail{}
+	address := relayHelper(t, sent)
+	attachment := filepath.Join(t.TempDir(), "report.csv")
+	os.WriteFile(attachment, []byte("a,b\n1,2\n"), 0600)
+	var stdout, stderr strings.Builder
+	code := sendCommand([]string{
+		"-a", address,
+		"-u", "alice",
+		"-p", "secret",
+		"-auth", "CRAM-MD5",
+		"-f", "Alice <alice@example.org>",
+		"-t", "bob@example.org, Carol <carol@example.org>",
+		"-s", "Report",
+		"-attach", attachment,
+		"-v",
+	}, strings.NewReader("See attachment.\n"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code: %d. Stderr: %s", code, stderr.String())
+	}
+	expected := "250 2.0.0 Ok: queued as id-1\n"
+	if stdout.String() != expected {
+		t.Errorf("Unexpected output: %q. Expected: %q", stdout.String(), expected)
+	}
+	if !strings.Contains(stderr.String(), "C: AUTH CRAM-MD5\n") || strings.Contains(stderr.String(), "secret") {
+		t.Errorf("Unexpected transcript: %s", stderr.String())
+	}
+	if sent.from != "alice@example.org" || strings.Join(sent.to, ",") != "bob@example.org,carol@example.org" {
+		t.Errorf("Unexpected envelope: %s %v", sent.from, sent.to)
+	}
+	data := string(sent.data)
+	for _, part := range []string{"Subject: Report\r\n", "See attachment.", `filename=report.csv`} {
+		if !strings.Contains(data, part) {
+			t.Errorf("Unexpected data: %s. Expected to contain: %s", data, part)
+		}
+	}
+}
+
+func TestSendCommandWithData(t *testing.T) {
+	sent := &sentEmail{}
+	address := relayHelper(t, sent)
+	var stdout, stderr strings.Builder
+	code := sendCommand([]string{
+		"-a", address, "-u", "alice", "-p", "secret", "-auth", "LOGIN",
+		"-f", "alice@example.org", "-t", "bob@example.org", "-data", "-",
+	}, strings.NewReader("Subject: Raw\r\n\r\nTEST\r\n"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code: %d. Stderr: %s", code, stderr.String())
+	}
+	// The relay prepends a Received header:
+	if !strings.HasSuffix(string(sent.data), "\r\nSubject: Raw\r\n\r\nTEST\r\n") {
+		t.Errorf("Unexpected data: %q", sent.data)
+	}
+}
+
+func TestSendCommandWithErrors(t *testing.T) {
+	address := relayHelper(t, &sentEmail{})
+	for _, test := range []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{[]string{"-f", "alice", "-t", "bob@example.org"}, 2, "Invalid sender: "},
+		{[]string{"-f", "alice@example.org", "-t", ""}, 2, "Invalid recipients: "},
+		{[]string{"-invalid"}, 2, "flag provided but not defined: -invalid"},
+		{[]string{"-a", address, "-f", "alice@example.org", "-t", "bob@example.org",
+			"-body", "TEST", "-attach", "missing.txt"}, 1, "Attachment: "},
+		{[]string{"-a", address, "-u", "alice", "-p", "wrong", "-auth", "LOGIN",
+			"-f", "alice@example.org", "-t", "bob@example.org", "-body", "TEST"}, 1, "AUTH: "},
+	} {
+		var stdout, stderr strings.Builder
+		code := sendCommand(test.args, strings.NewReader(""), &stdout, &stderr)
+		if code != test.code || !strings.Contains(stderr.String(), test.expected) {
+			t.Errorf("Unexpected result for %v: %d %s. Expected: %d %s",
+				test.args, code, stderr.String(), test.code, test.expected)
+		}
+	}
+}